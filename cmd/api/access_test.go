@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go_module/internal/authtest"
+	"go_module/internal/dbtest"
+	"go_module/internal/models"
+	"go_module/internal/payments"
+)
+
+// proofUpload is a multipart receipt upload with a PNG image
+func proofUpload(t *testing.T) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("reference", "REF-123")
+	part, err := w.CreateFormFile("image", "receipt.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	w.Close()
+	return &body, w.FormDataContentType()
+}
+
+// Who may read and act on a customer's profile and orders, and which roles
+// the permission-gated admin routes let through
+func TestAccessMatrix(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("PAYMENT_PROOF_DIR", t.TempDir())
+	payments.Register(payments.NewFakeProvider("fake", []byte("test-webhook-secret")), models.PaymentGCash)
+
+	customer := dbtest.NewUser(t, models.RoleCustomer)
+	actors := map[string]*models.User{
+		"customer":       customer,
+		"other customer": dbtest.NewUser(t, models.RoleCustomer),
+		"staff":          dbtest.NewUser(t, models.RoleSupport),
+		"admin":          dbtest.NewUser(t, models.RoleAdmin),
+	}
+	tokens := map[string]string{}
+	for name, u := range actors {
+		tok, err := authtest.MintToken(ctx, u.UserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[name] = tok
+	}
+
+	// Separate orders so a successful payment or upload doesn't change what
+	// the next actor sees
+	paid := dbtest.PlaceOrder(t, customer.UserID, models.PaymentGCash)
+	proof := dbtest.PlaceOrder(t, customer.UserID, models.PaymentBankTransfer)
+
+	// Targets of the admin routes. Routes that succeed for one role change
+	// their target, so each allowed role gets its own.
+	promoted := dbtest.NewUser(t, models.RoleCustomer)
+	product, err := models.CreateProduct(ctx, "Access test product", "", 100, "", 1, "standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pendingProof := func() int64 {
+		order := dbtest.PlaceOrder(t, customer.UserID, models.PaymentBankTransfer)
+		p, err := models.CreatePaymentProof(ctx, customer.UserID, order.OrderID, "REF-"+t.Name(), "receipt.png", "image/png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.ProofID
+	}
+	staffProof, adminProof := pendingProof(), pendingProof()
+	refunded := dbtest.PlaceOrder(t, customer.UserID, models.PaymentCashOnDelivery)
+	if err := models.VerifyOrderPayment(ctx, refunded.OrderID, "CASH"); err != nil {
+		t.Fatal(err)
+	}
+
+	// want lists the status each actor gets; actors left out don't make the
+	// request
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   map[string]int
+	}{
+		{http.MethodGet, fmt.Sprintf("/users/%d", customer.UserID), "", map[string]int{
+			"customer": 200, "other customer": 404, "staff": 200, "admin": 200,
+		}},
+		{http.MethodGet, fmt.Sprintf("/orders/%d/payments", paid.OrderID), "", map[string]int{
+			"customer": 200, "other customer": 404, "staff": 200, "admin": 200,
+		}},
+		{http.MethodGet, fmt.Sprintf("/orders/%d/payment-proof", proof.OrderID), "", map[string]int{
+			"customer": 200, "other customer": 404, "staff": 200, "admin": 200,
+		}},
+		{http.MethodPost, fmt.Sprintf("/orders/%d/payment-proof", proof.OrderID), "", map[string]int{
+			"customer": 201, "other customer": 404, "staff": 404, "admin": 404,
+		}},
+		{http.MethodPost, fmt.Sprintf("/orders/%d/pay", paid.OrderID), "", map[string]int{
+			"customer": 201, "other customer": 404, "staff": 404, "admin": 404,
+		}},
+		{http.MethodGet, "/admin/dashboard", "", map[string]int{
+			"customer": 403, "other customer": 403, "staff": 200, "admin": 200,
+		}},
+		{http.MethodPut, fmt.Sprintf("/admin/users/%d/role", promoted.UserID), `{"role":"support"}`, map[string]int{
+			"customer": 403, "other customer": 403, "staff": 403, "admin": 200,
+		}},
+		{http.MethodDelete, fmt.Sprintf("/admin/products/%d", product.ProductID), "", map[string]int{
+			"customer": 403, "other customer": 403, "staff": 403, "admin": 200,
+		}},
+		{http.MethodPut, fmt.Sprintf("/admin/payment-proofs/%d/approve", staffProof), "", map[string]int{
+			"customer": 403, "other customer": 403, "staff": 200,
+		}},
+		{http.MethodPut, fmt.Sprintf("/admin/payment-proofs/%d/approve", adminProof), "", map[string]int{
+			"admin": 200,
+		}},
+		{http.MethodPost, fmt.Sprintf("/admin/orders/%d/refunds", refunded.OrderID), `{"full":true,"reason":"Damaged","method":"cash"}`, map[string]int{
+			"customer": 403, "other customer": 403, "staff": 403, "admin": 201,
+		}},
+		{http.MethodGet, fmt.Sprintf("/admin/orders/%d/refunds", refunded.OrderID), "", map[string]int{
+			"customer": 403, "other customer": 403, "staff": 200, "admin": 200,
+		}},
+		// Only the owner role may change what roles grant
+		{http.MethodPost, "/admin/roles", `{"name":"auditor","permissions":["audit:read"]}`, map[string]int{
+			"customer": 403, "other customer": 403, "staff": 403, "admin": 403,
+		}},
+	}
+
+	r := newRouter()
+	// The owner goes last: their request may change the order
+	order := []string{"other customer", "staff", "admin", "customer"}
+	for _, tt := range tests {
+		for _, actor := range order {
+			want, ok := tt.want[actor]
+			if !ok {
+				continue
+			}
+			t.Run(tt.method+" "+tt.path+" as "+actor, func(t *testing.T) {
+				var req *http.Request
+				switch {
+				case tt.method == http.MethodPost && strings.HasSuffix(tt.path, "/payment-proof"):
+					body, contentType := proofUpload(t)
+					req = httptest.NewRequest(tt.method, tt.path, body)
+					req.Header.Set("Content-Type", contentType)
+				case tt.body != "":
+					req = httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+					req.Header.Set("Content-Type", "application/json")
+				default:
+					req = httptest.NewRequest(tt.method, tt.path, nil)
+				}
+				req.Header.Set("Authorization", "Bearer "+tokens[actor])
+
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, req)
+				if rec.Code != want {
+					t.Errorf("status = %d, want %d: %s", rec.Code, want, rec.Body)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go_module/internal/authtest"
+	"go_module/internal/dbtest"
+	"go_module/internal/events"
+	"go_module/internal/models"
+	"go_module/internal/payments"
+)
+
+// The audit log records the address the request came from, not one the
+// client claims in a forwarded header
+func TestAuditLogRecordsConnectionIP(t *testing.T) {
+	admin := dbtest.NewUser(t, models.RoleAdmin)
+	target := dbtest.NewUser(t, models.RoleCustomer)
+	token, err := authtest.MintToken(context.Background(), admin.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/admin/users/%d/role", target.UserID),
+		strings.NewReader(`{"role":"support"}`))
+	req.RemoteAddr = "192.0.2.7:4711"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req.Header.Set("X-Real-IP", "203.0.113.9")
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	records, err := models.GetAuditLog(context.Background(), models.AuditFilter{
+		ActorID:  admin.UserID,
+		Action:   models.AuditUserRoleChange,
+		TargetID: strconv.FormatInt(target.UserID, 10),
+	}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("found %d audit records, want 1", len(records))
+	}
+	if got := records[0].IPAddress; got != "192.0.2.7" {
+		t.Errorf("audit IP = %s, want the connection's 192.0.2.7", got)
+	}
+}
+
+// decliningProvider is a fake gateway that refuses every refund
+type decliningProvider struct {
+	*payments.FakeProvider
+}
+
+func (decliningProvider) Refund(context.Context, string, float64) (*payments.Refund, error) {
+	return nil, errors.New("refund declined")
+}
+
+// capturedOrder places a GCash order and records its payment as captured by
+// provider
+func capturedOrder(t *testing.T, userID int64, provider string) *models.Order {
+	t.Helper()
+	ctx := context.Background()
+
+	order := dbtest.PlaceOrder(t, userID, models.PaymentGCash)
+	p, err := models.CreatePayment(ctx, order.OrderID, provider, models.PaymentGCash, order.TotalAmount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := fmt.Sprintf("ref_%s_%d", provider, order.OrderID)
+	if err := models.SetPaymentIntent(ctx, p.PaymentID, &payments.Intent{ProviderRef: ref, Status: payments.StatusPending}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.ApplyPaymentEvent(ctx, provider, &payments.WebhookEvent{
+		ID:          "evt_" + ref,
+		Type:        payments.EventPaymentSucceeded,
+		ProviderRef: ref,
+		Amount:      p.Amount,
+		Currency:    p.Currency,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// Staff actions that change state outside the admin CRUD routes are audited
+// too: webhook pings and replays, and refunds the provider completed or
+// declined
+func TestAuditLogRecordsAdminActions(t *testing.T) {
+	ctx := context.Background()
+	payments.Register(payments.NewFakeProvider("fake", []byte("test-webhook-secret")))
+	payments.Register(decliningProvider{payments.NewFakeProvider("declining", nil)})
+
+	admin := dbtest.NewUser(t, models.RoleAdmin)
+	customer := dbtest.NewUser(t, models.RoleCustomer)
+	token, err := authtest.MintToken(ctx, admin.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	audited := func(t *testing.T, action, targetID string) {
+		t.Helper()
+		records, err := models.GetAuditLog(ctx, models.AuditFilter{
+			ActorID:  admin.UserID,
+			Action:   action,
+			TargetID: targetID,
+		}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 {
+			t.Errorf("found %d %s audit records for %s, want 1", len(records), action, targetID)
+		}
+	}
+
+	webhook, err := models.CreateWebhook(ctx, "https://example.com/hooks", "", []string{events.Types[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhookID := strconv.FormatInt(webhook.WebhookID, 10)
+	refund := `{"full":true,"reason":"Damaged","method":"original_payment"}`
+
+	t.Run("webhook ping and replay", func(t *testing.T) {
+		rec := do(http.MethodPost, "/admin/webhooks/"+webhookID+"/ping", "")
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("ping status = %d, want 202: %s", rec.Code, rec.Body)
+		}
+		audited(t, models.AuditWebhookPing, webhookID)
+
+		var ping models.WebhookDelivery
+		if err := json.Unmarshal(rec.Body.Bytes(), &ping); err != nil {
+			t.Fatal(err)
+		}
+		rec = do(http.MethodPost, fmt.Sprintf("/admin/webhooks/%s/deliveries/%d/replay", webhookID, ping.DeliveryID), "")
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("replay status = %d, want 202: %s", rec.Code, rec.Body)
+		}
+		audited(t, models.AuditWebhookReplay, webhookID)
+	})
+
+	t.Run("refund completed", func(t *testing.T) {
+		order := capturedOrder(t, customer.UserID, "fake")
+		rec := do(http.MethodPost, fmt.Sprintf("/admin/orders/%d/refunds", order.OrderID), refund)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+		}
+		var got models.Refund
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		audited(t, models.AuditRefundComplete, strconv.FormatInt(got.RefundID, 10))
+	})
+
+	t.Run("refund declined", func(t *testing.T) {
+		order := capturedOrder(t, customer.UserID, "declining")
+		rec := do(http.MethodPost, fmt.Sprintf("/admin/orders/%d/refunds", order.OrderID), refund)
+		if rec.Code != http.StatusBadGateway {
+			t.Fatalf("status = %d, want 502: %s", rec.Code, rec.Body)
+		}
+		refunds, err := models.GetRefundsByOrderID(ctx, order.OrderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(refunds) != 1 || refunds[0].Status != models.RefundFailed {
+			t.Fatalf("refunds = %+v, want one failed refund", refunds)
+		}
+		audited(t, models.AuditRefundFail, strconv.FormatInt(refunds[0].RefundID, 10))
+	})
+}
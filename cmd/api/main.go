@@ -1,36 +1,215 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"go_module/internal/database"
+	"go_module/internal/events"
 	"go_module/internal/handlers"
+	"go_module/internal/logging"
+	"go_module/internal/mail"
+	"go_module/internal/metrics"
 	"go_module/internal/middleware"
 	"go_module/internal/models"
+	"go_module/internal/notify"
+	"go_module/internal/payments"
+	"go_module/internal/ratelimit"
+	"go_module/internal/tracing"
+	"go_module/internal/webhooks"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	dev := flag.Bool("dev", false, "development mode: listen on loopback only and print an admin access token")
+	flag.Parse()
+
+	// Structured logs (LOG_FORMAT=text|json, LOG_LEVEL=debug|info|warn|error).
+	// Dev mode logs at debug level unless LOG_LEVEL says otherwise.
+	logConfig, err := logging.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dev && os.Getenv("LOG_LEVEL") == "" {
+		logConfig.Level = slog.LevelDebug
+	}
+	logging.Setup(os.Stderr, logConfig)
+
+	// Development mode is only for a developer's own machine
+	if *dev {
+		addrSet := false
+		flag.Visit(func(f *flag.Flag) { addrSet = addrSet || f.Name == "addr" })
+		if !addrSet {
+			*addr = "127.0.0.1:8080"
+		}
+		if !isLoopback(*addr) {
+			logging.Fatal("Refusing to start in --dev mode: dev mode may only listen on a loopback address", "addr", *addr)
+		}
+	}
+
+	// Export traces (OTEL_TRACES_EXPORTER=none|stdout|otlp). The tracer
+	// provider must be set before the database opens its traced connections.
+	// The server runs until it is killed, so there is no shutdown to flush
+	// the last batch of spans.
+	traceConfig, err := tracing.ConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to configure tracing", "error", err)
+	}
+	if _, err := tracing.Setup(context.Background(), traceConfig); err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+
 	// Initialize SQLite database (stored in ./data/lab.db)
 	database.InitDB()
 
+	// Load VAT pricing mode (VAT_PRICING=inclusive|exclusive)
+	models.LoadTaxConfig()
+
+	// Load payment method rules (PAYMENT_METHODS_CONFIG=path/to/methods.json)
+	if err := models.LoadPaymentMethodConfig(); err != nil {
+		logging.Fatal("Failed to load payment methods", "error", err)
+	}
+
+	// Load the access token key set (JWT_KEYS_CONFIG=path/to/keys.json).
+	// Only --dev may fall back to the built-in development key.
+	if err := middleware.LoadSigningKeys(*dev); err != nil {
+		logging.Fatal("Failed to load JWT keys", "error", err)
+	}
+
+	// Select how email is delivered (MAIL_TRANSPORT=log|file|smtp)
+	if err := mail.LoadConfig(); err != nil {
+		logging.Fatal("Failed to configure email", "error", err)
+	}
+
+	// Storefront address used in emailed links (APP_URL)
+	if v := os.Getenv("APP_URL"); v != "" {
+		notify.AppURL = strings.TrimRight(v, "/")
+	}
+
+	// Whether new accounts must verify their email before logging in
+	// (REQUIRE_EMAIL_VERIFICATION, default true)
+	if v := os.Getenv("REQUIRE_EMAIL_VERIFICATION"); v != "" {
+		required, err := strconv.ParseBool(v)
+		if err != nil {
+			logging.Fatal("Invalid REQUIRE_EMAIL_VERIFICATION", "value", v, "error", err)
+		}
+		models.RequireEmailVerification = required
+	}
+
+	// Rate limit the unauthenticated auth endpoints (RATE_LIMIT, default
+	// true). Buckets are kept in memory, which suits a single server.
+	var limiter ratelimit.Store = ratelimit.NewMemoryStore()
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			logging.Fatal("Invalid RATE_LIMIT", "value", v, "error", err)
+		}
+		if !enabled {
+			limiter = nil
+		}
+	}
+
+	// Lifetime of access tokens (ACCESS_TOKEN_TTL, e.g. "5m")
+	if v := os.Getenv("ACCESS_TOKEN_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			logging.Fatal("Invalid ACCESS_TOKEN_TTL", "value", v, "error", err)
+		}
+		middleware.AccessTokenTTL = d
+	}
+
+	// Register online payment providers. The fake provider stands in for a
+	// hosted GCash gateway, but it marks orders paid for any event signed
+	// with its secret, so it only runs in --dev, which is loopback only.
+	// Until a real gateway is registered here, GCash orders are paid by
+	// uploading a receipt.
+	if *dev {
+		webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+		if webhookSecret == "" {
+			webhookSecret = "dev-webhook-secret"
+		}
+		payments.Register(payments.NewFakeProvider("fake", []byte(webhookSecret)), "gcash")
+	}
+
 	// Ensure admin user exists
-	if err := models.EnsureAdminExists(); err != nil {
-		log.Printf("Warning: Failed to ensure admin exists: %v", err)
+	if err := models.EnsureAdminExists(context.Background()); err != nil {
+		slog.Warn("Failed to ensure admin exists", "error", err)
+	}
+
+	// Create built-in staff roles and load role permissions
+	if err := models.EnsureRoles(context.Background()); err != nil {
+		logging.Fatal("Failed to set up roles", "error", err)
+	}
+
+	// Subscribe to domain events and deliver them in the background.
+	// Subscribers must be registered before any event is recorded.
+	notify.StockAlertEmail = os.Getenv("STOCK_ALERT_EMAIL")
+	events.Subscribe("email", notify.HandleEvent, notify.EventTypes...)
+	events.Subscribe("webhooks", webhooks.HandleEvent, events.Types...)
+	go events.Run(context.Background())
+	go webhooks.Run(context.Background())
+
+	// In dev mode, print a real admin token instead of bypassing authentication
+	if *dev {
+		admin, err := models.GetUserByEmail(context.Background(), "admin@example.com")
+		if err != nil {
+			logging.Fatal("Failed to find admin user for --dev", "error", err)
+		}
+		token, err := devToken(context.Background(), admin)
+		if err != nil {
+			logging.Fatal("Failed to mint dev token", "error", err)
+		}
+		// Printed outside the log, which would redact it
+		fmt.Fprintf(os.Stderr, "Dev mode: admin access token (valid for %v): %s\n", middleware.AccessTokenTTL, token)
+	}
+
+	// Expose Prometheus metrics, read from the database when scraped
+	metrics.Register()
+
+	// Create Gin router. Every request gets an ID that is logged with it and
+	// returned in X-Request-ID, and a trace span; its latency is recorded by
+	// route.
+	r := gin.New()
+	if err := setTrustedProxies(r, os.Getenv("TRUSTED_PROXIES")); err != nil {
+		logging.Fatal("Invalid TRUSTED_PROXIES", "error", err)
+	}
+	r.Use(gin.Recovery())
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Tracing())
+	r.Use(middleware.AccessLog())
+	r.Use(middleware.Metrics())
+
+	// Bound every request's database work (REQUEST_TIMEOUT, e.g. "15s")
+	requestTimeout := 30 * time.Second
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			logging.Fatal("Invalid REQUEST_TIMEOUT", "value", v, "error", err)
+		}
+		requestTimeout = d
 	}
+	r.Use(middleware.RequestTimeout(requestTimeout))
 
-	// Create Gin router with default middleware
-	r := gin.Default()
+	// Render errors attached by handlers as a JSON error envelope
+	r.Use(handlers.ErrorHandler())
 
 	// Configure CORS
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "Idempotency-Key", "X-Request-ID", "traceparent", "tracestate"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -39,85 +218,55 @@ func main() {
 	r.OPTIONS("/*path", func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Idempotency-Key")
 		c.Status(204)
 	})
 
-	// Serve static files from public directory
-	r.Static("/assets", "./public/assets")
-
-	// Public routes - no authentication needed
-	// POST /register - Create a new user account
-	r.POST("/register", handlers.RegisterUser)
-	// POST /login - Login and get JWT token
-	r.POST("/login", handlers.LoginUser)
-	// GET /products - List all products
-	r.GET("/products", handlers.GetProducts)
-	// GET /products/:id - Get single product details
-	r.GET("/products/:id", handlers.GetProduct)
-
-	// Customer routes - requires valid JWT token
-	auth := r.Group("/")
-	auth.Use(middleware.AuthMiddleware())
-	{
-		// GET /users/:id - Get user profile
-		auth.GET("/users/:id", handlers.GetUser)
-
-		// Cart routes
-		// POST /cart/add - Add item to cart
-		auth.POST("/cart/add", handlers.AddToCart)
-		// PUT /cart/update - Update cart item quantity
-		auth.PUT("/cart/update", handlers.UpdateCartItem)
-		// POST /cart/decrease - Decrease cart item quantity
-		auth.POST("/cart/decrease", handlers.DecreaseCartItem)
-		// DELETE /cart/:id - Remove item from cart
-		auth.DELETE("/cart/:id", handlers.RemoveCartItem)
-		// DELETE /cart - Clear cart
-		auth.DELETE("/cart", handlers.ClearCart)
-		// GET /cart - View cart contents
-		auth.GET("/cart", handlers.GetCart)
-
-		// Checkout and orders
-		// POST /checkout - Place order
-		auth.POST("/checkout", handlers.Checkout)
-		// GET /orders - View user's orders
-		auth.GET("/orders", handlers.GetOrders)
-	}
-
-	// Admin routes - requires valid JWT token with admin role
-	admin := r.Group("/admin")
-	admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
-	{
-		// GET /admin/dashboard - Get dashboard metrics
-		admin.GET("/dashboard", handlers.GetDashboardMetrics)
-
-		// Products management
-		// GET /admin/products - Get all products (admin view)
-		admin.GET("/products", handlers.GetAdminProducts)
-		// POST /admin/products - Create product
-		admin.POST("/products", handlers.CreateProduct)
-		// PUT /admin/products/:id - Update product
-		admin.PUT("/products/:id", handlers.UpdateProduct)
-		// DELETE /admin/products/:id - Delete product
-		admin.DELETE("/products/:id", handlers.DeleteProduct)
-
-		// Orders management
-		// GET /admin/orders - View all orders
-		admin.GET("/orders", handlers.AdminGetOrders)
-		// PUT /admin/orders/:id/status - Update order status
-		admin.PUT("/orders/:id/status", handlers.AdminUpdateOrderStatus)
-		// PUT /admin/orders/:id/verify - Verify order payment
-		admin.PUT("/orders/:id/verify", handlers.VerifyPayment)
-	}
-
-	// Test endpoint
-	r.GET("/test-cors", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "CORS is working!",
-		})
-	})
+	// API routes (see routes.go)
+	registerRoutes(r, limiter, os.Getenv("METRICS_TOKEN"))
+
+	// Start server (default port 8080)
+	slog.Info("Lab project server starting", "addr", *addr)
+	if err := r.Run(*addr); err != nil {
+		logging.Fatal("Server stopped", "error", err)
+	}
+}
+
+// isLoopback reports whether a listen address only accepts local connections.
+// An empty host listens on every interface, so it is not loopback.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// setTrustedProxies makes r believe X-Forwarded-For and X-Real-IP only from
+// the proxies in a comma-separated list of IPs and CIDRs. With an empty list
+// the client IP is always the connection's address, so clients can't choose
+// the IP that rate limits, sessions and the audit log record.
+func setTrustedProxies(r *gin.Engine, list string) error {
+	var proxies []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return r.SetTrustedProxies(proxies)
+}
 
-	// Start server on port 8080
-	log.Println("Lab project server starting on http://localhost:8080")
-	r.Run(":8080")
+// devToken starts a session for a user and returns an access token for it,
+// as /login would but without the password. It is only called in --dev;
+// tests mint tokens with internal/authtest, which the server doesn't import.
+func devToken(ctx context.Context, user *models.User) (string, error) {
+	session, _, err := models.CreateSession(ctx, user.UserID, "dev", "127.0.0.1")
+	if err != nil {
+		return "", err
+	}
+	return middleware.GenerateToken(user.UserID, user.Role, session.SessionID)
 }
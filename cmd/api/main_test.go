@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/handlers"
+	"go_module/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pkgDir is this package's directory; dbtest moves the tests into a
+// temporary one
+var pkgDir, _ = os.Getwd()
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dbtest.Main(m)
+}
+
+// publicRoutes are the routes served without an access token
+var publicRoutes = map[string]bool{
+	"GET /assets/*filepath":             true,
+	"HEAD /assets/*filepath":            true,
+	"POST /register":                    true,
+	"POST /login":                       true,
+	"POST /auth/refresh":                true,
+	"POST /auth/verify-email":           true,
+	"POST /auth/resend-verification":    true,
+	"POST /auth/forgot-password":        true,
+	"POST /auth/reset-password":         true,
+	"GET /products":                     true,
+	"GET /products/:id":                 true,
+	"GET /shipping/rates":               true,
+	"GET /payment-methods":              true,
+	"POST /webhooks/payments/:provider": true,
+	"GET /healthz":                      true,
+	"GET /readyz":                       true,
+	"GET /metrics":                      true,
+	"GET /test-cors":                    true,
+}
+
+// newRouter serves the API's routes as main does, without rate limits
+func newRouter() *gin.Engine {
+	r := gin.New()
+	setTrustedProxies(r, "")
+	r.Use(handlers.ErrorHandler())
+	registerRoutes(r, nil, "")
+	return r
+}
+
+// Every route that isn't deliberately public must refuse a request without
+// a token, so no route can be added outside the auth groups by mistake
+func TestRoutesRequireAuth(t *testing.T) {
+	r := newRouter()
+	for _, route := range r.Routes() {
+		name := route.Method + " " + route.Path
+		if publicRoutes[name] {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			path := route.Path
+			for _, seg := range strings.Split(path, "/") {
+				if strings.HasPrefix(seg, ":") {
+					path = strings.Replace(path, seg, "1", 1)
+				}
+			}
+			req := httptest.NewRequest(route.Method, path, strings.NewReader("{}"))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d without a token, want 401", rec.Code)
+			}
+		})
+	}
+}
+
+// Test helpers that mint tokens must not be linked into the server
+func TestServerDoesNotImportTestHelpers(t *testing.T) {
+	cmd := exec.Command("go", "list", "-deps", ".")
+	cmd.Dir = pkgDir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("go list: %v", err)
+	}
+	for _, pkg := range strings.Fields(string(out)) {
+		if strings.HasSuffix(pkg, "test") && strings.HasPrefix(pkg, "go_module/") {
+			t.Errorf("server imports %s", pkg)
+		}
+	}
+}
+
+// Forwarded headers only count when the request comes through a trusted
+// proxy; otherwise clients could dodge per-IP rate limits and forge the IPs
+// in the audit log
+func TestTrustedProxies(t *testing.T) {
+	tests := []struct {
+		proxies string
+		want    string
+	}{
+		{"", "192.0.2.1"},
+		{"10.0.0.1", "192.0.2.1"},
+		{"192.0.2.0/24", "203.0.113.9"},
+		{"10.0.0.1, 192.0.2.1", "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.proxies, func(t *testing.T) {
+			r := gin.New()
+			if err := setTrustedProxies(r, tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, middleware.ByIP(c)) })
+
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = "192.0.2.1:4711"
+			req.Header.Set("X-Forwarded-For", "203.0.113.9")
+			req.Header.Set("X-Real-IP", "203.0.113.9")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("client IP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if err := setTrustedProxies(gin.New(), "not-an-ip"); err == nil {
+		t.Error("setTrustedProxies accepted an invalid proxy")
+	}
+}
+
+// --dev prints an admin token, so it must refuse any address reachable from
+// other hosts
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{":8080", false},
+		{"0.0.0.0:80", false},
+		{"[::]:80", false},
+		{"192.0.2.1:80", false},
+		{"example.com:80", false},
+		{"8080", false},
+		{"[::1]:80", true},
+		{"localhost:80", true},
+		{"127.0.0.1:8080", true},
+		{"127.0.0.2:80", true},
+	}
+	for _, tt := range tests {
+		if got := isLoopback(tt.addr); got != tt.want {
+			t.Errorf("isLoopback(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
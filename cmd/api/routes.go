@@ -0,0 +1,225 @@
+package main
+
+import (
+	"time"
+
+	"go_module/internal/handlers"
+	"go_module/internal/middleware"
+	"go_module/internal/models"
+	"go_module/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerRoutes adds every route of the API to r. Routes outside the auth
+// and admin groups are public. limiter backs the rate limits of the public
+// auth endpoints and may be nil to turn them off; metricsToken guards
+// /metrics when it is set.
+func registerRoutes(r *gin.Engine, limiter ratelimit.Store, metricsToken string) {
+	limit := func(name string, burst int, per time.Duration, key middleware.KeyFunc) gin.HandlerFunc {
+		return middleware.RateLimit(limiter, name, ratelimit.Limit{Burst: burst, Per: per}, key)
+	}
+	byEmail := middleware.ByJSONField("email")
+
+	// Serve static files from public directory
+	r.Static("/assets", "./public/assets")
+
+	// Public routes - no authentication needed
+	// POST /register - Create a new user account
+	r.POST("/register", limit("register-ip", 5, time.Hour, middleware.ByIP), handlers.RegisterUser)
+	// POST /login - Login and get JWT token
+	r.POST("/login",
+		limit("login-ip", 20, time.Minute, middleware.ByIP),
+		limit("login-account", 10, 15*time.Minute, byEmail),
+		handlers.LoginUser)
+	// POST /auth/refresh - Exchange a refresh token for new tokens
+	r.POST("/auth/refresh", handlers.RefreshToken)
+	// POST /auth/verify-email - Confirm an email address with an emailed token
+	r.POST("/auth/verify-email", handlers.VerifyEmail)
+	// POST /auth/resend-verification - Email a new verification link
+	r.POST("/auth/resend-verification",
+		limit("account-email-ip", 5, 15*time.Minute, middleware.ByIP),
+		limit("account-email", 3, 15*time.Minute, byEmail),
+		handlers.ResendVerification)
+	// POST /auth/forgot-password - Email a password reset link
+	r.POST("/auth/forgot-password",
+		limit("account-email-ip", 5, 15*time.Minute, middleware.ByIP),
+		limit("account-email", 3, 15*time.Minute, byEmail),
+		handlers.ForgotPassword)
+	// POST /auth/reset-password - Set a new password with an emailed token
+	r.POST("/auth/reset-password", handlers.ResetPassword)
+	// GET /products - List all products
+	r.GET("/products", handlers.GetProducts)
+	// GET /products/:id - Get single product details
+	r.GET("/products/:id", handlers.GetProduct)
+	// GET /shipping/rates - List shipping zones and rates
+	r.GET("/shipping/rates", handlers.GetShippingRates)
+	// GET /payment-methods - List enabled payment methods and their rules
+	r.GET("/payment-methods", handlers.GetPaymentMethods)
+	// POST /webhooks/payments/:provider - Signed payment provider notifications
+	r.POST("/webhooks/payments/:provider", handlers.PaymentWebhook)
+
+	// Customer routes - requires valid JWT token
+	auth := r.Group("/")
+	auth.Use(middleware.AuthMiddleware())
+	{
+		// POST /auth/logout - Revoke the current session
+		auth.POST("/auth/logout", handlers.Logout)
+		// POST /auth/logout-all - Revoke all of the user's sessions
+		auth.POST("/auth/logout-all", handlers.LogoutAll)
+
+		// GET /users/me - Get the logged-in user's profile
+		auth.GET("/users/me", handlers.GetMe)
+		// GET /users/:id - Get user profile (own profile unless admin)
+		auth.GET("/users/:id", handlers.GetUser)
+
+		// Address book
+		// GET /users/me/addresses - List saved addresses
+		auth.GET("/users/me/addresses", handlers.GetMyAddresses)
+		// POST /users/me/addresses - Save a new address
+		auth.POST("/users/me/addresses", handlers.CreateMyAddress)
+		// PUT /users/me/addresses/:addressId - Update a saved address
+		auth.PUT("/users/me/addresses/:addressId", handlers.UpdateMyAddress)
+		// PUT /users/me/addresses/:addressId/default - Make an address the default
+		auth.PUT("/users/me/addresses/:addressId/default", handlers.SetMyDefaultAddress)
+		// DELETE /users/me/addresses/:addressId - Delete a saved address
+		auth.DELETE("/users/me/addresses/:addressId", handlers.DeleteMyAddress)
+
+		// Cart routes
+		// POST /cart/add - Add item to cart
+		auth.POST("/cart/add", handlers.Idempotency(), handlers.AddToCart)
+		// PUT /cart/update - Update cart item quantity
+		auth.PUT("/cart/update", handlers.UpdateCartItem)
+		// POST /cart/decrease - Decrease cart item quantity
+		auth.POST("/cart/decrease", handlers.DecreaseCartItem)
+		// DELETE /cart/:id - Remove item from cart
+		auth.DELETE("/cart/:id", handlers.RemoveCartItem)
+		// DELETE /cart - Clear cart
+		auth.DELETE("/cart", handlers.ClearCart)
+		// GET /cart - View cart contents
+		auth.GET("/cart", handlers.GetCart)
+		// POST /cart/shipping-quote - Quote shipping for the cart to a destination
+		auth.POST("/cart/shipping-quote", handlers.GetShippingQuote)
+
+		// Checkout and orders
+		// POST /checkout - Place order
+		auth.POST("/checkout", handlers.Idempotency(), handlers.Checkout)
+		// GET /orders - View user's orders
+		auth.GET("/orders", handlers.GetOrders)
+		// POST /orders/:id/pay - Start an online payment for an order
+		auth.POST("/orders/:id/pay", handlers.Idempotency(), handlers.CreateOrderPayment)
+		// GET /orders/:id/payments - List payment attempts for an order
+		auth.GET("/orders/:id/payments", handlers.GetOrderPayments)
+		// POST /orders/:id/payment-proof - Upload a receipt and reference number
+		auth.POST("/orders/:id/payment-proof", handlers.SubmitPaymentProof)
+		// GET /orders/:id/payment-proof - List proof submissions and their review status
+		auth.GET("/orders/:id/payment-proof", handlers.GetMyPaymentProofs)
+	}
+
+	// Staff routes - requires valid JWT token; each route requires a permission
+	// of the user's role (see models.Permissions)
+	admin := r.Group("/admin")
+	admin.Use(middleware.AuthMiddleware())
+	can := middleware.RequirePermission
+	{
+		// GET /admin/dashboard - Get dashboard metrics
+		admin.GET("/dashboard", can(models.PermDashboardView), handlers.GetDashboardMetrics)
+
+		// Products management
+		// GET /admin/products - Get all products (admin view)
+		admin.GET("/products", can(models.PermProductsRead), handlers.GetAdminProducts)
+		// POST /admin/products - Create product
+		admin.POST("/products", can(models.PermProductsWrite), handlers.CreateProduct)
+		// PUT /admin/products/:id - Update product
+		admin.PUT("/products/:id", can(models.PermProductsWrite), handlers.UpdateProduct)
+		// DELETE /admin/products/:id - Delete product
+		admin.DELETE("/products/:id", can(models.PermProductsWrite), handlers.DeleteProduct)
+
+		// Orders management
+		// GET /admin/orders - View all orders
+		admin.GET("/orders", can(models.PermOrdersRead), handlers.AdminGetOrders)
+		// PUT /admin/orders/:id/status - Update order status
+		admin.PUT("/orders/:id/status", can(models.PermOrdersUpdateStatus), handlers.AdminUpdateOrderStatus)
+		// PUT /admin/orders/:id/verify - Verify order payment
+		admin.PUT("/orders/:id/verify", can(models.PermPaymentsVerify), handlers.VerifyPayment)
+		// POST /admin/orders/:id/refunds - Issue a full or partial refund
+		admin.POST("/orders/:id/refunds", can(models.PermRefundsWrite), handlers.Idempotency(), handlers.AdminCreateRefund)
+		// GET /admin/orders/:id/refunds - List refunds for an order
+		admin.GET("/orders/:id/refunds", can(models.PermRefundsRead), handlers.AdminGetOrderRefunds)
+		// GET /admin/refunds - List refunds issued in a date range
+		admin.GET("/refunds", can(models.PermRefundsRead), handlers.AdminGetRefunds)
+
+		// Proof-of-payment review
+		// GET /admin/payment-proofs - Review queue, filtered by ?status= (default pending)
+		admin.GET("/payment-proofs", can(models.PermPaymentsVerify), handlers.AdminGetPaymentProofs)
+		// GET /admin/payment-proofs/:id/image - View a submitted receipt
+		admin.GET("/payment-proofs/:id/image", can(models.PermPaymentsVerify), handlers.AdminGetPaymentProofImage)
+		// PUT /admin/payment-proofs/:id/approve - Approve and verify the order payment
+		admin.PUT("/payment-proofs/:id/approve", can(models.PermPaymentsVerify), handlers.AdminApprovePaymentProof)
+		// PUT /admin/payment-proofs/:id/reject - Reject with a reason
+		admin.PUT("/payment-proofs/:id/reject", can(models.PermPaymentsVerify), handlers.AdminRejectPaymentProof)
+
+		// Reports
+		// GET /admin/reports/sales - Sales and VAT totals for a date range
+		admin.GET("/reports/sales", can(models.PermReportsView), handlers.GetSalesReport)
+
+		// Users, roles and permissions
+		// GET /admin/users - List users and their roles
+		admin.GET("/users", can(models.PermUsersRead), handlers.AdminGetUsers)
+		// PUT /admin/users/:id/role - Assign a role to a user
+		admin.PUT("/users/:id/role", can(models.PermUsersManageRoles), handlers.AdminSetUserRole)
+		// GET /admin/permissions - List the permissions roles can grant
+		admin.GET("/permissions", can(models.PermUsersManageRoles), handlers.AdminGetPermissions)
+		// GET /admin/roles - List roles and their permissions
+		admin.GET("/roles", can(models.PermUsersManageRoles), handlers.AdminGetRoles)
+		// POST /admin/roles - Create a custom role
+		admin.POST("/roles", can(models.PermRolesManage), handlers.AdminCreateRole)
+		// PUT /admin/roles/:name - Change a role's permissions
+		admin.PUT("/roles/:name", can(models.PermRolesManage), handlers.AdminUpdateRole)
+		// DELETE /admin/roles/:name - Delete an unused custom role
+		admin.DELETE("/roles/:name", can(models.PermRolesManage), handlers.AdminDeleteRole)
+
+		// Outgoing webhooks
+		// GET /admin/webhook-events - List the event types webhooks can subscribe to
+		admin.GET("/webhook-events", can(models.PermWebhooksManage), handlers.AdminGetWebhookEvents)
+		// GET /admin/webhooks - List webhooks
+		admin.GET("/webhooks", can(models.PermWebhooksManage), handlers.AdminGetWebhooks)
+		// POST /admin/webhooks - Subscribe an endpoint to events
+		admin.POST("/webhooks", can(models.PermWebhooksManage), handlers.AdminCreateWebhook)
+		// GET /admin/webhooks/:id - Get a webhook
+		admin.GET("/webhooks/:id", can(models.PermWebhooksManage), handlers.AdminGetWebhook)
+		// PUT /admin/webhooks/:id - Change a webhook's URL, events or active flag
+		admin.PUT("/webhooks/:id", can(models.PermWebhooksManage), handlers.AdminUpdateWebhook)
+		// DELETE /admin/webhooks/:id - Delete a webhook and its delivery log
+		admin.DELETE("/webhooks/:id", can(models.PermWebhooksManage), handlers.AdminDeleteWebhook)
+		// POST /admin/webhooks/:id/rotate-secret - Replace a webhook's signing secret
+		admin.POST("/webhooks/:id/rotate-secret", can(models.PermWebhooksManage), handlers.AdminRotateWebhookSecret)
+		// POST /admin/webhooks/:id/ping - Send a test delivery
+		admin.POST("/webhooks/:id/ping", can(models.PermWebhooksManage), handlers.AdminPingWebhook)
+		// GET /admin/webhooks/:id/deliveries - Delivery log
+		admin.GET("/webhooks/:id/deliveries", can(models.PermWebhooksManage), handlers.AdminGetWebhookDeliveries)
+		// GET /admin/webhooks/:id/deliveries/:deliveryId - One delivery with its payload and response
+		admin.GET("/webhooks/:id/deliveries/:deliveryId", can(models.PermWebhooksManage), handlers.AdminGetWebhookDelivery)
+		// POST /admin/webhooks/:id/deliveries/:deliveryId/replay - Send a delivery again
+		admin.POST("/webhooks/:id/deliveries/:deliveryId/replay", can(models.PermWebhooksManage), handlers.AdminReplayWebhookDelivery)
+
+		// GET /admin/audit - Search the audit log of admin actions
+		admin.GET("/audit", can(models.PermAuditRead), handlers.AdminGetAuditLog)
+		// GET /admin/audit/export - Download the matching audit log as CSV or JSON lines
+		admin.GET("/audit/export", can(models.PermAuditRead), handlers.AdminExportAuditLog)
+	}
+
+	// GET /healthz - Liveness: the process is serving requests
+	r.GET("/healthz", handlers.Healthz)
+	// GET /readyz - Readiness: database, migrations and free disk space
+	r.GET("/readyz", handlers.Readyz)
+	// GET /metrics - Prometheus metrics, behind METRICS_TOKEN when it is set
+	r.GET("/metrics", handlers.Metrics(metricsToken))
+
+	// Test endpoint
+	r.GET("/test-cors", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"message": "CORS is working!",
+		})
+	})
+}
@@ -0,0 +1,223 @@
+// Command loadtest drives concurrent cart updates and checkouts against a
+// running API server and reports throughput, latency and error counts. It is
+// used to check how the database layer behaves under write contention. The
+// customers it signs up are never verified, and all sign up from one IP, so
+// start the server with REQUIRE_EMAIL_VERIFICATION=false RATE_LIMIT=false.
+//
+//	go run ./cmd/loadtest -url http://localhost:8080 -users 20 -duration 30s
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stats collects the outcome of every request made by one kind of operation
+type stats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	codes     map[int]int
+	errors    int
+}
+
+func newStats() *stats {
+	return &stats{codes: map[int]int{}}
+}
+
+func (s *stats) record(code int, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.codes[code]++
+	s.latencies = append(s.latencies, d)
+}
+
+// report prints the request rate, status code counts and latency percentiles
+func (s *stats) report(name string, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	pct := func(p float64) time.Duration {
+		if len(s.latencies) == 0 {
+			return 0
+		}
+		return s.latencies[int(p*float64(len(s.latencies)-1))]
+	}
+
+	fmt.Printf("%-9s %6d requests  %7.1f req/s  p50 %-10v p95 %-10v p99 %-10v max %v\n",
+		name, len(s.latencies), float64(len(s.latencies))/elapsed.Seconds(),
+		pct(0.50).Round(time.Microsecond), pct(0.95).Round(time.Microsecond),
+		pct(0.99).Round(time.Microsecond), pct(1).Round(time.Microsecond))
+
+	codes := make([]int, 0, len(s.codes))
+	for code := range s.codes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Printf("          %d: %d\n", code, s.codes[code])
+	}
+	if s.errors > 0 {
+		fmt.Printf("          transport errors: %d\n", s.errors)
+	}
+}
+
+// client is one simulated customer
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// do sends a JSON request and returns the status code and response body
+func (c *client) do(method, path string, body interface{}) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// signUp registers a fresh customer account and logs it in
+func (c *client) signUp(email string) error {
+	code, body, err := c.do("POST", "/register", map[string]string{
+		"username": email,
+		"email":    email,
+		"password": "loadtest123",
+	})
+	if err != nil {
+		return err
+	}
+	if code == http.StatusTooManyRequests {
+		return fmt.Errorf("register returned %d: %s (run the server with RATE_LIMIT=false)", code, body)
+	}
+	if code != http.StatusCreated {
+		return fmt.Errorf("register returned %d: %s", code, body)
+	}
+
+	code, body, err = c.do("POST", "/login", map[string]string{
+		"email":    email,
+		"password": "loadtest123",
+	})
+	if err != nil {
+		return err
+	}
+	if code == http.StatusForbidden {
+		return fmt.Errorf("login returned %d: %s (run the server with REQUIRE_EMAIL_VERIFICATION=false)", code, body)
+	}
+	if code != http.StatusOK {
+		return fmt.Errorf("login returned %d: %s", code, body)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &login); err != nil {
+		return fmt.Errorf("failed to decode login response: %v", err)
+	}
+	c.token = login.Token
+	return nil
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "API server base URL")
+	users := flag.Int("users", 20, "number of concurrent customers")
+	duration := flag.Duration("duration", 30*time.Second, "how long to run")
+	productID := flag.Int64("product", 1, "product added to carts")
+	checkoutEvery := flag.Int("checkout-every", 3, "check out after this many cart adds (0 disables checkout)")
+	paymentMethod := flag.String("payment", "bank_transfer", "payment method used at checkout")
+	flag.Parse()
+
+	httpClient := &http.Client{Timeout: time.Minute}
+	run := time.Now().UnixNano()
+
+	clients := make([]*client, *users)
+	for i := range clients {
+		clients[i] = &client{baseURL: *baseURL, http: httpClient}
+		if err := clients[i].signUp(fmt.Sprintf("loadtest-%d-%d@example.com", run, i)); err != nil {
+			log.Fatalf("Failed to set up customer %d: %v", i, err)
+		}
+	}
+
+	address := map[string]string{
+		"full_name":    "Load Test",
+		"phone_number": "09171234567",
+		"address":      "1 Test Street",
+		"city":         "Makati",
+		"province":     "Metro Manila",
+		"postal_code":  "1200",
+	}
+
+	cartStats := newStats()
+	checkoutStats := newStats()
+
+	log.Printf("Running %d customers against %s for %v", *users, *baseURL, *duration)
+	start := time.Now()
+	deadline := start.Add(*duration)
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *client) {
+			defer wg.Done()
+			for adds := 1; time.Now().Before(deadline); adds++ {
+				t := time.Now()
+				code, _, err := c.do("POST", "/cart/add", map[string]interface{}{
+					"product_id": *productID,
+					"quantity":   1,
+				})
+				cartStats.record(code, time.Since(t), err)
+
+				if *checkoutEvery > 0 && adds%*checkoutEvery == 0 {
+					t = time.Now()
+					code, _, err = c.do("POST", "/checkout", map[string]interface{}{
+						"shipping_address": address,
+						"payment_method":   *paymentMethod,
+					})
+					checkoutStats.record(code, time.Since(t), err)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	fmt.Printf("\n%d customers, %v\n", *users, elapsed.Round(time.Millisecond))
+	cartStats.report("cart/add", elapsed)
+	if *checkoutEvery > 0 {
+		checkoutStats.report("checkout", elapsed)
+	}
+}
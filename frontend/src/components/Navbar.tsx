@@ -1,5 +1,6 @@
 import React, { useEffect, useState } from 'react';
 import { Link } from 'react-router-dom';
+import { logout } from '../services/api';
 import './Navbar.css';
 
 const Navbar: React.FC = () => {
@@ -29,8 +30,8 @@ const Navbar: React.FC = () => {
     };
   }, []);
   
-  const handleLogout = () => {
-    localStorage.removeItem('token');
+  const handleLogout = async () => {
+    await logout();
     setIsLoggedIn(false);
     window.location.href = '/';
   };
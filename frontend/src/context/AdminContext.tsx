@@ -1,6 +1,6 @@
 import React, { createContext, useContext, useState, useEffect, ReactNode } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { adminLogin } from '../services/admin-api';
+import { adminLogin, adminLogout } from '../services/admin-api';
 
 interface AdminUser {
   id: number;
@@ -103,8 +103,11 @@ export const AdminProvider: React.FC<AdminProviderProps> = ({ children }) => {
   };
 
   const logout = () => {
+    adminLogout();
     localStorage.removeItem('adminToken');
+    localStorage.removeItem('adminRefreshToken');
     localStorage.removeItem('adminUser');
+    localStorage.removeItem('adminPermissions');
     setIsAdmin(false);
     setAdminUser(null);
     navigate('/admin/login');
@@ -1,4 +1,4 @@
-import React, { useState, useEffect } from 'react';
+import React, { useState, useEffect, useRef } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { getCart, createOrder } from '../services/api';
 import './CheckoutPage.css';
@@ -35,6 +35,9 @@ const CheckoutPage: React.FC = () => {
   const [loading, setLoading] = useState(true);
   const [submitting, setSubmitting] = useState(false);
   const [error, setError] = useState<string | null>(null);
+  // Idempotency key for the current checkout attempt, reused on retry while the
+  // address and payment method are unchanged
+  const checkoutAttempt = useRef<{ payload: string; key: string } | null>(null);
   
   // Form state
   const [shippingAddress, setShippingAddress] = useState<ShippingAddress>({
@@ -172,8 +175,13 @@ const CheckoutPage: React.FC = () => {
       console.log('Submitting order with shipping address:', shippingAddress);
       console.log('Payment method:', paymentMethod);
       
+      const payload = JSON.stringify({ shippingAddress, paymentMethod });
+      if (!checkoutAttempt.current || checkoutAttempt.current.payload !== payload) {
+        checkoutAttempt.current = { payload, key: crypto.randomUUID() };
+      }
+      
       // Create order with the complete shipping address
-      const orderResponse = await createOrder(shippingAddress, paymentMethod);
+      const orderResponse = await createOrder(shippingAddress, paymentMethod, checkoutAttempt.current.key);
       
       // Clear the timeout since we got a response
       clearTimeout(timeoutId);
@@ -21,7 +21,11 @@ const LoginPage: React.FC = () => {
       window.location.href = '/';
     } catch (err) {
       console.error('Login failed:', err);
-      setError('Invalid email or password. Please try again.');
+      // Lockouts, rate limits and unverified accounts explain themselves
+      const message = err instanceof Error ? err.message : '';
+      setError(message && message !== 'Invalid credentials'
+        ? message
+        : 'Invalid email or password. Please try again.');
     } finally {
       setLoading(false);
     }
@@ -108,7 +108,7 @@ const RegisterPage: React.FC = () => {
         {error && <div className="error-message">{error}</div>}
         {success && (
           <div className="success-message">
-            Registration successful! Redirecting to login page...
+            Registration successful! Check your email for a link to verify your address, then log in.
           </div>
         )}
         
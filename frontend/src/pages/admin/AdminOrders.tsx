@@ -67,14 +67,20 @@ const AdminOrders: React.FC = () => {
   };
 
   const handleStatusChange = async (orderId: number, newStatus: string) => {
+    // The customer's shipping email includes the tracking number
+    let trackingNumber: string | undefined;
+    if (newStatus === 'shipped') {
+      trackingNumber = window.prompt(`Tracking number for order #${orderId} (optional)`)?.trim() || undefined;
+    }
+
     try {
       setUpdatingOrderId(orderId);
-      const response = await updateOrderStatus(orderId, newStatus);
+      const response = await updateOrderStatus(orderId, newStatus, trackingNumber);
       
       // Update order in state
       setOrders(orders.map(order => 
         order.order_id === orderId 
-          ? { ...order, status: newStatus } 
+          ? { ...order, status: newStatus, tracking_number: trackingNumber || order.tracking_number } 
           : order
       ));
       
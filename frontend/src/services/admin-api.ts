@@ -1,8 +1,30 @@
 // Admin API service for handling admin-specific API calls
 const API_URL = 'http://localhost:8080';
 
+// Exchange the admin refresh token for new tokens
+const refreshAdminSession = async (): Promise<boolean> => {
+  const refreshToken = localStorage.getItem('adminRefreshToken');
+  if (!refreshToken) return false;
+
+  try {
+    const response = await fetch(`${API_URL}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: refreshToken })
+    });
+    if (!response.ok) return false;
+
+    const data = await response.json();
+    localStorage.setItem('adminToken', data.token);
+    localStorage.setItem('adminRefreshToken', data.refresh_token);
+    return true;
+  } catch (e) {
+    return false;
+  }
+};
+
 // Create a reusable fetch function with admin authentication
-const fetchWithAdminAuth = async (endpoint: string, options: RequestInit = {}): Promise<any> => {
+const fetchWithAdminAuth = async (endpoint: string, options: RequestInit = {}, retried = false): Promise<any> => {
   const token = localStorage.getItem('adminToken');
   
   if (!token) {
@@ -31,11 +53,18 @@ const fetchWithAdminAuth = async (endpoint: string, options: RequestInit = {}):
     // Check if response is ok before trying to parse JSON
     if (!response.ok) {
       // Handle authentication errors
+      // Access tokens are short-lived: refresh once and retry
+      if (response.status === 401 && !retried && await refreshAdminSession()) {
+        return fetchWithAdminAuth(endpoint, options, true);
+      }
+
       if (response.status === 401 || response.status === 403) {
         console.error('Admin authentication failed or expired');
         // Clear invalid tokens
         localStorage.removeItem('adminToken');
+        localStorage.removeItem('adminRefreshToken');
         localStorage.removeItem('adminUser');
+        localStorage.removeItem('adminPermissions');
         // Redirect to login page
         window.location.href = '/admin/login';
         throw new Error('Authentication failed. Please log in again.');
@@ -103,10 +132,10 @@ export const deleteProduct = (id: number) =>
 // Orders
 export const getAdminOrders = () => fetchWithAdminAuth('/admin/orders');
 export const getAdminOrder = (id: number) => fetchWithAdminAuth(`/admin/orders/${id}`);
-export const updateOrderStatus = (id: number, status: string) => 
+export const updateOrderStatus = (id: number, status: string, trackingNumber?: string) => 
   fetchWithAdminAuth(`/admin/orders/${id}/status`, {
     method: 'PUT',
-    body: JSON.stringify({ status })
+    body: JSON.stringify({ status, tracking_number: trackingNumber })
   });
 export const verifyPayment = (id: number, reference: string) => 
   fetchWithAdminAuth(`/admin/orders/${id}/verify`, {
@@ -114,8 +143,24 @@ export const verifyPayment = (id: number, reference: string) =>
     body: JSON.stringify({ reference })
   });
 
-// Users
+// Users, roles and permissions
 export const getAdminUsers = () => fetchWithAdminAuth('/admin/users');
+export const getRoles = () => fetchWithAdminAuth('/admin/roles');
+export const getPermissions = () => fetchWithAdminAuth('/admin/permissions');
+export const createRole = (role: { name: string; description: string; permissions: string[] }) =>
+  fetchWithAdminAuth('/admin/roles', {
+    method: 'POST',
+    body: JSON.stringify(role)
+  });
+export const updateRole = (name: string, role: { description: string; permissions: string[] }) =>
+  fetchWithAdminAuth(`/admin/roles/${name}`, {
+    method: 'PUT',
+    body: JSON.stringify(role)
+  });
+export const deleteRole = (name: string) =>
+  fetchWithAdminAuth(`/admin/roles/${name}`, {
+    method: 'DELETE'
+  });
 export const updateUserRole = (id: number, role: string) => 
   fetchWithAdminAuth(`/admin/users/${id}/role`, {
     method: 'PUT',
@@ -147,11 +192,29 @@ export const adminLogin = (email: string, password: string) =>
     return response.json();
   })
   .then(data => {
-    if (data.user && data.user.role === 'admin' && data.token) {
+    // Any staff role with at least one permission can use the admin area
+    if (data.user && data.permissions && data.permissions.length > 0 && data.token) {
       localStorage.setItem('adminToken', data.token);
+      localStorage.setItem('adminRefreshToken', data.refresh_token);
       localStorage.setItem('adminUser', JSON.stringify(data.user));
+      localStorage.setItem('adminPermissions', JSON.stringify(data.permissions));
       return data;
     } else {
       throw new Error('Not authorized as admin');
     }
-  }); 
\ No newline at end of file
+  }); 
+
+// Admin logout: revoke the session on the server
+export const adminLogout = async () => {
+  const token = localStorage.getItem('adminToken');
+  if (!token) return;
+
+  try {
+    await fetch(`${API_URL}/auth/logout`, {
+      method: 'POST',
+      headers: { 'Authorization': `Bearer ${token}` }
+    });
+  } catch (e) {
+    console.error('Admin logout request failed:', e);
+  }
+};
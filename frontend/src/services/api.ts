@@ -1,8 +1,51 @@
 // Simplify the API service with consistent patterns
 const API_URL = 'http://localhost:8080';
 
+// Store the tokens returned by login and refresh
+const saveTokens = (data: any) => {
+  if (data.token) {
+    localStorage.setItem('token', data.token);
+  }
+  if (data.refresh_token) {
+    localStorage.setItem('refreshToken', data.refresh_token);
+  }
+};
+
+const clearTokens = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
+};
+
+// Exchange the refresh token for new tokens; concurrent callers share one request
+let refreshing: Promise<boolean> | null = null;
+export const refreshSession = (): Promise<boolean> => {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) return Promise.resolve(false);
+
+  if (!refreshing) {
+    refreshing = fetch(`${API_URL}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: refreshToken })
+    })
+      .then(async response => {
+        if (!response.ok) {
+          clearTokens();
+          return false;
+        }
+        saveTokens(await response.json());
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
 // Create a reusable fetch function to reduce duplication
-const fetchWithAuth = async (endpoint: string, options: RequestInit = {}): Promise<any> => {
+const fetchWithAuth = async (endpoint: string, options: RequestInit = {}, retried = false): Promise<any> => {
   const token = localStorage.getItem('token');
   
   // Create headers object properly
@@ -17,6 +60,11 @@ const fetchWithAuth = async (endpoint: string, options: RequestInit = {}): Promi
     ...options,
     headers
   });
+
+  // The access token is short-lived: refresh it once and retry
+  if (response.status === 401 && token && !retried && await refreshSession()) {
+    return fetchWithAuth(endpoint, options, true);
+  }
   
   // Parse JSON response (or return empty object if it fails)
   let data = {};
@@ -44,17 +92,51 @@ export const login = (email: string, password: string) =>
     method: 'POST',
     body: JSON.stringify({ email, password })
   }).then(data => {
-    if (data.token) {
-      localStorage.setItem('token', data.token);
-    }
+    saveTokens(data);
     return data;
   });
 
+// Revoke the session on the server, then forget its tokens
+export const logout = async (allDevices: boolean = false) => {
+  try {
+    await fetchWithAuth(allDevices ? '/auth/logout-all' : '/auth/logout', { method: 'POST' });
+  } catch (error) {
+    console.error('Error logging out:', error);
+  } finally {
+    clearTokens();
+  }
+};
+
 export const register = (userData: { username: string; email: string; password: string }) => 
   fetchWithAuth('/register', {
     method: 'POST',
     body: JSON.stringify(userData)
   });
+
+// Email verification and password reset, using the token from an emailed link
+export const verifyEmail = (token: string) =>
+  fetchWithAuth('/auth/verify-email', {
+    method: 'POST',
+    body: JSON.stringify({ token })
+  });
+
+export const resendVerification = (email: string) =>
+  fetchWithAuth('/auth/resend-verification', {
+    method: 'POST',
+    body: JSON.stringify({ email })
+  });
+
+export const forgotPassword = (email: string) =>
+  fetchWithAuth('/auth/forgot-password', {
+    method: 'POST',
+    body: JSON.stringify({ email })
+  });
+
+export const resetPassword = (token: string, password: string) =>
+  fetchWithAuth('/auth/reset-password', {
+    method: 'POST',
+    body: JSON.stringify({ token, password })
+  });
   
 // Cart API
 export const getCart = () => fetchWithAuth('/cart');
@@ -186,7 +268,7 @@ export const createOrder = async (shippingAddress: {
   city: string;
   province: string;
   postal_code: string;
-}, paymentMethod: string) => {
+}, paymentMethod: string, idempotencyKey: string) => {
   try {
     console.log('Creating order with:', { shippingAddress, paymentMethod });
     
@@ -198,7 +280,9 @@ export const createOrder = async (shippingAddress: {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
-        'Authorization': `Bearer ${localStorage.getItem('token')}`
+        'Authorization': `Bearer ${localStorage.getItem('token')}`,
+        // Retrying with the same key replays the first order instead of placing a second one
+        'Idempotency-Key': idempotencyKey
       },
       body: JSON.stringify({
         shipping_address: shippingAddress,
@@ -0,0 +1,36 @@
+// Package authtest mints access tokens for tests. The server never imports
+// it, so it is not part of the production binary.
+//
+// Minted tokens are ordinary tokens: they are signed with the active key and
+// backed by a session row, exactly like tokens returned by /login, so they
+// pass through the full AuthMiddleware checks and can be revoked. Nothing in
+// this package changes how requests are authenticated.
+package authtest
+
+import (
+	"context"
+	"fmt"
+
+	"go_module/internal/middleware"
+	"go_module/internal/models"
+)
+
+// MintToken starts a session for an existing user without their password and
+// returns an access token for it. The token carries the user's current role.
+func MintToken(ctx context.Context, userID int64) (string, error) {
+	user, err := models.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	session, _, err := models.CreateSession(ctx, user.UserID, "authtest", "127.0.0.1")
+	if err != nil {
+		return "", err
+	}
+
+	token, err := middleware.GenerateToken(user.UserID, user.Role, session.SessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to mint token: %v", err)
+	}
+	return token, nil
+}
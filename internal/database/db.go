@@ -1,76 +1,109 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"database/sql/driver"
+	"go_module/internal/logging"
+	"log/slog"
 	"math/rand"
 	"os"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/mattn/go-sqlite3"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// DB is the single writer connection. Use it for writes, through WithTx
+// for transactions.
 var DB *sql.DB
 
+// ReadDB is a pool of read-only connections for queries outside transactions
+var ReadDB *sql.DB
+
+// readPoolSize is the number of concurrent read connections
+const readPoolSize = 8
+
+// traceOptions make both connections start a span for every statement,
+// transaction begin and commit, recording the SQL with its placeholders but
+// not the arguments. Statements run outside a traced request or model call,
+// such as the background pollers', are not traced.
+var traceOptions = []otelsql.Option{
+	otelsql.WithAttributes(semconv.DBSystemSqlite),
+	otelsql.WithSpanOptions(otelsql.SpanOptions{
+		DisableErrSkip:       true,
+		OmitConnResetSession: true,
+		OmitConnectorConnect: true,
+		OmitRows:             true,
+		SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+			return trace.SpanContextFromContext(ctx).IsValid()
+		},
+	}),
+}
+
 func InitDB() {
-	log.Println("Initializing database...")
+	slog.Info("Initializing database")
 
 	// Seed the random number generator
 	rand.Seed(time.Now().UnixNano())
 
 	// Create database directory
 	if err := os.MkdirAll("./data", 0755); err != nil {
-		log.Fatal("Failed to create database directory:", err)
+		logging.Fatal("Failed to create database directory", "error", err)
 	}
 
 	// Check if database file exists and is valid
 	checkDatabaseFile()
 
-	// Open database with improved concurrency settings
-	// WAL mode provides better concurrency
-	// busy_timeout sets how long to wait when the database is locked
+	// SQLite allows one writer at a time, so writes share a single connection
+	// instead of a pool whose connections would queue on the file lock.
+	// _txlock=immediate makes every transaction take the write lock at BEGIN;
+	// WithTx retries when another process holds it, so the busy timeout only
+	// needs to cover short waits.
 	var err error
-	DB, err = sql.Open("sqlite3", "./data/lab.db?_journal=WAL&_busy_timeout=30000&_foreign_keys=on&_timeout=30000&cache=shared")
+	DB, err = otelsql.Open("sqlite3", "file:./data/lab.db?_journal=WAL&_busy_timeout=1000&_foreign_keys=on&_txlock=immediate", traceOptions...)
 	if err != nil {
-		log.Fatal("Failed to open database:", err)
+		logging.Fatal("Failed to open database", "error", err)
 	}
-
-	// Configure connection pool
-	// SQLite works best with limited connections but we need enough for concurrent operations
-	DB.SetMaxOpenConns(10) // Increase from 1 to allow more concurrent operations
-	DB.SetMaxIdleConns(5)  // Keep more idle connections ready
+	DB.SetMaxOpenConns(1)
+	DB.SetMaxIdleConns(1)
 	DB.SetConnMaxLifetime(time.Hour)
 
 	// Test connection
 	if err = DB.Ping(); err != nil {
-		log.Fatal("Failed to ping database:", err)
+		logging.Fatal("Failed to ping database", "error", err)
 	}
 
-	// Enable extended error logging for development
-	_, err = DB.Exec("PRAGMA foreign_keys = ON")
-	if err != nil {
-		log.Printf("Warning: Failed to enable foreign keys: %v", err)
-	}
-
-	// Set busy timeout at the connection level as well
-	_, err = DB.Exec("PRAGMA busy_timeout = 30000")
-	if err != nil {
-		log.Printf("Warning: Failed to set busy timeout: %v", err)
-	}
-
-	// Set journal mode to WAL for better concurrency
+	// Set journal mode to WAL so readers never wait for the writer
 	_, err = DB.Exec("PRAGMA journal_mode = WAL")
 	if err != nil {
-		log.Printf("Warning: Failed to set journal mode: %v", err)
+		slog.Warn("Failed to set journal mode", "error", err)
 	}
 
 	// Create tables
 	createTables()
 
+	// Add columns introduced after the original schema
+	migrateColumns()
+
 	// Insert test data
 	insertTestData()
 
-	log.Println("Database initialized successfully")
+	// Reads use their own read-only pool
+	ReadDB, err = otelsql.Open("sqlite3", "file:./data/lab.db?mode=ro&_busy_timeout=1000&_foreign_keys=on", traceOptions...)
+	if err != nil {
+		logging.Fatal("Failed to open read-only database", "error", err)
+	}
+	ReadDB.SetMaxOpenConns(readPoolSize)
+	ReadDB.SetMaxIdleConns(readPoolSize)
+	ReadDB.SetConnMaxLifetime(time.Hour)
+	if err = ReadDB.Ping(); err != nil {
+		logging.Fatal("Failed to ping read-only database", "error", err)
+	}
+
+	slog.Info("Database initialized successfully")
 }
 
 func createTables() {
@@ -83,7 +116,10 @@ func createTables() {
 			Password TEXT NOT NULL,
 			Role TEXT NOT NULL DEFAULT 'customer',
 			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
-			LastLogin TEXT
+			LastLogin TEXT,
+			EmailVerified BOOLEAN NOT NULL DEFAULT 0,
+			FailedLogins INTEGER NOT NULL DEFAULT 0,
+			LockedUntil TEXT
 		)`,
 		`CREATE TABLE IF NOT EXISTS products (
 			ProductID INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -136,16 +172,316 @@ func createTables() {
 			OrderID INTEGER NOT NULL,
 			OldStatus TEXT NOT NULL,
 			NewStatus TEXT NOT NULL,
+			ChangedBy INTEGER,
 			ChangedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			FOREIGN KEY (OrderID) REFERENCES orders(OrderID),
+			FOREIGN KEY (ChangedBy) REFERENCES users(UserID)
+		)`,
+		`CREATE TABLE IF NOT EXISTS addresses (
+			AddressID INTEGER PRIMARY KEY AUTOINCREMENT,
+			UserID INTEGER NOT NULL,
+			Label TEXT,
+			FullName TEXT NOT NULL,
+			PhoneNumber TEXT NOT NULL,
+			AddressLine TEXT NOT NULL,
+			City TEXT NOT NULL,
+			Province TEXT NOT NULL,
+			PostalCode TEXT NOT NULL,
+			IsDefault BOOLEAN NOT NULL DEFAULT 0,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			UpdatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			FOREIGN KEY (UserID) REFERENCES users(UserID)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_addresses_user ON addresses(UserID)`,
+		`CREATE TABLE IF NOT EXISTS payments (
+			PaymentID INTEGER PRIMARY KEY AUTOINCREMENT,
+			OrderID INTEGER NOT NULL,
+			Provider TEXT NOT NULL,
+			Method TEXT NOT NULL,
+			Attempt INTEGER NOT NULL DEFAULT 1,
+			Amount REAL NOT NULL,
+			Currency TEXT NOT NULL DEFAULT 'PHP',
+			Status TEXT NOT NULL DEFAULT 'pending',
+			ProviderRef TEXT,
+			CheckoutURL TEXT,
+			FailureReason TEXT,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			UpdatedAt TEXT NOT NULL DEFAULT (datetime('now')),
 			FOREIGN KEY (OrderID) REFERENCES orders(OrderID)
 		)`,
+		`CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(OrderID)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_provider_ref ON payments(Provider, ProviderRef)`,
+		`CREATE TABLE IF NOT EXISTS payment_events (
+			EventRowID INTEGER PRIMARY KEY AUTOINCREMENT,
+			PaymentID INTEGER NOT NULL,
+			Provider TEXT NOT NULL,
+			EventID TEXT NOT NULL,
+			Type TEXT NOT NULL,
+			ReceivedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			UNIQUE (Provider, EventID),
+			FOREIGN KEY (PaymentID) REFERENCES payments(PaymentID)
+		)`,
+		`CREATE TABLE IF NOT EXISTS payment_proofs (
+			ProofID INTEGER PRIMARY KEY AUTOINCREMENT,
+			OrderID INTEGER NOT NULL,
+			UserID INTEGER NOT NULL,
+			Reference TEXT NOT NULL,
+			ImagePath TEXT NOT NULL,
+			ContentType TEXT NOT NULL,
+			Status TEXT NOT NULL DEFAULT 'pending',
+			RejectionReason TEXT,
+			ReviewedBy INTEGER,
+			ReviewedAt TEXT,
+			SubmittedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			FOREIGN KEY (OrderID) REFERENCES orders(OrderID),
+			FOREIGN KEY (UserID) REFERENCES users(UserID),
+			FOREIGN KEY (ReviewedBy) REFERENCES users(UserID)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_proofs_order ON payment_proofs(OrderID)`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_proofs_status ON payment_proofs(Status)`,
+		`CREATE TABLE IF NOT EXISTS refunds (
+			RefundID INTEGER PRIMARY KEY AUTOINCREMENT,
+			OrderID INTEGER NOT NULL,
+			Amount REAL NOT NULL,
+			Reason TEXT NOT NULL,
+			Method TEXT NOT NULL,
+			Status TEXT NOT NULL DEFAULT 'completed',
+			Restock BOOLEAN NOT NULL DEFAULT 0,
+			ProviderRef TEXT,
+			FailureReason TEXT,
+			IssuedBy INTEGER NOT NULL,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			CompletedAt TEXT,
+			FOREIGN KEY (OrderID) REFERENCES orders(OrderID),
+			FOREIGN KEY (IssuedBy) REFERENCES users(UserID)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_refunds_order ON refunds(OrderID)`,
+		`CREATE TABLE IF NOT EXISTS refund_items (
+			RefundItemID INTEGER PRIMARY KEY AUTOINCREMENT,
+			RefundID INTEGER NOT NULL,
+			OrderDetailID INTEGER NOT NULL,
+			Quantity INTEGER NOT NULL,
+			Amount REAL NOT NULL,
+			FOREIGN KEY (RefundID) REFERENCES refunds(RefundID),
+			FOREIGN KEY (OrderDetailID) REFERENCES order_details(OrderDetailID)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_refund_items_refund ON refund_items(RefundID)`,
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			UserID INTEGER NOT NULL,
+			IdemKey TEXT NOT NULL,
+			Method TEXT NOT NULL,
+			Path TEXT NOT NULL,
+			Fingerprint TEXT NOT NULL,
+			Status TEXT NOT NULL DEFAULT 'processing',
+			ResponseCode INTEGER,
+			ContentType TEXT,
+			ResponseBody BLOB,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (UserID, IdemKey)
+		)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			SessionID INTEGER PRIMARY KEY AUTOINCREMENT,
+			UserID INTEGER NOT NULL,
+			TokenHash TEXT NOT NULL UNIQUE,
+			PreviousHash TEXT,
+			UserAgent TEXT,
+			IPAddress TEXT,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			LastUsedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			ExpiresAt TEXT NOT NULL,
+			RevokedAt TEXT,
+			FOREIGN KEY (UserID) REFERENCES users(UserID)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(UserID)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_previous_hash ON sessions(PreviousHash)`,
+		`CREATE TABLE IF NOT EXISTS roles (
+			Name TEXT PRIMARY KEY,
+			Description TEXT,
+			BuiltIn BOOLEAN NOT NULL DEFAULT 0,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now'))
+		)`,
+		`CREATE TABLE IF NOT EXISTS role_permissions (
+			Role TEXT NOT NULL,
+			Permission TEXT NOT NULL,
+			PRIMARY KEY (Role, Permission),
+			FOREIGN KEY (Role) REFERENCES roles(Name)
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_tokens (
+			TokenHash TEXT PRIMARY KEY,
+			UserID INTEGER NOT NULL,
+			Purpose TEXT NOT NULL,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			ExpiresAt TEXT NOT NULL,
+			UsedAt TEXT,
+			FOREIGN KEY (UserID) REFERENCES users(UserID)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens(UserID, Purpose)`,
+		`CREATE TABLE IF NOT EXISTS domain_events (
+			EventID INTEGER PRIMARY KEY AUTOINCREMENT,
+			Type TEXT NOT NULL,
+			Payload TEXT NOT NULL,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now'))
+		)`,
+		`CREATE TABLE IF NOT EXISTS event_deliveries (
+			EventID INTEGER NOT NULL,
+			Subscriber TEXT NOT NULL,
+			Status TEXT NOT NULL DEFAULT 'pending',
+			Attempts INTEGER NOT NULL DEFAULT 0,
+			NextAttemptAt TEXT NOT NULL DEFAULT (datetime('now')),
+			LastError TEXT,
+			DeliveredAt TEXT,
+			PRIMARY KEY (EventID, Subscriber),
+			FOREIGN KEY (EventID) REFERENCES domain_events(EventID)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_event_deliveries_due ON event_deliveries(Status, NextAttemptAt)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			AuditID INTEGER PRIMARY KEY AUTOINCREMENT,
+			ActorID INTEGER,
+			Action TEXT NOT NULL,
+			TargetType TEXT,
+			TargetID TEXT,
+			Before TEXT,
+			After TEXT,
+			Details TEXT,
+			IPAddress TEXT,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			FOREIGN KEY (ActorID) REFERENCES users(UserID)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(TargetType, TargetID)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(ActorID)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(Action)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(CreatedAt)`,
+		// The audit log is append-only
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			WebhookID INTEGER PRIMARY KEY AUTOINCREMENT,
+			URL TEXT NOT NULL,
+			Description TEXT,
+			Events TEXT NOT NULL,
+			Secret TEXT NOT NULL,
+			Active BOOLEAN NOT NULL DEFAULT 1,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			UpdatedAt TEXT NOT NULL DEFAULT (datetime('now'))
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			DeliveryID INTEGER PRIMARY KEY AUTOINCREMENT,
+			WebhookID INTEGER NOT NULL,
+			EventID INTEGER,
+			EventType TEXT NOT NULL,
+			Payload TEXT NOT NULL,
+			Status TEXT NOT NULL DEFAULT 'pending',
+			Attempts INTEGER NOT NULL DEFAULT 0,
+			NextAttemptAt TEXT NOT NULL DEFAULT (datetime('now')),
+			ResponseStatus INTEGER,
+			ResponseBody TEXT,
+			LastError TEXT,
+			DurationMs INTEGER,
+			ReplayOf INTEGER,
+			CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+			DeliveredAt TEXT,
+			FOREIGN KEY (WebhookID) REFERENCES webhooks(WebhookID),
+			FOREIGN KEY (EventID) REFERENCES domain_events(EventID),
+			FOREIGN KEY (ReplayOf) REFERENCES webhook_deliveries(DeliveryID)
+		)`,
+		// An event is queued once per webhook; replays are extra deliveries
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries(WebhookID, EventID) WHERE ReplayOf IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(Status, NextAttemptAt)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(WebhookID, DeliveryID)`,
+		// Order emails now go through domain_events; emails still unsent in
+		// the old outbox are not carried over
+		`DROP TABLE IF EXISTS email_outbox`,
 	}
 
 	for _, table := range tables {
 		if _, err := DB.Exec(table); err != nil {
-			log.Fatal("Failed to create table:", err)
+			logging.Fatal("Failed to create table", "error", err)
+		}
+	}
+}
+
+// columnMigrations lists columns added to existing tables after the original
+// schema. CREATE TABLE IF NOT EXISTS leaves older database files untouched, so
+// these are applied with ALTER TABLE whenever the column is missing.
+// An optional backfill statement runs once, right after the column is added.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+	backfill   string
+}{
+	{"products", "WeightKg", "REAL NOT NULL DEFAULT 0.25", ""},
+	{"orders", "Subtotal", "REAL NOT NULL DEFAULT 0", "UPDATE orders SET Subtotal = TotalAmount"},
+	{"orders", "ShippingFee", "REAL NOT NULL DEFAULT 0", ""},
+	{"orders", "ShippingZone", "TEXT", ""},
+	{"products", "TaxClass", "TEXT NOT NULL DEFAULT 'standard'", ""},
+	{"orders", "VatableSales", "REAL NOT NULL DEFAULT 0", "UPDATE orders SET VatableSales = ROUND(TotalAmount / 1.12, 2)"},
+	{"orders", "VatExemptSales", "REAL NOT NULL DEFAULT 0", ""},
+	{"orders", "ZeroRatedSales", "REAL NOT NULL DEFAULT 0", ""},
+	{"orders", "TaxAmount", "REAL NOT NULL DEFAULT 0", "UPDATE orders SET TaxAmount = ROUND(TotalAmount - TotalAmount / 1.12, 2)"},
+	{"orders", "PricesIncludeTax", "BOOLEAN NOT NULL DEFAULT 1", ""},
+	{"order_details", "TaxClass", "TEXT NOT NULL DEFAULT 'standard'", ""},
+	{"order_details", "TaxRate", "REAL NOT NULL DEFAULT 0", "UPDATE order_details SET TaxRate = 0.12"},
+	{"orders", "ShipFullName", "TEXT", ""},
+	{"orders", "ShipPhoneNumber", "TEXT", ""},
+	{"orders", "ShipAddressLine", "TEXT", ""},
+	{"orders", "ShipCity", "TEXT", ""},
+	{"orders", "ShipProvince", "TEXT", ""},
+	{"orders", "ShipPostalCode", "TEXT", ""},
+	{"order_details", "TaxAmount", "REAL NOT NULL DEFAULT 0", "UPDATE order_details SET TaxAmount = ROUND(Price * Quantity - Price * Quantity / 1.12, 2)"},
+	{"orders", "RefundStatus", "TEXT NOT NULL DEFAULT 'none'", ""},
+	{"orders", "RefundedAmount", "REAL NOT NULL DEFAULT 0", ""},
+	{"users", "EmailVerified", "BOOLEAN NOT NULL DEFAULT 0", "UPDATE users SET EmailVerified = 1"},
+	{"users", "FailedLogins", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"users", "LockedUntil", "TEXT", ""},
+	{"audit_log", "Before", "TEXT", ""},
+	{"audit_log", "After", "TEXT", ""},
+	{"order_history", "ChangedBy", "INTEGER REFERENCES users(UserID)", ""},
+}
+
+func migrateColumns() {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(m.table, m.column)
+		if err != nil {
+			logging.Fatal("Failed to inspect table", "table", m.table, "error", err)
+		}
+		if exists {
+			continue
+		}
+
+		slog.Info("Adding column", "table", m.table, "column", m.column)
+		if _, err := DB.Exec("ALTER TABLE " + m.table + " ADD COLUMN " + m.column + " " + m.definition); err != nil {
+			logging.Fatal("Failed to add column", "table", m.table, "column", m.column, "error", err)
+		}
+
+		if m.backfill != "" {
+			if _, err := DB.Exec(m.backfill); err != nil {
+				slog.Warn("Failed to backfill column", "table", m.table, "column", m.column, "error", err)
+			}
+		}
+	}
+}
+
+// columnExists reports whether a table already has the named column
+func columnExists(table, column string) (bool, error) {
+	rows, err := DB.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
 		}
 	}
+	return false, rows.Err()
 }
 
 func insertTestData() {
@@ -190,7 +526,7 @@ func insertTestData() {
 		`, p.imageURL, p.name)
 
 		if err != nil {
-			log.Printf("Warning: Failed to update image URL for %s: %v", p.name, err)
+			slog.Warn("Failed to update image URL of test product", "product", p.name, "error", err)
 		}
 	}
 
@@ -204,7 +540,7 @@ func insertTestData() {
 		`, p.name, p.description, p.price, p.imageURL, p.stock, p.name)
 
 		if err != nil {
-			log.Printf("Warning: Failed to insert test product %s: %v", p.name, err)
+			slog.Warn("Failed to insert test product", "product", p.name, "error", err)
 		}
 	}
 
@@ -214,15 +550,15 @@ func insertTestData() {
 		DELETE FROM users WHERE Email = 'admin@example.com'
 	`)
 	if err != nil {
-		log.Printf("Warning: Failed to delete existing admin user: %v", err)
+		slog.Warn("Failed to delete existing admin user", "error", err)
 	}
 
 	_, err = DB.Exec(`
-		INSERT INTO users (Username, Email, Password, Role)
-		VALUES ('admin', 'admin@example.com', 'admin123', 'admin')
+		INSERT INTO users (Username, Email, Password, Role, EmailVerified)
+		VALUES ('admin', 'admin@example.com', 'admin123', 'admin', 1)
 	`)
 	if err != nil {
-		log.Printf("Warning: Failed to insert test admin user: %v", err)
+		slog.Warn("Failed to insert test admin user", "error", err)
 	}
 
 	// Insert test customer users
@@ -240,17 +576,17 @@ func insertTestData() {
 		// Delete existing user first
 		_, err = DB.Exec(`DELETE FROM users WHERE Email = ?`, u.email)
 		if err != nil {
-			log.Printf("Warning: Failed to delete existing user %s: %v", u.username, err)
+			slog.Warn("Failed to delete existing test user", "username", u.username, "error", err)
 		}
 
 		// Insert user
 		_, err = DB.Exec(`
-			INSERT INTO users (Username, Email, Password, Role)
-			VALUES (?, ?, ?, 'customer')
+			INSERT INTO users (Username, Email, Password, Role, EmailVerified)
+			VALUES (?, ?, ?, 'customer', 1)
 		`, u.username, u.email, u.password)
 
 		if err != nil {
-			log.Printf("Warning: Failed to insert test user %s: %v", u.username, err)
+			slog.Warn("Failed to insert test user", "username", u.username, "error", err)
 		}
 	}
 
@@ -258,9 +594,9 @@ func insertTestData() {
 	count := 0
 	err = DB.QueryRow("SELECT COUNT(*) FROM products").Scan(&count)
 	if err != nil {
-		log.Printf("Warning: Failed to count products: %v", err)
+		slog.Warn("Failed to count products", "error", err)
 	}
-	log.Printf("Number of products in database: %d", count)
+	slog.Info("Products in database", "count", count)
 
 	// Create test orders for each user
 	createTestOrders()
@@ -272,13 +608,13 @@ func createTestOrders() {
 	var user1ID, user2ID int64
 	err := DB.QueryRow("SELECT UserID FROM users WHERE Email = 'user1@example.com'").Scan(&user1ID)
 	if err != nil {
-		log.Printf("Warning: Failed to get user1 ID: %v", err)
+		slog.Warn("Failed to get user1 ID", "error", err)
 		return
 	}
 
 	err = DB.QueryRow("SELECT UserID FROM users WHERE Email = 'user2@example.com'").Scan(&user2ID)
 	if err != nil {
-		log.Printf("Warning: Failed to get user2 ID: %v", err)
+		slog.Warn("Failed to get user2 ID", "error", err)
 		return
 	}
 
@@ -297,7 +633,7 @@ func createTestOrder(userID int64, address, paymentMethod string, amount float64
 	var orderCount int
 	err := DB.QueryRow("SELECT COUNT(*) FROM orders WHERE UserID = ?", userID).Scan(&orderCount)
 	if err != nil {
-		log.Printf("Warning: Failed to check user orders: %v", err)
+		slog.Warn("Failed to check user orders", "error", err)
 		return
 	}
 
@@ -309,19 +645,19 @@ func createTestOrder(userID int64, address, paymentMethod string, amount float64
 	// Insert order
 	result, err := DB.Exec(`
 		INSERT INTO orders (
-			UserID, ShippingAddress, PaymentMethod, TotalAmount, 
+			UserID, ShippingAddress, PaymentMethod, Subtotal, TotalAmount, 
 			Status, CreatedAt, PaymentVerified
-		) VALUES (?, ?, ?, ?, ?, datetime('now', '-' || ? || ' days'), ?)
-	`, userID, address, paymentMethod, amount, status, rand.Intn(30), paymentMethod != "bank_transfer")
+		) VALUES (?, ?, ?, ?, ?, ?, datetime('now', '-' || ? || ' days'), ?)
+	`, userID, address, paymentMethod, amount, amount, status, rand.Intn(30), paymentMethod != "bank_transfer")
 
 	if err != nil {
-		log.Printf("Warning: Failed to create test order: %v", err)
+		slog.Warn("Failed to create test order", "error", err)
 		return
 	}
 
 	orderID, err := result.LastInsertId()
 	if err != nil {
-		log.Printf("Warning: Failed to get order ID: %v", err)
+		slog.Warn("Failed to get order ID", "error", err)
 		return
 	}
 
@@ -331,7 +667,7 @@ func createTestOrder(userID int64, address, paymentMethod string, amount float64
 	var productName string
 	err = DB.QueryRow("SELECT ProductID, Price, Name FROM products ORDER BY RANDOM() LIMIT 1").Scan(&productID, &productPrice, &productName)
 	if err != nil {
-		log.Printf("Warning: Failed to get random product: %v", err)
+		slog.Warn("Failed to get random product", "error", err)
 		return
 	}
 
@@ -347,11 +683,11 @@ func createTestOrder(userID int64, address, paymentMethod string, amount float64
 	`, orderID, productID, quantity, productPrice)
 
 	if err != nil {
-		log.Printf("Warning: Failed to create test order details: %v", err)
+		slog.Warn("Failed to create test order details", "error", err)
 		return
 	}
 
-	log.Printf("Created test order #%d for user %d with status %s", orderID, userID, status)
+	slog.Info("Created test order", "order_id", orderID, "user_id", userID, "status", status)
 }
 
 // Check if database file exists and is valid
@@ -361,15 +697,15 @@ func checkDatabaseFile() {
 	// Check if file exists
 	_, err := os.Stat(dbPath)
 	if os.IsNotExist(err) {
-		log.Println("Database file does not exist, will create a new one")
+		slog.Info("Database file does not exist, will create a new one")
 		return
 	}
 
 	// Try to open the database to check if it's valid
 	testDB, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
-		log.Printf("Warning: Failed to open existing database: %v", err)
-		log.Println("Removing corrupted database file...")
+		slog.Warn("Failed to open existing database", "error", err)
+		slog.Info("Removing corrupted database file")
 		os.Remove(dbPath)
 		return
 	}
@@ -377,14 +713,14 @@ func checkDatabaseFile() {
 	// Try to ping the database
 	err = testDB.Ping()
 	if err != nil {
-		log.Printf("Warning: Failed to ping existing database: %v", err)
+		slog.Warn("Failed to ping existing database", "error", err)
 		testDB.Close()
-		log.Println("Removing corrupted database file...")
+		slog.Info("Removing corrupted database file")
 		os.Remove(dbPath)
 		return
 	}
 
 	// Close the test connection
 	testDB.Close()
-	log.Println("Existing database file is valid")
+	slog.Info("Existing database file is valid")
 }
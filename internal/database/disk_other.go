@@ -0,0 +1,10 @@
+//go:build !unix
+
+package database
+
+import "errors"
+
+// FreeDiskBytes is only implemented on Unix systems
+func FreeDiskBytes() (uint64, error) {
+	return 0, errors.New("free disk space is not supported on this platform")
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package database
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FreeDiskBytes returns the space available to the server on the file
+// system holding DataDir
+func FreeDiskBytes() (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(DataDir, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat data directory: %v", err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
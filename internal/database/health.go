@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// DataDir is the directory holding the database file and uploads
+const DataDir = "./data"
+
+// Ping checks that both the writer connection and the read pool answer
+func Ping(ctx context.Context) error {
+	if err := DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %v", err)
+	}
+	if err := ReadDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping read-only database: %v", err)
+	}
+	return nil
+}
+
+// PendingMigrations lists the columnMigrations, as table.column, that are
+// missing from the database. InitDB stops the server when one can't be
+// applied, so this is only non-empty if the file was replaced or altered
+// underneath a running server.
+func PendingMigrations(ctx context.Context) ([]string, error) {
+	var pending []string
+	for _, m := range columnMigrations {
+		var n int
+		err := ReadDB.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", m.table, m.column,
+		).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect table %s: %v", m.table, err)
+		}
+		if n == 0 {
+			pending = append(pending, m.table+"."+m.column)
+		}
+	}
+	return pending, nil
+}
@@ -6,7 +6,10 @@ CREATE TABLE users (
     Password TEXT NOT NULL,
     Role TEXT DEFAULT 'customer',
     CreatedAt TEXT DEFAULT (datetime('now')),
-    LastLogin TEXT
+    LastLogin TEXT,
+    EmailVerified BOOLEAN NOT NULL DEFAULT 0,
+    FailedLogins INTEGER NOT NULL DEFAULT 0, -- wrong passwords in a row
+    LockedUntil TEXT -- login refused until then
 );
 
 -- Products table
@@ -17,6 +20,8 @@ CREATE TABLE products (
     Price REAL NOT NULL,
     ImageURL TEXT,
     Stock INTEGER NOT NULL DEFAULT 0,
+    WeightKg REAL NOT NULL DEFAULT 0.25,
+    TaxClass TEXT NOT NULL DEFAULT 'standard',
     CreatedAt TEXT DEFAULT (datetime('now'))
 );
 
@@ -27,11 +32,27 @@ CREATE TABLE orders (
     Status TEXT NOT NULL DEFAULT 'pending',
     ShippingAddress TEXT NOT NULL,
     PaymentMethod TEXT NOT NULL,
+    Subtotal REAL NOT NULL DEFAULT 0,
+    ShippingFee REAL NOT NULL DEFAULT 0,
+    ShippingZone TEXT,
+    VatableSales REAL NOT NULL DEFAULT 0,
+    VatExemptSales REAL NOT NULL DEFAULT 0,
+    ZeroRatedSales REAL NOT NULL DEFAULT 0,
+    TaxAmount REAL NOT NULL DEFAULT 0,
+    PricesIncludeTax BOOLEAN NOT NULL DEFAULT 1,
+    ShipFullName TEXT,
+    ShipPhoneNumber TEXT,
+    ShipAddressLine TEXT,
+    ShipCity TEXT,
+    ShipProvince TEXT,
+    ShipPostalCode TEXT,
     TotalAmount REAL NOT NULL,
     CreatedAt TEXT DEFAULT (datetime('now')),
     PaymentVerified BOOLEAN NOT NULL DEFAULT 0,
     PaymentReference TEXT,
     TrackingNumber TEXT,
+    RefundStatus TEXT NOT NULL DEFAULT 'none', -- none, partial, refunded
+    RefundedAmount REAL NOT NULL DEFAULT 0,
     FOREIGN KEY (UserID) REFERENCES users(UserID)
 );
 
@@ -42,6 +63,9 @@ CREATE TABLE order_details (
     ProductID INTEGER,
     Quantity INTEGER,
     Price REAL,
+    TaxClass TEXT NOT NULL DEFAULT 'standard',
+    TaxRate REAL NOT NULL DEFAULT 0,
+    TaxAmount REAL NOT NULL DEFAULT 0,
     FOREIGN KEY (OrderID) REFERENCES orders(OrderID),
     FOREIGN KEY (ProductID) REFERENCES products(ProductID)
 );
@@ -52,8 +76,10 @@ CREATE TABLE order_history (
     OrderID INTEGER,
     OldStatus TEXT NOT NULL,
     NewStatus TEXT NOT NULL,
+    ChangedBy INTEGER, -- NULL for changes made by the system
     ChangedAt TEXT DEFAULT (datetime('now')),
-    FOREIGN KEY (OrderID) REFERENCES orders(OrderID)
+    FOREIGN KEY (OrderID) REFERENCES orders(OrderID),
+    FOREIGN KEY (ChangedBy) REFERENCES users(UserID)
 );
 
 -- Cart items table
@@ -64,4 +90,224 @@ CREATE TABLE cart_items (
     Quantity INTEGER NOT NULL DEFAULT 1,
     FOREIGN KEY (UserID) REFERENCES users(UserID),
     FOREIGN KEY (ProductID) REFERENCES products(ProductID)
+);
+
+-- Saved customer addresses
+CREATE TABLE addresses (
+    AddressID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    Label TEXT,
+    FullName TEXT NOT NULL,
+    PhoneNumber TEXT NOT NULL,
+    AddressLine TEXT NOT NULL,
+    City TEXT NOT NULL,
+    Province TEXT NOT NULL,
+    PostalCode TEXT NOT NULL,
+    IsDefault BOOLEAN NOT NULL DEFAULT 0,
+    CreatedAt TEXT DEFAULT (datetime('now')),
+    UpdatedAt TEXT DEFAULT (datetime('now')),
+    FOREIGN KEY (UserID) REFERENCES users(UserID)
+);
+
+-- Online payment attempts
+CREATE TABLE payments (
+    PaymentID INTEGER PRIMARY KEY AUTOINCREMENT,
+    OrderID INTEGER NOT NULL,
+    Provider TEXT NOT NULL,
+    Method TEXT NOT NULL,
+    Attempt INTEGER NOT NULL DEFAULT 1,
+    Amount REAL NOT NULL,
+    Currency TEXT NOT NULL DEFAULT 'PHP',
+    Status TEXT NOT NULL DEFAULT 'pending',
+    ProviderRef TEXT,
+    CheckoutURL TEXT,
+    FailureReason TEXT,
+    CreatedAt TEXT DEFAULT (datetime('now')),
+    UpdatedAt TEXT DEFAULT (datetime('now')),
+    FOREIGN KEY (OrderID) REFERENCES orders(OrderID)
+);
+
+-- Processed payment webhook events
+CREATE TABLE payment_events (
+    EventRowID INTEGER PRIMARY KEY AUTOINCREMENT,
+    PaymentID INTEGER NOT NULL,
+    Provider TEXT NOT NULL,
+    EventID TEXT NOT NULL,
+    Type TEXT NOT NULL,
+    ReceivedAt TEXT DEFAULT (datetime('now')),
+    UNIQUE (Provider, EventID),
+    FOREIGN KEY (PaymentID) REFERENCES payments(PaymentID)
+);
+
+CREATE TABLE payment_proofs (
+    ProofID INTEGER PRIMARY KEY AUTOINCREMENT,
+    OrderID INTEGER NOT NULL,
+    UserID INTEGER NOT NULL,
+    Reference TEXT NOT NULL,
+    ImagePath TEXT NOT NULL,
+    ContentType TEXT NOT NULL,
+    Status TEXT DEFAULT 'pending', -- pending, approved, rejected
+    RejectionReason TEXT,
+    ReviewedBy INTEGER,
+    ReviewedAt TEXT,
+    SubmittedAt TEXT DEFAULT (datetime('now')),
+    FOREIGN KEY (OrderID) REFERENCES orders(OrderID),
+    FOREIGN KEY (UserID) REFERENCES users(UserID),
+    FOREIGN KEY (ReviewedBy) REFERENCES users(UserID)
+);
+
+CREATE TABLE refunds (
+    RefundID INTEGER PRIMARY KEY AUTOINCREMENT,
+    OrderID INTEGER NOT NULL,
+    Amount REAL NOT NULL,
+    Reason TEXT NOT NULL,
+    Method TEXT NOT NULL, -- original_payment, cash, bank_transfer, gcash, store_credit
+    Status TEXT DEFAULT 'completed', -- pending, completed, failed
+    Restock BOOLEAN NOT NULL DEFAULT 0,
+    ProviderRef TEXT,
+    FailureReason TEXT,
+    IssuedBy INTEGER NOT NULL,
+    CreatedAt TEXT DEFAULT (datetime('now')),
+    CompletedAt TEXT,
+    FOREIGN KEY (OrderID) REFERENCES orders(OrderID),
+    FOREIGN KEY (IssuedBy) REFERENCES users(UserID)
+);
+
+CREATE TABLE refund_items (
+    RefundItemID INTEGER PRIMARY KEY AUTOINCREMENT,
+    RefundID INTEGER NOT NULL,
+    OrderDetailID INTEGER NOT NULL,
+    Quantity INTEGER NOT NULL,
+    Amount REAL NOT NULL,
+    FOREIGN KEY (RefundID) REFERENCES refunds(RefundID),
+    FOREIGN KEY (OrderDetailID) REFERENCES order_details(OrderDetailID)
+);
+
+CREATE TABLE idempotency_keys (
+    UserID INTEGER NOT NULL,
+    IdemKey TEXT NOT NULL,
+    Method TEXT NOT NULL,
+    Path TEXT NOT NULL,
+    Fingerprint TEXT NOT NULL, -- sha256 of method, path and body
+    Status TEXT DEFAULT 'processing', -- processing, completed
+    ResponseCode INTEGER,
+    ContentType TEXT,
+    ResponseBody BLOB,
+    CreatedAt TEXT DEFAULT (datetime('now')),
+    PRIMARY KEY (UserID, IdemKey)
+);
+
+CREATE TABLE sessions (
+    SessionID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    TokenHash TEXT NOT NULL UNIQUE, -- sha256 of the current refresh token
+    PreviousHash TEXT, -- sha256 of the rotated-out token, to detect reuse
+    UserAgent TEXT,
+    IPAddress TEXT,
+    CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    LastUsedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    ExpiresAt TEXT NOT NULL,
+    RevokedAt TEXT,
+    FOREIGN KEY (UserID) REFERENCES users(UserID)
+);
+
+CREATE TABLE roles (
+    Name TEXT PRIMARY KEY, -- owner, admin, fulfilment, support, catalog_editor, customer or custom
+    Description TEXT,
+    BuiltIn BOOLEAN NOT NULL DEFAULT 0,
+    CreatedAt TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE TABLE role_permissions (
+    Role TEXT NOT NULL,
+    Permission TEXT NOT NULL, -- e.g. orders:update_status, payments:verify, products:write
+    PRIMARY KEY (Role, Permission),
+    FOREIGN KEY (Role) REFERENCES roles(Name)
+);
+
+-- Single-use links sent by email
+CREATE TABLE user_tokens (
+    TokenHash TEXT PRIMARY KEY, -- sha256 of the token in the link
+    UserID INTEGER NOT NULL,
+    Purpose TEXT NOT NULL, -- verify_email or reset_password
+    CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    ExpiresAt TEXT NOT NULL,
+    UsedAt TEXT,
+    FOREIGN KEY (UserID) REFERENCES users(UserID)
+);
+
+-- Domain events, recorded in the same transaction as the change (see internal/events)
+CREATE TABLE domain_events (
+    EventID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Type TEXT NOT NULL, -- e.g. OrderPlaced, PaymentVerified, ProductUpdated
+    Payload TEXT NOT NULL, -- JSON
+    CreatedAt TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- One row per event and subscriber, retried until the subscriber handles it
+CREATE TABLE event_deliveries (
+    EventID INTEGER NOT NULL,
+    Subscriber TEXT NOT NULL, -- email or webhooks
+    Status TEXT NOT NULL DEFAULT 'pending', -- pending, delivered, failed
+    Attempts INTEGER NOT NULL DEFAULT 0,
+    NextAttemptAt TEXT NOT NULL DEFAULT (datetime('now')),
+    LastError TEXT,
+    DeliveredAt TEXT,
+    PRIMARY KEY (EventID, Subscriber),
+    FOREIGN KEY (EventID) REFERENCES domain_events(EventID)
+);
+
+-- Append-only record of security-relevant and admin actions
+CREATE TABLE audit_log (
+    AuditID INTEGER PRIMARY KEY AUTOINCREMENT,
+    ActorID INTEGER, -- NULL for the system or anonymous clients
+    Action TEXT NOT NULL, -- e.g. auth.lockout, product.update
+    TargetType TEXT, -- e.g. user, product
+    TargetID TEXT,
+    Before TEXT, -- JSON snapshot of the target before the change
+    After TEXT, -- JSON snapshot of the target after the change
+    Details TEXT, -- JSON
+    IPAddress TEXT,
+    CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (ActorID) REFERENCES users(UserID)
+);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+
+-- Integrators' endpoints subscribed to domain events (see internal/webhooks)
+CREATE TABLE webhooks (
+    WebhookID INTEGER PRIMARY KEY AUTOINCREMENT,
+    URL TEXT NOT NULL,
+    Description TEXT,
+    Events TEXT NOT NULL, -- comma-separated event types
+    Secret TEXT NOT NULL, -- HMAC-SHA256 signing key
+    Active BOOLEAN NOT NULL DEFAULT 1,
+    CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    UpdatedAt TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Delivery log: one row per event sent to a webhook, plus one per replay
+CREATE TABLE webhook_deliveries (
+    DeliveryID INTEGER PRIMARY KEY AUTOINCREMENT,
+    WebhookID INTEGER NOT NULL,
+    EventID INTEGER, -- NULL for pings
+    EventType TEXT NOT NULL,
+    Payload TEXT NOT NULL, -- exact JSON body posted
+    Status TEXT NOT NULL DEFAULT 'pending', -- pending, delivered, failed
+    Attempts INTEGER NOT NULL DEFAULT 0,
+    NextAttemptAt TEXT NOT NULL DEFAULT (datetime('now')),
+    ResponseStatus INTEGER,
+    ResponseBody TEXT, -- first 1 KB of the last response
+    LastError TEXT,
+    DurationMs INTEGER,
+    ReplayOf INTEGER, -- delivery this one replays
+    CreatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    DeliveredAt TEXT,
+    FOREIGN KEY (WebhookID) REFERENCES webhooks(WebhookID),
+    FOREIGN KEY (EventID) REFERENCES domain_events(EventID),
+    FOREIGN KEY (ReplayOf) REFERENCES webhook_deliveries(DeliveryID)
 );
\ No newline at end of file
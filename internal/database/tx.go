@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// maxTxAttempts is how many times WithTx runs a transaction that keeps
+// failing because the database is locked
+const maxTxAttempts = 5
+
+// busyRetries counts transactions WithTx retried because the database was
+// locked
+var busyRetries atomic.Int64
+
+// BusyRetries returns how many times WithTx has retried a transaction
+// because the database was locked
+func BusyRetries() int64 {
+	return busyRetries.Load()
+}
+
+// WithTx runs fn in a write transaction on the writer connection and commits
+// it. Transactions begin with BEGIN IMMEDIATE, so the write lock is taken up
+// front instead of being upgraded halfway through. If another process holds
+// the lock the whole transaction is retried with jittered backoff, so fn may
+// run more than once and must not have side effects outside tx.
+//
+// fn must only use tx: the writer has a single connection, and using DB or
+// calling a function that starts its own transaction would wait on itself.
+func WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	backoff := 10 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, fn)
+		if err == nil || !IsBusy(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		busyRetries.Add(1)
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		slog.WarnContext(ctx, "Database busy, retrying transaction", "attempt", attempt, "max_attempts", maxTxAttempts, "wait", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// runTx makes a single attempt at a WithTx transaction
+func runTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// IsBusy reports whether err means SQLite could not get a lock
+func IsBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+
+	// Model errors wrap driver errors with %v, so fall back to the message
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked")
+}
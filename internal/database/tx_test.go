@@ -0,0 +1,42 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"go_module/internal/database"
+	"go_module/internal/dbtest"
+)
+
+func TestMain(m *testing.M) {
+	dbtest.Main(m)
+}
+
+func TestWithTxCancelledRollsBack(t *testing.T) {
+	if _, err := database.DB.Exec("CREATE TABLE tx_test (ID INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO tx_test (ID) VALUES (1)"); err != nil {
+			return err
+		}
+		// The caller gives up before the transaction commits
+		cancel()
+		return nil
+	})
+	if err == nil {
+		t.Fatal("WithTx committed after its context was cancelled")
+	}
+
+	var n int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM tx_test").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("cancelled transaction left %d rows", n)
+	}
+}
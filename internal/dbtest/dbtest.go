@@ -0,0 +1,105 @@
+// Package dbtest runs a package's tests against a fresh database.
+//
+// Call Main from TestMain. It opens a new database with the seed data in a
+// temporary directory, and removes it when the tests are done. The tests of
+// a package share that database, so each test should create the users and
+// orders it relies on with NewUser and PlaceOrder rather than expect the
+// seed rows to be untouched.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"go_module/internal/database"
+	"go_module/internal/logging"
+	"go_module/internal/models"
+)
+
+// Main opens the database and runs the tests. Logs are discarded unless
+// TEST_LOG_LEVEL is set.
+func Main(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	var out io.Writer = io.Discard
+	level := slog.LevelInfo
+	if v := os.Getenv("TEST_LOG_LEVEL"); v != "" {
+		out = os.Stderr
+		level.UnmarshalText([]byte(v))
+	}
+	logging.Setup(out, logging.Config{Format: "text", Level: level})
+
+	dir, err := os.MkdirTemp("", "dbtest")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dbtest:", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		fmt.Fprintln(os.Stderr, "dbtest:", err)
+		return 1
+	}
+
+	database.InitDB()
+	if err := models.EnsureRoles(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, "dbtest:", err)
+		return 1
+	}
+	return m.Run()
+}
+
+var userSeq atomic.Int64
+
+// Password is the password of every user made by NewUser
+const Password = "password123"
+
+// NewUser creates a verified user with a role and a unique email address
+func NewUser(t testing.TB, role string) *models.User {
+	t.Helper()
+	ctx := context.Background()
+
+	n := userSeq.Add(1)
+	email := fmt.Sprintf("%s%d@test.example.com", role, n)
+	user, err := models.CreateUser(ctx, fmt.Sprintf("%s%d", role, n), email, Password, role)
+	if err != nil {
+		t.Fatalf("create %s user: %v", role, err)
+	}
+	if _, err := database.DB.ExecContext(ctx, "UPDATE users SET EmailVerified = 1 WHERE UserID = ?", user.UserID); err != nil {
+		t.Fatalf("verify %s user: %v", role, err)
+	}
+	user.EmailVerified = true
+	return user
+}
+
+// Address is a valid Metro Manila shipping address
+var Address = models.Address{
+	FullName:    "Juan dela Cruz",
+	PhoneNumber: "09171234567",
+	AddressLine: "123 Rizal St",
+	City:        "Makati",
+	Province:    "Metro Manila",
+	PostalCode:  "1200",
+}
+
+// PlaceOrder checks out one unit of the first seeded product for a user,
+// paid with paymentMethod
+func PlaceOrder(t testing.TB, userID int64, paymentMethod string) *models.Order {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := models.AddToCart(ctx, userID, 1, 1); err != nil {
+		t.Fatalf("add to cart: %v", err)
+	}
+	order, err := models.CreateOrder(ctx, userID, Address, paymentMethod)
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	return order
+}
@@ -0,0 +1,241 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go_module/internal/database"
+)
+
+// Dispatcher settings
+var (
+	// PollInterval is how often Run looks for due deliveries when no new
+	// event wakes it
+	PollInterval = 5 * time.Second
+	// MaxAttempts is how many times a subscriber is given an event before
+	// its delivery is marked failed
+	MaxAttempts = 8
+	// HandlerTimeout bounds a single call to a subscriber
+	HandlerTimeout = 30 * time.Second
+)
+
+const batchSize = 50
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// wakeCh tells Run that an event was recorded
+var wakeCh = make(chan struct{}, 1)
+
+func wake() {
+	select {
+	case wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// delivery is one event waiting to be handled by one subscriber
+type delivery struct {
+	Event
+	subscriber string
+	attempts   int
+}
+
+// Run dispatches events to subscribers until ctx is cancelled
+func Run(ctx context.Context) {
+	slog.InfoContext(ctx, "Event dispatcher started", "poll_interval", PollInterval.String())
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := DispatchPending(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Event dispatcher failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wakeCh:
+		}
+	}
+}
+
+// DispatchPending hands every due delivery to its subscriber and returns how
+// many were handled successfully. Tests can call it directly instead of
+// waiting for Run.
+func DispatchPending(ctx context.Context) (int, error) {
+	handled := 0
+	for {
+		deliveries, err := claimDeliveries(ctx, batchSize, HandlerTimeout*2)
+		if err != nil {
+			return handled, err
+		}
+		if len(deliveries) == 0 {
+			return handled, nil
+		}
+
+		for _, d := range deliveries {
+			if err := handle(ctx, d); err != nil {
+				recordFailure(ctx, d, err)
+				continue
+			}
+			if err := markDelivered(ctx, d); err != nil {
+				slog.ErrorContext(ctx, "Event dispatcher failed", "error", err)
+				continue
+			}
+			handled++
+		}
+	}
+}
+
+// handle calls a delivery's subscriber, turning a panic into an error
+func handle(ctx context.Context, d delivery) (err error) {
+	mu.RLock()
+	s := subscribers[d.subscriber]
+	mu.RUnlock()
+	if s == nil {
+		return fmt.Errorf("subscriber %s is not registered", d.subscriber)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("subscriber %s panicked: %v", d.subscriber, r)
+		}
+	}()
+
+	handlerCtx, cancel := context.WithTimeout(ctx, HandlerTimeout)
+	defer cancel()
+	return s.handler(handlerCtx, d.Event)
+}
+
+// claimDeliveries returns up to limit due deliveries for the registered
+// subscribers and holds them for lease, so another dispatcher doesn't handle
+// them at the same time. A delivery whose dispatcher stops before marking
+// it is retried once the lease runs out.
+func claimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]delivery, error) {
+	mu.RLock()
+	names := make([]interface{}, 0, len(subscribers))
+	for name := range subscribers {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+	var claimed []delivery
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		claimed = nil
+
+		args := append([]interface{}{DeliveryPending, now.Format("2006-01-02 15:04:05")}, names...)
+		args = append(args, limit)
+		rows, err := tx.QueryContext(ctx, `
+			SELECT d.EventID, d.Subscriber, d.Attempts, e.Type, e.Payload, e.CreatedAt
+			FROM event_deliveries d
+			JOIN domain_events e ON e.EventID = d.EventID
+			WHERE d.Status = ? AND d.NextAttemptAt <= ?
+				AND d.Subscriber IN (?`+strings.Repeat(", ?", len(names)-1)+`)
+			ORDER BY d.NextAttemptAt, d.EventID
+			LIMIT ?
+		`, args...)
+		if err != nil {
+			return fmt.Errorf("failed to fetch event deliveries: %v", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var d delivery
+			var payload, createdAt string
+			if err := rows.Scan(&d.EventID, &d.subscriber, &d.attempts, &d.Type, &payload, &createdAt); err != nil {
+				return fmt.Errorf("failed to scan event delivery: %v", err)
+			}
+			d.Payload = []byte(payload)
+			d.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+			claimed = append(claimed, d)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating event deliveries: %v", err)
+		}
+		rows.Close()
+
+		leaseUntil := now.Add(lease).Format("2006-01-02 15:04:05")
+		for _, d := range claimed {
+			_, err := tx.ExecContext(ctx,
+				"UPDATE event_deliveries SET NextAttemptAt = ? WHERE EventID = ? AND Subscriber = ?",
+				leaseUntil, d.EventID, d.subscriber,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to claim event delivery: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// markDelivered records that a subscriber handled an event
+func markDelivered(ctx context.Context, d delivery) error {
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE event_deliveries
+		SET Status = ?, Attempts = Attempts + 1, LastError = NULL, DeliveredAt = datetime('now')
+		WHERE EventID = ? AND Subscriber = ?
+	`, DeliveryDelivered, d.EventID, d.subscriber)
+	if err != nil {
+		return fmt.Errorf("failed to mark event delivered: %v", err)
+	}
+	return nil
+}
+
+// recordFailure schedules a failed delivery for another attempt, backing off
+// exponentially, or gives up on it
+func recordFailure(ctx context.Context, d delivery, handlerErr error) {
+	attempts := d.attempts + 1
+	status := DeliveryPending
+	retryAt := time.Now().UTC().Add(RetryDelay(attempts))
+	if isPermanent(handlerErr) || attempts >= MaxAttempts {
+		status = DeliveryFailed
+		retryAt = time.Now().UTC()
+		slog.ErrorContext(ctx, "Event dispatcher gave up on event",
+			"event_type", d.Type, "event_id", d.EventID, "subscriber", d.subscriber, "attempts", attempts, "error", handlerErr)
+	} else {
+		slog.WarnContext(ctx, "Event dispatcher will retry event",
+			"event_type", d.Type, "event_id", d.EventID, "subscriber", d.subscriber, "attempts", attempts, "retry_at", retryAt, "error", handlerErr)
+	}
+
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE event_deliveries
+		SET Status = ?, Attempts = ?, LastError = ?, NextAttemptAt = ?
+		WHERE EventID = ? AND Subscriber = ?
+	`, status, attempts, handlerErr.Error(), retryAt.Format("2006-01-02 15:04:05"), d.EventID, d.subscriber)
+	if err != nil {
+		slog.ErrorContext(ctx, "Event dispatcher failed to record delivery failure", "error", err)
+	}
+}
+
+// RetryDelay is the wait before the next attempt: 1 minute after the first
+// failure, doubling up to an hour
+func RetryDelay(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
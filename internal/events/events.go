@@ -0,0 +1,204 @@
+// Package events is the domain event bus.
+//
+// Models record events with Record inside the transaction that makes the
+// change, so an event exists exactly when its change commits (a
+// transactional outbox). Each event gets a delivery row for every subscriber
+// of its type, and the dispatcher started by Run hands events to
+// subscribers in the background. Delivery is at least once: a subscriber
+// that returns an error is called again later with backoff, so handlers must
+// tolerate seeing an event twice.
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	OrderPlaced        = "OrderPlaced"
+	OrderStatusChanged = "OrderStatusChanged"
+	PaymentVerified    = "PaymentVerified"
+	StockLow           = "StockLow"
+	ProductCreated     = "ProductCreated"
+	ProductUpdated     = "ProductUpdated"
+	ProductDeleted     = "ProductDeleted"
+)
+
+// Types lists every event type
+var Types = []string{
+	OrderPlaced, OrderStatusChanged, PaymentVerified, StockLow,
+	ProductCreated, ProductUpdated, ProductDeleted,
+}
+
+// OrderPlacedData is the payload of OrderPlaced
+type OrderPlacedData struct {
+	OrderID       int64   `json:"order_id"`
+	UserID        int64   `json:"user_id"`
+	TotalAmount   float64 `json:"total_amount"`
+	PaymentMethod string  `json:"payment_method"`
+	ItemCount     int     `json:"item_count"`
+}
+
+// OrderStatusChangedData is the payload of OrderStatusChanged. It is also
+// recorded when only the tracking number of an order changes.
+type OrderStatusChangedData struct {
+	OrderID         int64  `json:"order_id"`
+	UserID          int64  `json:"user_id"`
+	OldStatus       string `json:"old_status"`
+	NewStatus       string `json:"new_status"`
+	TrackingNumber  string `json:"tracking_number,omitempty"`
+	TrackingChanged bool   `json:"tracking_changed"`
+}
+
+// PaymentVerifiedData is the payload of PaymentVerified
+type PaymentVerifiedData struct {
+	OrderID   int64   `json:"order_id"`
+	UserID    int64   `json:"user_id"`
+	Amount    float64 `json:"amount"`
+	Reference string  `json:"reference"`
+}
+
+// StockLowData is the payload of StockLow, recorded when a sale takes a
+// product's stock down to the low stock threshold or below
+type StockLowData struct {
+	ProductID int64  `json:"product_id"`
+	Name      string `json:"name"`
+	Stock     int    `json:"stock"`
+	Threshold int    `json:"threshold"`
+}
+
+// ProductData is the payload of ProductCreated and ProductUpdated, holding
+// the product as saved
+type ProductData struct {
+	ProductID int64   `json:"product_id"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	Stock     int     `json:"stock"`
+	TaxClass  string  `json:"tax_class"`
+}
+
+// ProductDeletedData is the payload of ProductDeleted
+type ProductDeletedData struct {
+	ProductID int64  `json:"product_id"`
+	Name      string `json:"name"`
+}
+
+// Event is a recorded domain event
+type Event struct {
+	EventID   int64           `json:"event_id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Decode unmarshals the event's payload into v
+func (e Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return Permanent(fmt.Errorf("failed to decode %s event %d: %v", e.Type, e.EventID, err))
+	}
+	return nil
+}
+
+// Handler processes one event for a subscriber
+type Handler func(ctx context.Context, e Event) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+	types   map[string]bool
+}
+
+var (
+	mu          sync.RWMutex
+	subscribers = map[string]*subscriber{}
+)
+
+// Subscribe registers a handler for events of the given types under a
+// unique name, which identifies its deliveries in the database. Subscribers
+// must be registered at startup: an event is only delivered to the
+// subscribers that existed when it was recorded.
+func Subscribe(name string, handler Handler, types ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s := &subscriber{name: name, handler: handler, types: map[string]bool{}}
+	for _, t := range types {
+		s.types[t] = true
+	}
+	subscribers[name] = s
+}
+
+// subscribersOf returns the names of the subscribers of an event type
+func subscribersOf(eventType string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var names []string
+	for name, s := range subscribers {
+		if s.types[eventType] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Record adds an event to the outbox inside tx, along with a pending
+// delivery for each of its subscribers
+func Record(ctx context.Context, tx *sql.Tx, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %v", eventType, err)
+	}
+
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO domain_events (Type, Payload, CreatedAt) VALUES (?, ?, datetime('now'))",
+		eventType, string(payload),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record %s event: %v", eventType, err)
+	}
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get event ID: %v", err)
+	}
+
+	for _, name := range subscribersOf(eventType) {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO event_deliveries (EventID, Subscriber, NextAttemptAt) VALUES (?, ?, datetime('now'))",
+			eventID, name,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to queue %s event for %s: %v", eventType, name, err)
+		}
+	}
+
+	// The dispatcher's claim waits on the writer until this commits
+	wake()
+	return nil
+}
+
+// permanentError marks a handler error that retrying cannot fix
+type permanentError struct{ err error }
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// Permanent wraps a handler error so the delivery is marked failed straight
+// away instead of being retried
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// isPermanent reports whether a handler error was wrapped with Permanent
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"go_module/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// addressInput is the request body for creating or updating a saved address
+type addressInput struct {
+	Label       string `json:"label"`
+	FullName    string `json:"full_name" binding:"required"`
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Address     string `json:"address" binding:"required"`
+	City        string `json:"city" binding:"required"`
+	Province    string `json:"province" binding:"required"`
+	PostalCode  string `json:"postal_code" binding:"required"`
+	IsDefault   bool   `json:"is_default"`
+}
+
+// toAddress converts the request body to a model address
+func (in addressInput) toAddress() models.Address {
+	return models.Address{
+		Label:       in.Label,
+		FullName:    in.FullName,
+		PhoneNumber: in.PhoneNumber,
+		AddressLine: in.Address,
+		City:        in.City,
+		Province:    in.Province,
+		PostalCode:  in.PostalCode,
+		IsDefault:   in.IsDefault,
+	}
+}
+
+// GetMyAddresses lists the current user's saved addresses
+func GetMyAddresses(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	addresses, err := models.GetAddressesByUserID(c.Request.Context(), userID.(int64))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch addresses", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to fetch addresses")
+		return
+	}
+
+	c.JSON(http.StatusOK, addresses)
+}
+
+// CreateMyAddress adds an address to the current user's address book
+func CreateMyAddress(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var input addressInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	address, err := models.CreateAddress(c.Request.Context(), userID.(int64), input.toAddress())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create address", "error", err)
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, address)
+}
+
+// UpdateMyAddress replaces a saved address
+func UpdateMyAddress(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	addressID, err := strconv.ParseInt(c.Param("addressId"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid address ID")
+		return
+	}
+
+	var input addressInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	address, err := models.UpdateAddress(c.Request.Context(), userID.(int64), addressID, input.toAddress())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update address", "error", err)
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+// SetMyDefaultAddress makes a saved address the default for checkout
+func SetMyDefaultAddress(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	addressID, err := strconv.ParseInt(c.Param("addressId"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid address ID")
+		return
+	}
+
+	if err := models.SetDefaultAddress(c.Request.Context(), userID.(int64), addressID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to set default address", "error", err)
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Default address updated"})
+}
+
+// DeleteMyAddress removes a saved address
+func DeleteMyAddress(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	addressID, err := strconv.ParseInt(c.Param("addressId"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid address ID")
+		return
+	}
+
+	if err := models.DeleteAddress(c.Request.Context(), userID.(int64), addressID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete address", "error", err)
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted"})
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,38 +14,38 @@ import (
 // GetDashboardMetrics returns metrics for the admin dashboard
 func GetDashboardMetrics(c *gin.Context) {
 	// Get metrics
-	userCount, err := models.GetUserCount()
+	userCount, err := models.GetUserCount(c.Request.Context())
 	if err != nil {
-		log.Printf("Error getting user count: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user count"})
+		slog.ErrorContext(c.Request.Context(), "Error getting user count", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get user count")
 		return
 	}
 
-	productCount, err := models.GetProductCount()
+	productCount, err := models.GetProductCount(c.Request.Context())
 	if err != nil {
-		log.Printf("Error getting product count: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get product count"})
+		slog.ErrorContext(c.Request.Context(), "Error getting product count", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get product count")
 		return
 	}
 
-	orderCount, err := models.GetOrderCount()
+	orderCount, err := models.GetOrderCount(c.Request.Context())
 	if err != nil {
-		log.Printf("Error getting order count: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order count"})
+		slog.ErrorContext(c.Request.Context(), "Error getting order count", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get order count")
 		return
 	}
 
-	totalRevenue, err := models.GetTotalRevenue()
+	totalRevenue, err := models.GetTotalRevenue(c.Request.Context())
 	if err != nil {
-		log.Printf("Error getting total revenue: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get total revenue"})
+		slog.ErrorContext(c.Request.Context(), "Error getting total revenue", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get total revenue")
 		return
 	}
 
 	// Get recent orders
-	recentOrders, err := models.GetRecentOrders(5)
+	recentOrders, err := models.GetRecentOrders(c.Request.Context(), 5)
 	if err != nil {
-		log.Printf("Error getting recent orders: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Error getting recent orders", "error", err)
 		// Continue without recent orders
 		recentOrders = []models.Order{}
 	}
@@ -54,7 +54,7 @@ func GetDashboardMetrics(c *gin.Context) {
 	formattedRecentOrders := []gin.H{}
 	for _, order := range recentOrders {
 		// Get user info
-		user, err := models.GetUserByID(order.UserID)
+		user, err := models.GetUserByID(c.Request.Context(), order.UserID)
 		customerName := "Unknown"
 		if err == nil && user != nil {
 			customerName = user.Username
@@ -71,7 +71,7 @@ func GetDashboardMetrics(c *gin.Context) {
 
 	// Create mock top products data (since we don't have this functionality yet)
 	topProducts := []gin.H{}
-	products, err := models.GetAllProducts()
+	products, err := models.GetAllProducts(c.Request.Context())
 	if err == nil && len(products) > 0 {
 		// Just use the first 5 products as mock data
 		count := 5
@@ -107,9 +107,9 @@ func GetDashboardMetrics(c *gin.Context) {
 
 // GetAdminProducts returns all products for admin
 func GetAdminProducts(c *gin.Context) {
-	products, err := models.GetAllProducts()
+	products, err := models.GetAllProducts(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		respondError(c, http.StatusInternalServerError, "Failed to fetch products")
 		return
 	}
 
@@ -119,10 +119,10 @@ func GetAdminProducts(c *gin.Context) {
 // AdminGetOrders returns all orders for admin
 func AdminGetOrders(c *gin.Context) {
 	// Get all orders
-	orders, err := models.GetAllOrders()
+	orders, err := models.GetAllOrders(c.Request.Context())
 	if err != nil {
-		log.Printf("Error getting all orders: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get orders"})
+		slog.ErrorContext(c.Request.Context(), "Error getting all orders", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get orders")
 		return
 	}
 
@@ -136,25 +136,26 @@ func AdminUpdateOrderStatus(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
 		return
 	}
 
 	// Parse request body
 	var req struct {
-		Status string `json:"status" binding:"required"`
+		Status         string `json:"status" binding:"required"`
+		TrackingNumber string `json:"tracking_number" binding:"max=100"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		c.Error(invalidInput(err))
 		return
 	}
 
 	// Update order status
-	err = models.UpdateOrderStatus(id, req.Status)
+	err = models.UpdateOrderStatus(c.Request.Context(), id, req.Status, req.TrackingNumber)
 	if err != nil {
-		log.Printf("Error updating order status: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Error updating order status", "error", err)
+		c.Error(err)
 		return
 	}
 
@@ -168,7 +169,7 @@ func VerifyPayment(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
 		return
 	}
 
@@ -178,22 +179,43 @@ func VerifyPayment(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		c.Error(invalidInput(err))
 		return
 	}
 
 	// Verify payment
-	err = models.VerifyOrderPayment(id, req.Reference)
+	err = models.VerifyOrderPayment(c.Request.Context(), id, req.Reference)
 	if err != nil {
-		log.Printf("Error verifying payment: %v", err)
-		if err.Error() == "order not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Error verifying payment", "error", err)
+		c.Error(err)
 		return
 	}
 
 	// Send response
 	c.JSON(http.StatusOK, gin.H{"message": "Payment verified successfully"})
 }
+
+// GetSalesReport returns sales and VAT totals for a date range
+func GetSalesReport(c *gin.Context) {
+	// Default to the last 30 days
+	end := c.DefaultQuery("end", time.Now().Format("2006-01-02"))
+	start := c.DefaultQuery("start", time.Now().AddDate(0, 0, -30).Format("2006-01-02"))
+
+	if _, err := time.Parse("2006-01-02", start); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid start date, expected YYYY-MM-DD")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", end); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid end date, expected YYYY-MM-DD")
+		return
+	}
+
+	report, err := models.GetSalesReport(c.Request.Context(), start, end)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error getting sales report", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get sales report")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_module/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditFilter reads the audit log filters from the query string, responding
+// with 400 when one is malformed
+func auditFilter(c *gin.Context) (models.AuditFilter, bool) {
+	f := models.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Start:      c.Query("start"),
+		End:        c.Query("end"),
+	}
+
+	if v := c.Query("actor_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid actor ID")
+			return f, false
+		}
+		f.ActorID = id
+	}
+	if v := c.Query("before"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid cursor")
+			return f, false
+		}
+		f.BeforeID = id
+	}
+	if f.Start != "" {
+		if _, err := time.Parse("2006-01-02", f.Start); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid start date, expected YYYY-MM-DD")
+			return f, false
+		}
+	}
+	if f.End != "" {
+		if _, err := time.Parse("2006-01-02", f.End); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid end date, expected YYYY-MM-DD")
+			return f, false
+		}
+	}
+	return f, true
+}
+
+// AdminGetAuditLog searches the audit log, newest first. next_cursor is
+// passed back as before to get the next page.
+func AdminGetAuditLog(c *gin.Context) {
+	f, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		respondError(c, http.StatusBadRequest, "limit must be between 1 and 200")
+		return
+	}
+
+	records, err := models.GetAuditLog(c.Request.Context(), f, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	response := gin.H{"entries": records}
+	if len(records) == limit {
+		response["next_cursor"] = records[len(records)-1].AuditID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminExportAuditLog downloads every audit entry matching the filters, as
+// CSV or, with format=json, as one JSON object per line
+func AdminExportAuditLog(c *gin.Context) {
+	f, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		respondError(c, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	filename := "audit-" + time.Now().Format("20060102-150405")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+"."+format+`"`)
+
+	// Entries are written as they are read, so a failure part way through
+	// can only be logged
+	var err error
+	if format == "json" {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		enc := json.NewEncoder(c.Writer)
+		err = models.EachAuditRecord(c.Request.Context(), f, 0, func(r models.AuditRecord) error {
+			return enc.Encode(r)
+		})
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{
+			"audit_id", "created_at", "actor_id", "actor_email", "action", "target_type", "target_id",
+			"changed_fields", "before", "after", "details", "ip_address",
+		})
+		err = models.EachAuditRecord(c.Request.Context(), f, 0, func(r models.AuditRecord) error {
+			actorID := ""
+			if r.ActorID != nil {
+				actorID = strconv.FormatInt(*r.ActorID, 10)
+			}
+			return w.Write([]string{
+				strconv.FormatInt(r.AuditID, 10), r.CreatedAt.Format(time.RFC3339), actorID, r.ActorEmail,
+				r.Action, r.TargetType, r.TargetID, strings.Join(r.ChangedFields(), " "),
+				string(r.Before), string(r.After), string(r.Details), r.IPAddress,
+			})
+		})
+		w.Flush()
+		if err == nil {
+			err = w.Error()
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Audit log export failed", "error", err)
+	}
+}
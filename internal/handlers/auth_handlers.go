@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go_module/internal/mail"
+	"go_module/internal/middleware"
+	"go_module/internal/models"
+	"go_module/internal/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithTokens writes a login or refresh response: the user and their
+// role's permissions, a fresh access token for the session and the session's
+// current refresh token
+func respondWithTokens(c *gin.Context, user *models.User, session *models.Session, refreshToken string) {
+	token, err := middleware.GenerateToken(user.UserID, user.Role, session.SessionID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":          user,
+		"permissions":   models.RolePermissions(user.Role),
+		"token":         token,
+		"expires_in":    int64(middleware.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+	})
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. The old refresh token stops working.
+func RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	session, refreshToken, err := models.RotateSession(c.Request.Context(), input.RefreshToken)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Reload the user so role changes apply from the next access token
+	user, err := models.GetUserByID(c.Request.Context(), session.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respondWithTokens(c, user, session, refreshToken)
+}
+
+// Logout revokes the session of the access token used for the request
+func Logout(c *gin.Context) {
+	sessionID, exists := c.Get("sessionID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := models.RevokeSession(c.Request.Context(), sessionID.(int64)); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll revokes every session of the current user, logging them out on
+// all devices
+func LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	revoked, err := models.RevokeUserSessions(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions", "sessions_revoked": revoked})
+}
+
+// accountEmailTimeout bounds sending an account email after the request that
+// triggered it has been answered
+const accountEmailTimeout = 30 * time.Second
+
+// sendAccountEmail issues a token for a user and emails them a link to the
+// storefront page that uses it. It runs after the response is sent, so it
+// detaches from the request's cancellation, keeping its request ID for the
+// logs, and only logs failures. These emails skip the event bus so their
+// links are never stored.
+func sendAccountEmail(ctx context.Context, user *models.User, purpose string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), accountEmailTimeout)
+	defer cancel()
+
+	var ttl time.Duration
+	var path, template string
+	switch purpose {
+	case models.TokenVerifyEmail:
+		ttl, path, template = models.EmailVerificationTTL, "/verify-email", notify.EmailVerifyEmail
+	case models.TokenResetPassword:
+		ttl, path, template = models.PasswordResetTTL, "/reset-password", notify.EmailResetPassword
+	default:
+		slog.ErrorContext(ctx, "Unknown account email purpose", "purpose", purpose)
+		return
+	}
+
+	token, err := models.CreateUserToken(ctx, user.UserID, purpose, ttl)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create account email token", "purpose", purpose, "user_id", user.UserID, "error", err)
+		return
+	}
+
+	msg, err := notify.Render(user.Email, template, notify.AccountEmail{
+		StoreName: notify.StoreName,
+		User:      user,
+		Link:      notify.AppURL + path + "?token=" + url.QueryEscape(token),
+		ExpiresIn: expiryText(ttl),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to render account email", "purpose", purpose, "error", err)
+		return
+	}
+	if err := mail.Send(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to send account email", "purpose", purpose, "user_id", user.UserID, "error", err)
+	}
+}
+
+// expiryText describes a link lifetime for an email, such as "24 hours"
+func expiryText(ttl time.Duration) string {
+	if ttl%time.Hour != 0 {
+		return ttl.String()
+	}
+	if ttl == time.Hour {
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d hours", int(ttl.Hours()))
+}
+
+// VerifyEmail confirms a user's email address with the token from their
+// verification email
+func VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	user, err := models.VerifyEmail(c.Request.Context(), input.Token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified", "user": user})
+}
+
+// ResendVerification emails a new verification link. The response is the
+// same whether or not the address belongs to an unverified account, so it
+// can't be used to find out who has one.
+func ResendVerification(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	go func(ctx context.Context, email string) {
+		user, err := models.GetUserByEmail(ctx, email)
+		if err != nil || user.EmailVerified {
+			return
+		}
+		sendAccountEmail(ctx, user, models.TokenVerifyEmail)
+	}(context.WithoutCancel(c.Request.Context()), input.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If that address has an unverified account, a new verification link is on its way"})
+}
+
+// ForgotPassword emails a password reset link. Like ResendVerification, it
+// answers the same way for unknown addresses.
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	go func(ctx context.Context, email string) {
+		user, err := models.GetUserByEmail(ctx, email)
+		if err != nil {
+			return
+		}
+		sendAccountEmail(ctx, user, models.TokenResetPassword)
+	}(context.WithoutCancel(c.Request.Context()), input.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If that address has an account, a password reset link is on its way"})
+}
+
+// ResetPassword sets a new password with the token from a password reset
+// email. Every session of the user is revoked, so they log in again with the
+// new password.
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	if err := models.ResetPassword(c.Request.Context(), input.Token, input.Password); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in"})
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -14,8 +14,8 @@ import (
 func UpdateCartItem(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		log.Printf("User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		slog.InfoContext(c.Request.Context(), "User ID not found in context")
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
@@ -25,17 +25,15 @@ func UpdateCartItem(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("Invalid input: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.DebugContext(c.Request.Context(), "Invalid cart input", "error", err)
+		c.Error(invalidInput(err))
 		return
 	}
 
-	log.Printf("Updating cart - UserID: %v, ProductID: %v, Quantity: %v", userID, input.ProductID, input.Quantity)
-
-	err := models.UpdateCartItemQuantity(userID.(int64), input.ProductID, input.Quantity)
+	err := models.UpdateCartItemQuantity(c.Request.Context(), userID.(int64), input.ProductID, input.Quantity)
 	if err != nil {
-		log.Printf("Failed to update cart: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Failed to update cart", "error", err)
+		c.Error(err)
 		return
 	}
 
@@ -46,8 +44,8 @@ func UpdateCartItem(c *gin.Context) {
 func DecreaseCartItem(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		log.Printf("User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		slog.InfoContext(c.Request.Context(), "User ID not found in context")
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
@@ -57,17 +55,15 @@ func DecreaseCartItem(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("Invalid input: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.DebugContext(c.Request.Context(), "Invalid cart input", "error", err)
+		c.Error(invalidInput(err))
 		return
 	}
 
-	log.Printf("Decreasing cart item - UserID: %v, ProductID: %v, DecreaseBy: %v", userID, input.ProductID, input.DecreaseBy)
-
-	err := models.DecreaseCartItemQuantity(userID.(int64), input.ProductID, input.DecreaseBy)
+	err := models.DecreaseCartItemQuantity(c.Request.Context(), userID.(int64), input.ProductID, input.DecreaseBy)
 	if err != nil {
-		log.Printf("Failed to decrease cart item: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Failed to decrease cart item", "error", err)
+		c.Error(err)
 		return
 	}
 
@@ -78,23 +74,21 @@ func DecreaseCartItem(c *gin.Context) {
 func RemoveCartItem(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		log.Printf("User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		slog.InfoContext(c.Request.Context(), "User ID not found in context")
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
 	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondError(c, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
-	log.Printf("Removing cart item - UserID: %v, ProductID: %v", userID, productID)
-
-	err = models.RemoveFromCart(userID.(int64), productID)
+	err = models.RemoveFromCart(c.Request.Context(), userID.(int64), productID)
 	if err != nil {
-		log.Printf("Failed to remove cart item: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Failed to remove cart item", "error", err)
+		c.Error(err)
 		return
 	}
 
@@ -105,19 +99,59 @@ func RemoveCartItem(c *gin.Context) {
 func ClearCart(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		log.Printf("User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		slog.InfoContext(c.Request.Context(), "User ID not found in context")
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
-	log.Printf("Clearing cart - UserID: %v", userID)
-
-	err := models.ClearCart(userID.(int64))
+	err := models.ClearCart(c.Request.Context(), userID.(int64))
 	if err != nil {
-		log.Printf("Failed to clear cart: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Failed to clear cart", "error", err)
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Cart cleared successfully"})
 }
+
+// GetShippingRates returns the shipping zones and their rate tables
+func GetShippingRates(c *gin.Context) {
+	c.JSON(http.StatusOK, models.GetShippingRates())
+}
+
+// GetShippingQuote calculates the shipping fee for the current cart and a destination
+func GetShippingQuote(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		slog.InfoContext(c.Request.Context(), "User ID not found in context")
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var input struct {
+		Province   string `json:"province" binding:"required"`
+		PostalCode string `json:"postal_code"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		slog.DebugContext(c.Request.Context(), "Invalid cart input", "error", err)
+		c.Error(invalidInput(err))
+		return
+	}
+
+	cart, err := models.GetCartByUserID(c.Request.Context(), userID.(int64))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch cart for shipping quote", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+
+	quote, err := models.QuoteShipping(cart, input.Province, input.PostalCode)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to quote shipping", "error", err)
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
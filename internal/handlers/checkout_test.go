@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/handlers"
+	"go_module/internal/middleware"
+	"go_module/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Checkout runs under the REQUEST_TIMEOUT deadline rather than one of its own
+func TestCheckoutUsesRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		status  int
+		cart    int
+	}{
+		{"deadline passed", time.Nanosecond, http.StatusGatewayTimeout, 1},
+		{"within deadline", time.Minute, http.StatusCreated, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := dbtest.NewUser(t, "customer")
+			if err := models.AddToCart(context.Background(), user.UserID, 1, 1); err != nil {
+				t.Fatal(err)
+			}
+
+			r := gin.New()
+			r.Use(middleware.RequestTimeout(tt.timeout), handlers.ErrorHandler())
+			r.POST("/checkout", func(c *gin.Context) {
+				c.Set("userID", user.UserID)
+			}, handlers.Checkout)
+
+			body, _ := json.Marshal(map[string]interface{}{
+				"shipping_address": dbtest.Address,
+				"payment_method":   models.PaymentCashOnDelivery,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			cart, err := models.GetCartByUserID(context.Background(), user.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cart.Items) != tt.cart {
+				t.Errorf("cart has %d items, want %d", len(cart.Items), tt.cart)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go_module/internal/database"
+	"go_module/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// errorBody is the JSON envelope of every error response. Error is a message
+// safe to show to users, Code a stable machine-readable identifier, and
+// Fields the per-field messages of a validation error.
+type errorBody struct {
+	Error  string            `json:"error"`
+	Code   string            `json:"code"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// statusCodes are the envelope codes of errors responded with a bare status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusTooManyRequests:     "rate_limited",
+	http.StatusUnprocessableEntity: "unprocessable",
+	http.StatusInternalServerError: "internal_error",
+	http.StatusBadGateway:          "bad_gateway",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusGatewayTimeout:      "timeout",
+}
+
+func init() {
+	// Report validation errors by JSON field name rather than struct field
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "" {
+				name = strings.SplitN(f.Tag.Get("form"), ",", 2)[0]
+			}
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// ErrorHandler writes the response for errors attached with c.Error. Model
+// errors are mapped to a status by kind; any other error is logged and
+// reported as an internal error so database and driver messages never reach
+// clients.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		writeError(c)
+	}
+}
+
+// writeError responds with the last error attached to the context, unless a
+// response has already been written
+func writeError(c *gin.Context) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	err := c.Errors.Last().Err
+	status, body := errorResponse(err)
+	if status == http.StatusInternalServerError {
+		slog.ErrorContext(c.Request.Context(), "Internal error", "method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+	}
+	if status == http.StatusServiceUnavailable {
+		c.Header("Retry-After", "1")
+	}
+	var modelErr *models.Error
+	if errors.As(err, &modelErr) && modelErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(modelErr.RetryAfter.Seconds()))))
+	}
+	c.JSON(status, body)
+}
+
+// errorResponse maps an error to its status code and envelope
+func errorResponse(err error) (int, errorBody) {
+	var modelErr *models.Error
+	if errors.As(err, &modelErr) {
+		// Model messages are lower case like other Go errors
+		msg := modelErr.Message
+		if msg != "" {
+			msg = strings.ToUpper(msg[:1]) + msg[1:]
+		}
+
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			return http.StatusNotFound, errorBody{Error: msg, Code: "not_found"}
+		case errors.Is(err, models.ErrOutOfStock):
+			return http.StatusConflict, errorBody{Error: msg, Code: "out_of_stock"}
+		case errors.Is(err, models.ErrConflict):
+			return http.StatusConflict, errorBody{Error: msg, Code: "conflict"}
+		case errors.Is(err, models.ErrUnauthorized):
+			return http.StatusUnauthorized, errorBody{Error: msg, Code: "unauthorized"}
+		case errors.Is(err, models.ErrForbidden):
+			return http.StatusForbidden, errorBody{Error: msg, Code: "forbidden"}
+		case errors.Is(err, models.ErrRateLimited):
+			return http.StatusTooManyRequests, errorBody{Error: msg, Code: "rate_limited"}
+		case errors.Is(err, models.ErrValidation):
+			return http.StatusBadRequest, errorBody{Error: msg, Code: "validation_failed", Fields: modelErr.Fields}
+		}
+	}
+
+	switch {
+	case database.IsBusy(err):
+		return http.StatusServiceUnavailable, errorBody{Error: "The store is busy. Please try again.", Code: "busy"}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusGatewayTimeout, errorBody{Error: "The request timed out. Please try again.", Code: "timeout"}
+	}
+
+	return http.StatusInternalServerError, errorBody{Error: "Internal server error", Code: "internal_error"}
+}
+
+// respondError writes an error response for a failure detected in the
+// handler itself, such as a malformed path parameter or a missing login
+func respondError(c *gin.Context, status int, message string) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+	c.JSON(status, errorBody{Error: message, Code: code})
+}
+
+// invalidInput converts a request binding error into a validation error with
+// a message per offending field
+func invalidInput(err error) error {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return models.ValidationError("invalid request body")
+	}
+
+	fields := make(map[string]string, len(verrs))
+	var messages []string
+	for _, fe := range verrs {
+		msg := fieldMessage(fe)
+		fields[fieldPath(fe)] = msg
+		messages = append(messages, fieldPath(fe)+" "+msg)
+	}
+	return &models.Error{Kind: models.ErrValidation, Message: strings.Join(messages, "; "), Fields: fields}
+}
+
+// fieldPath is the JSON path of a failed field without the top-level struct
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+// fieldMessage describes a failed validation rule
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	}
+	return "is invalid"
+}
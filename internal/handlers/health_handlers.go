@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go_module/internal/database"
+	"go_module/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MinFreeDiskBytes is the free space the data directory needs for the server
+// to report ready
+var MinFreeDiskBytes uint64 = 100 << 20
+
+// readyTimeout bounds the checks made by Readyz
+const readyTimeout = 2 * time.Second
+
+// check is the outcome of one readiness check
+type check struct {
+	Status    string   `json:"status"`
+	Error     string   `json:"error,omitempty"`
+	Pending   []string `json:"pending,omitempty"`
+	FreeBytes *uint64  `json:"free_bytes,omitempty"`
+}
+
+// Healthz reports that the process is up and serving requests. It checks
+// nothing else, so a busy database never gets the server restarted.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the server can handle traffic: the database answers,
+// its schema is fully migrated and the data directory has space left. It
+// answers 503 when any check fails.
+func Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]check{}
+	ready := true
+	fail := func(name string, ch check) {
+		ch.Status = "failed"
+		checks[name] = ch
+		ready = false
+	}
+
+	if err := database.Ping(ctx); err != nil {
+		slog.WarnContext(ctx, "Readiness check failed", "check", "database", "error", err)
+		fail("database", check{Error: "database unavailable"})
+	} else {
+		checks["database"] = check{Status: "ok"}
+	}
+
+	pending, err := database.PendingMigrations(ctx)
+	switch {
+	case err != nil:
+		slog.WarnContext(ctx, "Readiness check failed", "check", "migrations", "error", err)
+		fail("migrations", check{Error: "could not read schema"})
+	case len(pending) > 0:
+		fail("migrations", check{Error: "migrations pending", Pending: pending})
+	default:
+		checks["migrations"] = check{Status: "ok"}
+	}
+
+	free, err := database.FreeDiskBytes()
+	switch {
+	case err != nil:
+		slog.WarnContext(ctx, "Readiness check failed", "check", "disk", "error", err)
+		fail("disk", check{Error: "could not read free space"})
+	case free < MinFreeDiskBytes:
+		fail("disk", check{Error: "low disk space", FreeBytes: &free})
+	default:
+		checks["disk"] = check{Status: "ok", FreeBytes: &free}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
+
+// Metrics serves the Prometheus metrics. With a non-empty token, scrapes must
+// send it as a bearer token.
+func Metrics(token string) gin.HandlerFunc {
+	h := metrics.Handler()
+	return func(c *gin.Context) {
+		if token != "" {
+			got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				respondError(c, http.StatusUnauthorized, "Invalid metrics token")
+				return
+			}
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go_module/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyHeader is the request header clients use to make retries safe
+const IdempotencyHeader = "Idempotency-Key"
+
+// responseRecorder keeps a copy of the response body so it can be replayed
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a route safe to retry. When the request carries an
+// Idempotency-Key, the first response for that key is stored and replayed
+// for later requests with the same key and body. Reusing a key with a
+// different body is rejected, as is a retry while the first request is still
+// running. Server errors and panics are not stored so the client can try
+// again. Must run after AuthMiddleware; keys are scoped to the user. It lives
+// here rather than in the middleware package because it renders handler
+// errors with writeError before storing the response.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IdempotencyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			respondError(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			c.Abort()
+			return
+		}
+
+		userID := c.GetInt64("userID")
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Could not read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		existing, err := models.BeginIdempotentRequest(c.Request.Context(), userID, key, c.Request.Method, c.Request.URL.Path, fingerprint)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to track idempotent request", "error", err)
+			respondError(c, http.StatusInternalServerError, "Failed to process request")
+			c.Abort()
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				respondError(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			case existing.Status != models.IdempotencyCompleted:
+				respondError(c, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+			default:
+				slog.InfoContext(c.Request.Context(), "Replaying idempotent response", "idempotency_key", key, "user_id", userID)
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.ResponseCode, existing.ContentType, existing.ResponseBody)
+			}
+			c.Abort()
+			return
+		}
+
+		// Record the outcome even if the request context has ended, otherwise
+		// the key would stay stuck in processing
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		// Unless a response is stored, release the key, including when the
+		// handler panics
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := models.ReleaseIdempotentRequest(ctx, userID, key); err != nil {
+				slog.ErrorContext(ctx, "Failed to track idempotent request", "error", err)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Render handler errors now so the stored response includes them
+		writeError(c)
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+
+		err = models.CompleteIdempotentRequest(ctx, userID, key, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to track idempotent request", "error", err)
+			return
+		}
+		completed = true
+	}
+}
@@ -0,0 +1,54 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyReleasesKeyAfterPanic(t *testing.T) {
+	user := dbtest.NewUser(t, "customer")
+
+	calls := 0
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.POST("/checkout", func(c *gin.Context) {
+		c.Set("userID", user.UserID)
+	}, handlers.Idempotency(), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/checkout", strings.NewReader(`{"a":1}`))
+		req.Header.Set(handlers.IdempotencyHeader, "panic-key")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first request status = %d, want 500", rec.Code)
+	}
+	if rec := send(); rec.Code != http.StatusCreated {
+		t.Fatalf("retry status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	rec := send()
+	if rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("second retry status = %d, replayed %q; want stored 201", rec.Code, rec.Header().Get("Idempotent-Replayed"))
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,14 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"go_module/internal/dbtest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dbtest.Main(m)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"go_module/internal/models"
+	"go_module/internal/payments"
+	"go_module/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPaymentMethods lists the payment methods available at checkout
+func GetPaymentMethods(c *gin.Context) {
+	c.JSON(http.StatusOK, models.GetPaymentMethods())
+}
+
+// CreateOrderPayment starts an online payment for one of the user's orders
+// through the provider registered for the order's payment method
+func CreateOrderPayment(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	order, err := models.GetOrderByID(c.Request.Context(), orderID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !policy.CanPayOrder(actor, order) {
+		respondError(c, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	if order.PaymentVerified {
+		respondError(c, http.StatusConflict, "Order is already paid")
+		return
+	}
+	if order.Status == "cancelled" {
+		respondError(c, http.StatusConflict, "Order is cancelled")
+		return
+	}
+
+	provider, err := payments.ForMethod(order.PaymentMethod)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Payment method does not support online payment")
+		return
+	}
+
+	payment, err := models.CreatePayment(c.Request.Context(), order.OrderID, provider.Name(), order.PaymentMethod, order.TotalAmount)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create payment", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to start payment")
+		return
+	}
+
+	intent, err := provider.CreateIntent(c.Request.Context(), payments.IntentRequest{
+		OrderID:     order.OrderID,
+		PaymentID:   payment.PaymentID,
+		Method:      order.PaymentMethod,
+		Amount:      order.TotalAmount,
+		Currency:    payment.Currency,
+		Description: "ZaneMNL order #" + strconv.FormatInt(order.OrderID, 10),
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Payment provider failed to create intent", "provider", provider.Name(), "error", err)
+		if markErr := models.MarkPaymentFailed(c.Request.Context(), payment.PaymentID, err.Error()); markErr != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to mark payment as failed", "payment_id", payment.PaymentID, "error", markErr)
+		}
+		respondError(c, http.StatusBadGateway, "Payment provider is unavailable. Please try again.")
+		return
+	}
+
+	if err := models.SetPaymentIntent(c.Request.Context(), payment.PaymentID, intent); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to store payment intent", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to start payment")
+		return
+	}
+
+	payment, err = models.GetPaymentByID(c.Request.Context(), payment.PaymentID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to reload payment", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to start payment")
+		return
+	}
+
+	c.JSON(http.StatusCreated, payment)
+}
+
+// GetOrderPayments lists the payment attempts for one of the user's orders,
+// or for any order when the caller is an admin
+func GetOrderPayments(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	order, err := models.GetOrderByID(c.Request.Context(), orderID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !policy.CanViewOrder(actor, order) {
+		respondError(c, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	result, err := models.GetPaymentsByOrderID(c.Request.Context(), orderID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch payments", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to fetch payments")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// PaymentWebhook receives signed notifications from a payment provider
+func PaymentWebhook(c *gin.Context) {
+	provider, err := payments.Get(c.Param("provider"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Unknown payment provider")
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Could not read request body")
+		return
+	}
+
+	event, err := provider.HandleWebhook(payload, c.Request.Header)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Rejected payment webhook", "provider", provider.Name(), "error", err)
+		respondError(c, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	payment, err := models.ApplyPaymentEvent(c.Request.Context(), provider.Name(), event)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to apply payment webhook", "provider", provider.Name(), "event_id", event.ID, "error", err)
+		// Non-2xx makes the provider redeliver the event
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true, "status": payment.Status})
+}
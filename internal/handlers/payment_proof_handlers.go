@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go_module/internal/models"
+	"go_module/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxProofSize is the largest receipt image accepted
+const maxProofSize = 5 << 20
+
+// maxProofRequestSize caps the whole upload: the image plus the reference
+// field and multipart headers
+const maxProofRequestSize = maxProofSize + 64<<10
+
+// proofImageTypes maps accepted receipt image types to file extensions
+var proofImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// paymentProofDir returns the directory receipt images are stored in
+func paymentProofDir() string {
+	if dir := os.Getenv("PAYMENT_PROOF_DIR"); dir != "" {
+		return dir
+	}
+	return "./data/payment_proofs"
+}
+
+// SubmitPaymentProof accepts a receipt image and reference number for one of
+// the user's bank transfer or GCash orders
+func SubmitPaymentProof(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	// Refuse orders that can't take a proof before reading the upload
+	if _, err := models.CheckPaymentProofOrder(c.Request.Context(), userID.(int64), orderID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxProofRequestSize)
+	if err := c.Request.ParseMultipartForm(maxProofSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, "Receipt image must be 5MB or smaller")
+			return
+		}
+		respondError(c, http.StatusBadRequest, "Expected a multipart form with a receipt image")
+		return
+	}
+
+	reference := strings.TrimSpace(c.PostForm("reference"))
+	if reference == "" || len(reference) > 100 {
+		respondError(c, http.StatusBadRequest, "A reference number of up to 100 characters is required")
+		return
+	}
+
+	header, err := c.FormFile("image")
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "A receipt image is required")
+		return
+	}
+	if header.Size > maxProofSize {
+		respondError(c, http.StatusRequestEntityTooLarge, "Receipt image must be 5MB or smaller")
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Could not read receipt image")
+		return
+	}
+	defer file.Close()
+
+	// Trust the file contents rather than the client's declared type
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(file, sniff)
+	contentType := http.DetectContentType(sniff[:n])
+	ext, ok := proofImageTypes[contentType]
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Receipt must be a JPEG, PNG or WebP image")
+		return
+	}
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate file name", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to save payment proof")
+		return
+	}
+	path := filepath.Join(paymentProofDir(), fmt.Sprintf("order-%d-%s%s", orderID, hex.EncodeToString(name), ext))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create payment proof directory", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to save payment proof")
+		return
+	}
+	if err := c.SaveUploadedFile(header, path); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save payment proof image", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to save payment proof")
+		return
+	}
+
+	proof, err := models.CreatePaymentProof(c.Request.Context(), userID.(int64), orderID, reference, path, contentType)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create payment proof", "error", err)
+		if rmErr := os.Remove(path); rmErr != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to remove payment proof image", "path", path, "error", rmErr)
+		}
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, proof)
+}
+
+// GetMyPaymentProofs lists the proof-of-payment submissions for one of the
+// user's orders, or for any order when the caller is an admin
+func GetMyPaymentProofs(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	order, err := models.GetOrderByID(c.Request.Context(), orderID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !policy.CanViewOrder(actor, order) {
+		respondError(c, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	proofs, err := models.GetPaymentProofsByOrderID(c.Request.Context(), orderID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch payment proofs", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to fetch payment proofs")
+		return
+	}
+
+	c.JSON(http.StatusOK, proofs)
+}
+
+// AdminGetPaymentProofs returns the proof-of-payment review queue. The status
+// query defaults to pending; "all" lists every submission.
+func AdminGetPaymentProofs(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ProofPending)
+	switch status {
+	case models.ProofPending, models.ProofApproved, models.ProofRejected:
+	case "all":
+		status = ""
+	default:
+		respondError(c, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	proofs, err := models.GetPaymentProofsByStatus(c.Request.Context(), status)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch payment proofs", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to fetch payment proofs")
+		return
+	}
+
+	c.JSON(http.StatusOK, proofs)
+}
+
+// AdminGetPaymentProofImage serves the receipt image for a submission
+func AdminGetPaymentProofImage(c *gin.Context) {
+	proofID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid payment proof ID")
+		return
+	}
+
+	proof, err := models.GetPaymentProofByID(c.Request.Context(), proofID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Content-Type", proof.ContentType)
+	c.File(proof.ImagePath)
+}
+
+// AdminApprovePaymentProof approves a submission and verifies the order payment
+func AdminApprovePaymentProof(c *gin.Context) {
+	reviewPaymentProof(c, true, "")
+}
+
+// AdminRejectPaymentProof rejects a submission with a reason shown to the
+// customer, who may then submit again
+func AdminRejectPaymentProof(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, http.StatusBadRequest, "A rejection reason is required")
+		return
+	}
+
+	reviewPaymentProof(c, false, strings.TrimSpace(input.Reason))
+}
+
+// reviewPaymentProof applies an admin decision to the proof in the :id param
+func reviewPaymentProof(c *gin.Context, approve bool, reason string) {
+	adminID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	proofID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid payment proof ID")
+		return
+	}
+
+	proof, err := models.ReviewPaymentProof(c.Request.Context(), proofID, adminID.(int64), approve, reason)
+	if err != nil {
+		slog.DebugContext(c.Request.Context(), "Failed to review payment proof", "proof_id", proofID, "error", err)
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, proof)
+}
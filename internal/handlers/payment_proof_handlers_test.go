@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/handlers"
+	"go_module/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pngHeader is enough of a PNG file for content sniffing
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// submitProof uploads a receipt image as userID and returns the response
+func submitProof(t *testing.T, userID, orderID int64, image []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("reference", "REF-123")
+	part, err := w.CreateFormFile("image", "receipt.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(image)
+	w.Close()
+
+	r := gin.New()
+	r.Use(handlers.ErrorHandler())
+	r.POST("/orders/:id/payment-proof", func(c *gin.Context) {
+		c.Set("userID", userID)
+	}, handlers.SubmitPaymentProof)
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/orders/%d/payment-proof", orderID), &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSubmitPaymentProof(t *testing.T) {
+	owner := dbtest.NewUser(t, "customer")
+	other := dbtest.NewUser(t, "customer")
+	order := dbtest.PlaceOrder(t, owner.UserID, models.PaymentBankTransfer)
+	oversized := append(append([]byte{}, pngHeader...), make([]byte, 6<<20)...)
+
+	tests := []struct {
+		name   string
+		userID int64
+		image  []byte
+		status int
+		saved  int
+	}{
+		{"other customer's order", other.UserID, pngHeader, http.StatusNotFound, 0},
+		{"image too large", owner.UserID, oversized, http.StatusRequestEntityTooLarge, 0},
+		{"accepted", owner.UserID, pngHeader, http.StatusCreated, 1},
+		{"already awaiting review", owner.UserID, pngHeader, http.StatusConflict, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("PAYMENT_PROOF_DIR", dir)
+
+			rec := submitProof(t, tt.userID, order.OrderID, tt.image)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			files, _ := os.ReadDir(dir)
+			if len(files) != tt.saved {
+				t.Errorf("saved %d images, want %d", len(files), tt.saved)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"go_module/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentActor returns the caller that AuthMiddleware authenticated
+func currentActor(c *gin.Context) (policy.Actor, bool) {
+	userID := c.GetInt64("userID")
+	if userID == 0 {
+		return policy.Actor{}, false
+	}
+	return policy.Actor{UserID: userID, Role: c.GetString("role")}, true
+}
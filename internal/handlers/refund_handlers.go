@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_module/internal/models"
+	"go_module/internal/payments"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminCreateRefund issues a full or per-line partial refund for an order.
+// Refunds to the original payment are sent through the payment provider
+// that captured it.
+func AdminCreateRefund(c *gin.Context) {
+	adminID, exists := c.Get("userID")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	var input struct {
+		Full    bool                `json:"full"`
+		Items   []models.RefundLine `json:"items" binding:"dive"`
+		Reason  string              `json:"reason" binding:"required"`
+		Method  string              `json:"method" binding:"required"`
+		Restock bool                `json:"restock"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	// Find the captured payment before recording anything
+	var payment *models.Payment
+	var provider payments.Provider
+	if input.Method == models.RefundMethodOriginal {
+		payment, err = capturedPayment(c.Request.Context(), orderID)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to fetch payments for refund", "order_id", orderID, "error", err)
+			respondError(c, http.StatusInternalServerError, "Failed to issue refund")
+			return
+		}
+		if payment == nil {
+			respondError(c, http.StatusBadRequest, "Order has no online payment to refund; choose another refund method")
+			return
+		}
+		provider, err = payments.Get(payment.Provider)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Payment provider "+payment.Provider+" is not available")
+			return
+		}
+	}
+
+	refund, err := models.CreateRefund(c.Request.Context(), orderID, adminID.(int64), models.RefundRequest{
+		Full:    input.Full,
+		Items:   input.Items,
+		Reason:  strings.TrimSpace(input.Reason),
+		Method:  input.Method,
+		Restock: input.Restock,
+	})
+	if err != nil {
+		slog.DebugContext(c.Request.Context(), "Failed to create refund", "order_id", orderID, "error", err)
+		c.Error(err)
+		return
+	}
+
+	if provider != nil {
+		result, err := provider.Refund(c.Request.Context(), payment.ProviderRef, refund.Amount)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Payment provider failed to refund", "provider", provider.Name(), "payment_id", payment.PaymentID, "error", err)
+			if failErr := models.FailRefund(c.Request.Context(), refund.RefundID, err.Error()); failErr != nil {
+				slog.ErrorContext(c.Request.Context(), "Failed to mark refund as failed", "refund_id", refund.RefundID, "error", failErr)
+			}
+			respondError(c, http.StatusBadGateway, "Payment provider rejected the refund. Please try again.")
+			return
+		}
+
+		if err := models.CompleteRefund(c.Request.Context(), refund.RefundID, result.ProviderRef); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to complete refund", "refund_id", refund.RefundID, "error", err)
+			respondError(c, http.StatusInternalServerError, "Refund was sent but could not be recorded")
+			return
+		}
+
+		refund, err = models.GetRefundByID(c.Request.Context(), refund.RefundID)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to reload refund", "error", err)
+			respondError(c, http.StatusInternalServerError, "Failed to fetch refund")
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, refund)
+}
+
+// capturedPayment returns the order's successful provider payment, if any
+func capturedPayment(ctx context.Context, orderID int64) (*models.Payment, error) {
+	attempts, err := models.GetPaymentsByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range attempts {
+		if attempts[i].Status == payments.StatusSucceeded && attempts[i].ProviderRef != "" {
+			return &attempts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// AdminGetOrderRefunds lists the refunds issued for an order
+func AdminGetOrderRefunds(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	if _, err := models.GetOrderByID(c.Request.Context(), orderID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	refunds, err := models.GetRefundsByOrderID(c.Request.Context(), orderID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch refunds", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to fetch refunds")
+		return
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
+
+// AdminGetRefunds lists refunds issued within a date range
+func AdminGetRefunds(c *gin.Context) {
+	// Default to the last 30 days
+	end := c.DefaultQuery("end", time.Now().Format("2006-01-02"))
+	start := c.DefaultQuery("start", time.Now().AddDate(0, 0, -30).Format("2006-01-02"))
+
+	if _, err := time.Parse("2006-01-02", start); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid start date, expected YYYY-MM-DD")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", end); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid end date, expected YYYY-MM-DD")
+		return
+	}
+
+	refunds, err := models.GetRefunds(c.Request.Context(), start, end)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch refunds", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to fetch refunds")
+		return
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go_module/internal/models"
+	"go_module/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleInput is the request body for creating or updating a role
+type roleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description" binding:"max=200"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// AdminGetPermissions lists every permission a role can grant
+func AdminGetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Permissions)
+}
+
+// AdminGetRoles lists the roles and their permissions
+func AdminGetRoles(c *gin.Context) {
+	roles, err := models.GetRoles(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// AdminCreateRole defines a custom role
+func AdminCreateRole(c *gin.Context) {
+	var input roleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	role, err := models.CreateRole(c.Request.Context(), input.Name, input.Description, input.Permissions)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// AdminUpdateRole replaces a role's description and permissions
+func AdminUpdateRole(c *gin.Context) {
+	var input roleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	role, err := models.UpdateRole(c.Request.Context(), c.Param("name"), input.Description, input.Permissions)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// AdminDeleteRole removes a custom role that no user has
+func AdminDeleteRole(c *gin.Context) {
+	if err := models.DeleteRole(c.Request.Context(), c.Param("name")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// AdminGetUsers lists user accounts with their roles
+func AdminGetUsers(c *gin.Context) {
+	users, err := models.GetUsers(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// AdminSetUserRole assigns a role to a user. The user's sessions are revoked
+// so the new role applies from their next login.
+func AdminSetUserRole(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	user, err := models.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !models.RoleExists(input.Role) {
+		c.Error(models.FieldError("role", "unknown role: %s", input.Role))
+		return
+	}
+	if !policy.CanAssignRole(actor, user.UserID, user.Role, input.Role) {
+		respondError(c, http.StatusForbidden, "You cannot assign this role to this user")
+		return
+	}
+
+	user, err = models.SetUserRole(c.Request.Context(), userID, input.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
@@ -1,15 +1,15 @@
 package handlers
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
+	"go_module/internal/metrics"
 	"go_module/internal/models"
+	"go_module/internal/policy"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,46 +23,74 @@ func RegisterUser(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("Registration input validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.DebugContext(c.Request.Context(), "Invalid registration input", "error", err)
+		c.Error(invalidInput(err))
 		return
 	}
 
-	log.Printf("Attempting to register user: %s, email: %s", input.Username, input.Email)
+	slog.DebugContext(c.Request.Context(), "Registering user", "username", input.Username, "email", input.Email)
 
 	// Create user
-	user, err := models.CreateUser(input.Username, input.Email, input.Password, "customer")
+	user, err := models.CreateUser(c.Request.Context(), input.Username, input.Email, input.Password, "customer")
 	if err != nil {
-		log.Printf("Failed to create user: %v", err)
-		if strings.Contains(err.Error(), "UNIQUE constraint") {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already exists"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Failed to create user", "error", err)
+		c.Error(err)
 		return
 	}
 
+	// The account can't log in until the address is confirmed
+	go sendAccountEmail(c.Request.Context(), user, models.TokenVerifyEmail)
+
 	c.JSON(http.StatusCreated, user)
 }
 
-// Get user by ID
+// Get user by ID. Customers can only see their own profile.
 func GetUser(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		respondError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Other users' profiles are reported as missing so IDs can't be probed
+	if !policy.CanViewUser(actor, id) {
+		respondError(c, http.StatusNotFound, "User not found")
 		return
 	}
 
-	user, err := models.GetUserByID(id)
+	user, err := models.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, user)
 }
 
-// LoginUser handles user authentication and returns a JWT token
+// GetMe returns the profile of the logged-in user
+func GetMe(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	user, err := models.GetUserByID(c.Request.Context(), actor.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// LoginUser authenticates a user, starts a session and returns its tokens
 func LoginUser(c *gin.Context) {
 	var input struct {
 		Email    string `json:"email" binding:"required,email"`
@@ -70,27 +98,30 @@ func LoginUser(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidInput(err))
 		return
 	}
 
-	user, token, err := models.AuthenticateUser(input.Email, input.Password)
+	user, err := models.AuthenticateUser(c.Request.Context(), input.Email, input.Password, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	session, refreshToken, err := models.CreateSession(c.Request.Context(), user.UserID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respondWithTokens(c, user, session, refreshToken)
 }
 
 // GetProducts returns a list of all products
 func GetProducts(c *gin.Context) {
-	products, err := models.GetAllProducts()
+	products, err := models.GetAllProducts(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		respondError(c, http.StatusInternalServerError, "Failed to fetch products")
 		return
 	}
 
@@ -101,13 +132,13 @@ func GetProducts(c *gin.Context) {
 func GetProduct(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondError(c, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
-	product, err := models.GetProductByID(id)
+	product, err := models.GetProductByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		c.Error(err)
 		return
 	}
 
@@ -118,8 +149,8 @@ func GetProduct(c *gin.Context) {
 func AddToCart(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		log.Printf("AddToCart: User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		slog.InfoContext(c.Request.Context(), "AddToCart: User ID not found in context")
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
@@ -129,29 +160,16 @@ func AddToCart(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("AddToCart: Invalid input for AddToCart: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.DebugContext(c.Request.Context(), "Invalid add to cart input", "error", err)
+		c.Error(invalidInput(err))
 		return
 	}
 
-	log.Printf("AddToCart: Adding to cart - UserID: %v, ProductID: %v, Quantity: %v", userID, input.ProductID, input.Quantity)
-
 	// Try to add to cart
-	err := models.AddToCart(userID.(int64), input.ProductID, input.Quantity)
+	err := models.AddToCart(c.Request.Context(), userID.(int64), input.ProductID, input.Quantity)
 	if err != nil {
-		log.Printf("AddToCart: Failed to add to cart: %v", err)
-
-		// Check for specific error types and return appropriate status codes
-		if strings.Contains(err.Error(), "insufficient stock") {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		if strings.Contains(err.Error(), "product not found") {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-			return
-		}
-
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add item to cart. Please try again."})
+		slog.DebugContext(c.Request.Context(), "Failed to add to cart", "error", err)
+		c.Error(err)
 		return
 	}
 
@@ -162,20 +180,18 @@ func AddToCart(c *gin.Context) {
 func GetCart(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		log.Printf("GetCart: User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		slog.InfoContext(c.Request.Context(), "GetCart: User ID not found in context")
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
-	log.Printf("GetCart: Fetching cart for userID: %v", userID)
-	cart, err := models.GetCartByUserID(userID.(int64))
+	cart, err := models.GetCartByUserID(c.Request.Context(), userID.(int64))
 	if err != nil {
-		log.Printf("GetCart: Failed to fetch cart: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		slog.DebugContext(c.Request.Context(), "Failed to fetch cart", "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to fetch cart")
 		return
 	}
 
-	log.Printf("GetCart: Successfully fetched cart for userID: %v with %d items", userID, len(cart.Items))
 	c.JSON(http.StatusOK, cart)
 }
 
@@ -183,88 +199,85 @@ func GetCart(c *gin.Context) {
 func Checkout(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		log.Printf("User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		slog.InfoContext(c.Request.Context(), "User ID not found in context")
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
+	// Either a saved address from the address book or a new address is required
 	var input struct {
-		ShippingAddress struct {
-			FullName    string `json:"full_name" binding:"required"`
-			PhoneNumber string `json:"phone_number" binding:"required"`
-			Address     string `json:"address" binding:"required"`
-			City        string `json:"city" binding:"required"`
-			Province    string `json:"province" binding:"required"`
-			PostalCode  string `json:"postal_code" binding:"required"`
-		} `json:"shipping_address" binding:"required"`
-		PaymentMethod string `json:"payment_method" binding:"required"`
+		AddressID       int64           `json:"address_id"`
+		ShippingAddress *models.Address `json:"shipping_address"`
+		PaymentMethod   string          `json:"payment_method" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("Invalid checkout input: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.DebugContext(c.Request.Context(), "Invalid checkout input", "error", err)
+		c.Error(invalidInput(err))
 		return
 	}
 
-	// Format shipping address as a single string
-	shippingAddress := fmt.Sprintf("%s\n%s\n%s\n%s, %s %s",
-		input.ShippingAddress.FullName,
-		input.ShippingAddress.PhoneNumber,
-		input.ShippingAddress.Address,
-		input.ShippingAddress.City,
-		input.ShippingAddress.Province,
-		input.ShippingAddress.PostalCode,
-	)
-
-	log.Printf("Creating order for userID: %v with shipping address: %v", userID, shippingAddress)
-	log.Printf("Payment method: %v", input.PaymentMethod)
-
-	// Set a timeout for the order creation process
-	orderChan := make(chan *models.Order, 1)
-	errChan := make(chan error, 1)
-
-	// Create the order in a separate goroutine
-	go func() {
-		order, err := models.CreateOrder(userID.(int64), shippingAddress, input.PaymentMethod)
+	var address models.Address
+	switch {
+	case input.AddressID != 0:
+		saved, err := models.GetAddress(c.Request.Context(), userID.(int64), input.AddressID)
 		if err != nil {
-			errChan <- err
+			slog.ErrorContext(c.Request.Context(), "Failed to load saved address", "error", err)
+			c.Error(err)
 			return
 		}
-		orderChan <- order
-	}()
-
-	// Wait for the order to be created or timeout
-	select {
-	case order := <-orderChan:
-		log.Printf("Order created successfully: %+v", order)
-		c.JSON(http.StatusCreated, order)
-	case err := <-errChan:
-		log.Printf("Failed to create order: %v", err)
-
-		// Check for specific error types
-		if strings.Contains(err.Error(), "cart is empty") {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Your cart is empty. Please add items before checkout."})
+		address = *saved
+	case input.ShippingAddress != nil:
+		address = *input.ShippingAddress
+	default:
+		respondError(c, http.StatusBadRequest, "shipping_address or address_id is required")
+		return
+	}
+
+	if err := address.Validate(); err != nil {
+		c.Error(err)
+		return
+	}
+
+	slog.DebugContext(c.Request.Context(), "Checking out", "user_id", userID, "payment_method", input.PaymentMethod, "shipping_address", address.String())
+
+	// The order is created under the request's context, which carries the
+	// REQUEST_TIMEOUT deadline. If the client disconnects or the deadline
+	// passes, the transaction rolls back, so a timeout response never hides
+	// an order committed later.
+	ctx := c.Request.Context()
+	order, err := models.CreateOrder(ctx, userID.(int64), address, input.PaymentMethod)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create order", "error", err)
+
+		if ctx.Err() != nil {
+			slog.InfoContext(ctx, "Order creation cancelled", "user_id", userID, "error", ctx.Err())
+			metrics.CheckoutFailed("timeout")
+			respondError(c, http.StatusGatewayTimeout, "Order creation timed out. Please try again.")
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-	case <-time.After(25 * time.Second):
-		log.Printf("Order creation timed out for userID: %v", userID)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Order creation timed out. Please try again."})
+		_, body := errorResponse(err)
+		metrics.CheckoutFailed(body.Code)
+		c.Error(err)
+		return
 	}
+
+	metrics.CheckoutSucceeded()
+	c.JSON(http.StatusCreated, order)
 }
 
 // GetOrders retrieves all orders for the current user
 func GetOrders(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
-	orders, err := models.GetOrdersByUserID(userID.(int64))
+	orders, err := models.GetOrdersByUserID(c.Request.Context(), userID.(int64))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		respondError(c, http.StatusInternalServerError, "Failed to fetch orders")
 		return
 	}
 
@@ -279,8 +292,8 @@ func CreateProduct(c *gin.Context) {
 	if strings.HasPrefix(contentType, "multipart/form-data") {
 		// Handle form data request
 		if err := c.Request.ParseMultipartForm(10 << 20); err != nil { // 10MB max
-			log.Printf("Error parsing multipart form: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not parse form data"})
+			slog.ErrorContext(c.Request.Context(), "Error parsing multipart form", "error", err)
+			respondError(c, http.StatusBadRequest, "Could not parse form data")
 			return
 		}
 
@@ -291,27 +304,28 @@ func CreateProduct(c *gin.Context) {
 		priceStr := getFormValue(form, "Price")
 		stockStr := getFormValue(form, "Stock")
 		imageURL := getFormValue(form, "ImageURL")
+		taxClass := getFormValue(form, "TaxClass")
 
 		// Parse numeric values
 		price, err := strconv.ParseFloat(priceStr, 64)
 		if err != nil {
-			log.Printf("Invalid product price: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price format"})
+			slog.DebugContext(c.Request.Context(), "Invalid product price", "error", err)
+			respondError(c, http.StatusBadRequest, "Invalid price format")
 			return
 		}
 
 		stock, err := strconv.Atoi(stockStr)
 		if err != nil {
-			log.Printf("Invalid product stock: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stock format"})
+			slog.DebugContext(c.Request.Context(), "Invalid product stock", "error", err)
+			respondError(c, http.StatusBadRequest, "Invalid stock format")
 			return
 		}
 
 		// Create the product
-		product, err := models.CreateProduct(name, description, price, imageURL, stock)
+		product, err := models.CreateProduct(c.Request.Context(), name, description, price, imageURL, stock, taxClass)
 		if err != nil {
-			log.Printf("Failed to create product: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			slog.ErrorContext(c.Request.Context(), "Failed to create product", "error", err)
+			c.Error(err)
 			return
 		}
 
@@ -326,18 +340,19 @@ func CreateProduct(c *gin.Context) {
 			Stock       int     `json:"stock" binding:"required,min=0"`
 			Category    string  `json:"category" binding:"omitempty"`
 			Brand       string  `json:"brand" binding:"omitempty"`
+			TaxClass    string  `json:"tax_class" binding:"omitempty,oneof=standard zero_rated exempt"`
 		}
 
 		if err := c.ShouldBindJSON(&input); err != nil {
-			log.Printf("Invalid product input: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			slog.DebugContext(c.Request.Context(), "Invalid product input", "error", err)
+			c.Error(invalidInput(err))
 			return
 		}
 
-		product, err := models.CreateProduct(input.Name, input.Description, input.Price, input.ImageURL, input.Stock)
+		product, err := models.CreateProduct(c.Request.Context(), input.Name, input.Description, input.Price, input.ImageURL, input.Stock, input.TaxClass)
 		if err != nil {
-			log.Printf("Failed to create product: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			slog.ErrorContext(c.Request.Context(), "Failed to create product", "error", err)
+			c.Error(err)
 			return
 		}
 
@@ -357,7 +372,7 @@ func getFormValue(form *multipart.Form, key string) string {
 func UpdateProduct(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondError(c, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
@@ -367,8 +382,8 @@ func UpdateProduct(c *gin.Context) {
 	if strings.HasPrefix(contentType, "multipart/form-data") {
 		// Handle form data request
 		if err := c.Request.ParseMultipartForm(10 << 20); err != nil { // 10MB max
-			log.Printf("Error parsing multipart form: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not parse form data"})
+			slog.ErrorContext(c.Request.Context(), "Error parsing multipart form", "error", err)
+			respondError(c, http.StatusBadRequest, "Could not parse form data")
 			return
 		}
 
@@ -379,27 +394,28 @@ func UpdateProduct(c *gin.Context) {
 		priceStr := getFormValue(form, "Price")
 		stockStr := getFormValue(form, "Stock")
 		imageURL := getFormValue(form, "ImageURL")
+		taxClass := getFormValue(form, "TaxClass")
 
 		// Parse numeric values
 		price, err := strconv.ParseFloat(priceStr, 64)
 		if err != nil {
-			log.Printf("Invalid product price: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price format"})
+			slog.DebugContext(c.Request.Context(), "Invalid product price", "error", err)
+			respondError(c, http.StatusBadRequest, "Invalid price format")
 			return
 		}
 
 		stock, err := strconv.Atoi(stockStr)
 		if err != nil {
-			log.Printf("Invalid product stock: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stock format"})
+			slog.DebugContext(c.Request.Context(), "Invalid product stock", "error", err)
+			respondError(c, http.StatusBadRequest, "Invalid stock format")
 			return
 		}
 
 		// Update the product
-		product, err := models.UpdateProduct(id, name, description, price, imageURL, stock)
+		product, err := models.UpdateProduct(c.Request.Context(), id, name, description, price, imageURL, stock, taxClass)
 		if err != nil {
-			log.Printf("Failed to update product: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			slog.ErrorContext(c.Request.Context(), "Failed to update product", "error", err)
+			c.Error(err)
 			return
 		}
 
@@ -412,16 +428,17 @@ func UpdateProduct(c *gin.Context) {
 			Price       float64 `json:"price" binding:"omitempty,min=0.01"`
 			ImageURL    string  `json:"image_url"`
 			Stock       int     `json:"stock" binding:"omitempty,min=0"`
+			TaxClass    string  `json:"tax_class" binding:"omitempty,oneof=standard zero_rated exempt"`
 		}
 
 		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Error(invalidInput(err))
 			return
 		}
 
-		product, err := models.UpdateProduct(id, input.Name, input.Description, input.Price, input.ImageURL, input.Stock)
+		product, err := models.UpdateProduct(c.Request.Context(), id, input.Name, input.Description, input.Price, input.ImageURL, input.Stock, input.TaxClass)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+			c.Error(err)
 			return
 		}
 
@@ -433,46 +450,35 @@ func UpdateProduct(c *gin.Context) {
 func DeleteProduct(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondError(c, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
 	// Add logging to help track the delete operation
-	log.Printf("DeleteProduct: Starting deletion of product with ID: %d", id)
 
 	// Check if product exists first
-	product, err := models.GetProductByID(id)
-	if err != nil {
-		log.Printf("DeleteProduct: Error checking product existence: %v", err)
-		if err.Error() == "sql: no rows in result set" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+	if _, err := models.GetProductByID(c.Request.Context(), id); err != nil {
+		slog.DebugContext(c.Request.Context(), "Failed to check product before deleting", "product_id", id, "error", err)
+		c.Error(err)
 		return
 	}
 
-	if product == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-		return
-	}
-
-	err = models.DeleteProduct(id)
+	err = models.DeleteProduct(c.Request.Context(), id)
 	if err != nil {
-		log.Printf("DeleteProduct: Error deleting product: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete product: %v", err)})
+		slog.DebugContext(c.Request.Context(), "Failed to delete product", "product_id", id, "error", err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("DeleteProduct: Successfully deleted product with ID: %d", id)
+	slog.InfoContext(c.Request.Context(), "Product deleted", "product_id", id)
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
 
 // GetAllOrders retrieves all orders in the system (admin only)
 func GetAllOrders(c *gin.Context) {
-	orders, err := models.GetAllOrders()
+	orders, err := models.GetAllOrders(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		respondError(c, http.StatusInternalServerError, "Failed to fetch orders")
 		return
 	}
 
@@ -483,29 +489,24 @@ func GetAllOrders(c *gin.Context) {
 func UpdateOrderStatus(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		respondError(c, http.StatusBadRequest, "Invalid order ID")
 		return
 	}
 
 	var input struct {
-		Status string `json:"status" binding:"required"`
+		Status         string `json:"status" binding:"required"`
+		TrackingNumber string `json:"tracking_number" binding:"max=100"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidInput(err))
 		return
 	}
 
-	log.Printf("Updating order %d status to: %s", id, input.Status)
-
-	err = models.UpdateOrderStatus(id, input.Status)
+	err = models.UpdateOrderStatus(c.Request.Context(), id, input.Status, input.TrackingNumber)
 	if err != nil {
-		log.Printf("Failed to update order status: %v", err)
-		if err.Error() == "order not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Failed to update order status", "error", err)
+		c.Error(err)
 		return
 	}
 
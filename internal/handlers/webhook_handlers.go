@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go_module/internal/events"
+	"go_module/internal/models"
+	"go_module/internal/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webhookInput is the request body for creating or updating a webhook
+type webhookInput struct {
+	URL         string   `json:"url" binding:"required,max=500"`
+	Description string   `json:"description" binding:"max=200"`
+	Events      []string `json:"events" binding:"required"`
+	Active      *bool    `json:"active"`
+}
+
+// webhookID parses the :id route parameter, responding with 400 when it is
+// not a number
+func webhookID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid webhook ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// AdminGetWebhookEvents lists the event types webhooks can subscribe to
+func AdminGetWebhookEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, events.Types)
+}
+
+// AdminGetWebhooks lists the webhooks, without their secrets
+func AdminGetWebhooks(c *gin.Context) {
+	hooks, err := models.GetWebhooks(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+// AdminCreateWebhook subscribes an endpoint to events. The response carries
+// the signing secret, which is not shown again.
+func AdminCreateWebhook(c *gin.Context) {
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	hook, err := models.CreateWebhook(c.Request.Context(), input.URL, input.Description, input.Events)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, hook)
+}
+
+// AdminGetWebhook returns one webhook without its secret
+func AdminGetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	hook, err := models.GetWebhookByID(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// AdminUpdateWebhook replaces a webhook's URL, description and events, and
+// turns it on or off. Leaving out active keeps the current setting.
+func AdminUpdateWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(invalidInput(err))
+		return
+	}
+
+	active := true
+	if input.Active != nil {
+		active = *input.Active
+	} else {
+		current, err := models.GetWebhookByID(c.Request.Context(), id)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		active = current.Active
+	}
+
+	hook, err := models.UpdateWebhook(c.Request.Context(), id, input.URL, input.Description, input.Events, active)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// AdminDeleteWebhook removes a webhook and its delivery log
+func AdminDeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteWebhook(c.Request.Context(), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// AdminRotateWebhookSecret replaces a webhook's signing secret and returns
+// the new one
+func AdminRotateWebhookSecret(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	hook, err := models.RotateWebhookSecret(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// AdminPingWebhook queues a test delivery for a webhook
+func AdminPingWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := webhooks.Ping(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// AdminGetWebhookDeliveries returns a webhook's delivery log, newest first.
+// ?status= filters by status and ?limit= caps the count (default 50, at
+// most 200).
+func AdminGetWebhookDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		respondError(c, http.StatusBadRequest, "limit must be between 1 and 200")
+		return
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(c.Request.Context(), id, c.Query("status"), limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// AdminGetWebhookDelivery returns one delivery with its payload and the
+// endpoint's last response
+func AdminGetWebhookDelivery(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := models.GetWebhookDelivery(c.Request.Context(), id, deliveryID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// AdminReplayWebhookDelivery sends an earlier delivery's payload again as a
+// new delivery
+func AdminReplayWebhookDelivery(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := webhooks.Replay(c.Request.Context(), id, deliveryID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
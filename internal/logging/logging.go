@@ -0,0 +1,161 @@
+// Package logging sets up structured logging with log/slog.
+//
+// Setup installs a default logger that writes text or JSON lines, drops
+// records below the configured level, redacts secrets and personal data,
+// and adds the request ID and trace ID from the context to every record
+// logged with one of slog's Context functions (slog.InfoContext and so on).
+// Code that still uses the log package ends up in the same output at info
+// level.
+//
+// Redaction goes by attribute key, so values that must not be logged should
+// be passed as attributes rather than formatted into the message: passwords,
+// tokens, secrets, cookies and Authorization headers are replaced with
+// [REDACTED], addresses are dropped, and email addresses and phone numbers
+// are masked.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config is how logs are written
+type Config struct {
+	// Format is "text" for human-readable lines or "json" for one JSON
+	// object per line
+	Format string
+	Level  slog.Level
+}
+
+// ConfigFromEnv reads LOG_FORMAT (text or json) and LOG_LEVEL (debug, info,
+// warn or error). The format defaults to json when APP_ENV is production
+// and text otherwise; the level defaults to info.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Format: "text", Level: slog.LevelInfo}
+	if os.Getenv("APP_ENV") == "production" {
+		cfg.Format = "json"
+	}
+
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		if v != "text" && v != "json" {
+			return cfg, fmt.Errorf("invalid LOG_FORMAT %q: expected text or json", v)
+		}
+		cfg.Format = v
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := cfg.Level.UnmarshalText([]byte(v)); err != nil {
+			return cfg, fmt.Errorf("invalid LOG_LEVEL %q: expected debug, info, warn or error", v)
+		}
+	}
+	return cfg, nil
+}
+
+// Setup makes a logger writing to w the default for slog and the log
+// package, and returns it
+func Setup(w io.Writer, cfg Config) *slog.Logger {
+	logger := slog.New(NewHandler(w, cfg))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// NewHandler returns the handler Setup installs
+func NewHandler(w io.Writer, cfg Config) slog.Handler {
+	opts := &slog.HandlerOptions{Level: cfg.Level, ReplaceAttr: redact}
+	if cfg.Format == "json" {
+		return contextHandler{slog.NewJSONHandler(w, opts)}
+	}
+	return contextHandler{slog.NewTextHandler(w, opts)}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying a request ID for log records
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID and trace ID from the context to each
+// record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() && sc.IsSampled() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Redacted replaces values that must never be logged
+const Redacted = "[REDACTED]"
+
+// secretKeys are parts of attribute keys whose values are always redacted
+var secretKeys = []string{"password", "secret", "token", "authorization", "cookie", "api_key"}
+
+// redact is the ReplaceAttr hook that hides secrets and personal data
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, Redacted)
+		}
+	}
+
+	switch {
+	case key == "email" || strings.HasSuffix(key, "_email"):
+		return slog.String(a.Key, MaskEmail(a.Value.String()))
+	case key == "phone" || strings.HasSuffix(key, "phone_number"):
+		return slog.String(a.Key, MaskPhone(a.Value.String()))
+	case key == "address" || (strings.HasSuffix(key, "_address") && key != "ip_address"):
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// MaskEmail keeps the first letter and the domain of an email address, so
+// juan@example.com becomes j***@example.com
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return Redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// MaskPhone keeps the last four digits of a phone number
+func MaskPhone(phone string) string {
+	if len(phone) <= 4 {
+		return Redacted
+	}
+	return "***" + phone[len(phone)-4:]
+}
+
+// Fatal logs an error and exits, for failures the server can't start with
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// LogMailer writes every message to the log instead of sending it. It is
+// the default, so nothing leaves the machine until a mailer is configured.
+type LogMailer struct{}
+
+// NewLogMailer creates a mailer that only logs messages
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send implements Mailer
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "Email", "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return nil
+}
+
+// FileMailer saves every message as an .eml file in a directory, where it
+// can be opened in a mail client or read by tests
+type FileMailer struct {
+	Dir  string
+	From string
+	seq  atomic.Int64
+}
+
+// NewFileMailer creates a mailer that writes messages to dir
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{Dir: dir, From: from}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+// Send implements Mailer
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %v", err)
+	}
+
+	data, err := compose(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%04d-%s.eml",
+		time.Now().UTC().Format("20060102T150405.000"), m.seq.Add(1)%10000,
+		unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %v", err)
+	}
+
+	slog.InfoContext(ctx, "Email saved", "to", msg.To, "path", path, "subject", msg.Subject)
+	return nil
+}
@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Message is an email with a plain text body and an optional HTML
+// alternative
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer is implemented by each way of delivering email (SMTP, a local
+// file sink, the log). Mailers only deliver; deciding what to send and
+// retrying is left to the caller.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	current Mailer = NewLogMailer()
+)
+
+// Use makes m the mailer used by Send
+func Use(m Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = m
+}
+
+// Send delivers a message with the configured mailer
+func Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return fmt.Errorf("message has no recipient")
+	}
+
+	mu.RLock()
+	m := current
+	mu.RUnlock()
+	return m.Send(ctx, msg)
+}
+
+// LoadConfig selects the mailer from the environment. MAIL_TRANSPORT is
+// "log" (the default), "file" to save messages under MAIL_DIR, or "smtp" to
+// send through SMTP_ADDR with SMTP_USERNAME and SMTP_PASSWORD. MAIL_FROM is
+// the sender address.
+func LoadConfig() error {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "ZaneMNL <no-reply@localhost>"
+	}
+
+	switch transport := os.Getenv("MAIL_TRANSPORT"); transport {
+	case "", "log":
+		Use(NewLogMailer())
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./data/mail"
+		}
+		Use(NewFileMailer(dir, from))
+		slog.Info("Saving outgoing email to files", "dir", dir)
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return fmt.Errorf("MAIL_TRANSPORT=smtp requires SMTP_ADDR")
+		}
+		Use(NewSMTPMailer(addr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from))
+		slog.Info("Sending email through SMTP", "addr", addr)
+	default:
+		return fmt.Errorf("unknown MAIL_TRANSPORT %q (want log, file or smtp)", transport)
+	}
+	return nil
+}
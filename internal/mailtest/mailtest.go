@@ -0,0 +1,107 @@
+// Package mailtest captures outgoing email in memory for tests.
+//
+// Install a Sink in place of the configured mailer, trigger the behaviour
+// under test, then inspect what would have been sent. Order emails are only
+// sent when their events are dispatched, so call events.DispatchPending
+// first; account emails are sent in the background, so use WaitFor.
+package mailtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go_module/internal/mail"
+)
+
+// Sink is a mailer that keeps every message instead of sending it
+type Sink struct {
+	mu       sync.Mutex
+	messages []mail.Message
+	failures []error
+	changed  chan struct{}
+}
+
+// Install makes a new, empty Sink the mailer used by mail.Send and returns
+// it
+func Install() *Sink {
+	s := &Sink{changed: make(chan struct{})}
+	mail.Use(s)
+	return s
+}
+
+// Send implements mail.Mailer. It fails instead if FailNext queued an error.
+func (s *Sink) Send(ctx context.Context, msg mail.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.failures) > 0 {
+		err := s.failures[0]
+		s.failures = s.failures[1:]
+		return err
+	}
+
+	s.messages = append(s.messages, msg)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return nil
+}
+
+// FailNext makes the next n sends fail with err, such as to check that the
+// event dispatcher retries them
+func (s *Sink) FailNext(n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, err)
+	}
+}
+
+// Messages returns every message sent so far
+func (s *Sink) Messages() []mail.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mail.Message(nil), s.messages...)
+}
+
+// To returns the messages sent to an address
+func (s *Sink) To(addr string) []mail.Message {
+	var found []mail.Message
+	for _, m := range s.Messages() {
+		if strings.EqualFold(m.To, addr) {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// Reset forgets every message and queued failure
+func (s *Sink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	s.failures = nil
+}
+
+// WaitFor returns the first message matching match, waiting for one to be
+// sent until ctx ends
+func (s *Sink) WaitFor(ctx context.Context, match func(mail.Message) bool) (mail.Message, error) {
+	for {
+		s.mu.Lock()
+		for _, m := range s.messages {
+			if match(m) {
+				s.mu.Unlock()
+				return m, nil
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return mail.Message{}, fmt.Errorf("no matching email was sent: %v", ctx.Err())
+		}
+	}
+}
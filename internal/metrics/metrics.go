@@ -0,0 +1,122 @@
+// Package metrics exposes the server's Prometheus metrics.
+//
+// Request latency and checkout outcomes are recorded as they happen. Database
+// pool stats, SQLite busy retries, orders per status and free disk space are
+// read when Prometheus scrapes, so Register must run after the database is
+// open.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go_module/internal/database"
+	"go_module/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	checkouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "store_checkouts_total",
+		Help: "Checkouts that reached order creation, by result and, for failures, error code.",
+	}, []string{"result", "reason"})
+
+	ordersDesc = prometheus.NewDesc(
+		"store_orders",
+		"Number of orders in each status.",
+		[]string{"status"}, nil,
+	)
+)
+
+// scrapeTimeout bounds the database queries made while serving a scrape
+const scrapeTimeout = 5 * time.Second
+
+// Register adds the standard Go and process metrics and the metrics read from
+// the database to Registry. It must be called once, after database.InitDB.
+func Register() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(database.DB, "writer"),
+		collectors.NewDBStatsCollector(database.ReadDB, "reader"),
+		requestDuration,
+		checkouts,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "store_db_busy_retries_total",
+			Help: "Write transactions retried because SQLite was locked.",
+		}, func() float64 {
+			return float64(database.BusyRetries())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "store_data_disk_free_bytes",
+			Help: "Free space on the file system holding the data directory.",
+		}, func() float64 {
+			free, err := database.FreeDiskBytes()
+			if err != nil {
+				return -1
+			}
+			return float64(free)
+		}),
+		orderCollector{},
+	)
+}
+
+// Handler serves the metrics in Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records how long a request took. route is the route
+// pattern, never the raw path, so the number of series stays bounded.
+func ObserveRequest(method, route string, status int, d time.Duration) {
+	requestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// CheckoutSucceeded counts a checkout that created an order
+func CheckoutSucceeded() {
+	checkouts.WithLabelValues("success", "").Inc()
+}
+
+// CheckoutFailed counts a checkout that failed to create an order. reason is
+// the error code sent to the client, such as out_of_stock.
+func CheckoutFailed(reason string) {
+	checkouts.WithLabelValues("failure", reason).Inc()
+}
+
+// orderCollector reports the number of orders in each status, counted at
+// scrape time
+type orderCollector struct{}
+
+func (orderCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ordersDesc
+}
+
+func (orderCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	counts, err := models.CountOrdersByStatus(ctx)
+	if err != nil {
+		slog.Error("Failed to collect order metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(ordersDesc, err)
+		return
+	}
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(ordersDesc, prometheus.GaugeValue, float64(n), status)
+	}
+}
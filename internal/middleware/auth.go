@@ -2,132 +2,173 @@ package middleware
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"go_module/internal/models"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// Simple hardcoded secret key - this is fine for a lab project
-// In a real app, this would come from environment variables
-var secretKey = []byte("your-secret-key-here")
+// Issuer and audience written to and required of every access token
+const (
+	TokenIssuer   = "go_module"
+	TokenAudience = "go_module-api"
+)
 
-// For development purposes only - set to true to bypass authentication
-var DevMode = false
+// AccessTokenTTL is how long an access token is accepted. Access tokens are
+// kept short-lived and renewed with the session's refresh token.
+var AccessTokenTTL = 15 * time.Minute
 
-// Generate JWT token
-func GenerateToken(userID int64, role string) (string, error) {
-	log.Printf("Generating token for userID: %d, role: %s", userID, role)
+// Claims are the claims of an access token
+type Claims struct {
+	UserID    int64  `json:"user_id"`
+	Role      string `json:"role"`
+	SessionID int64  `json:"sid"`
+	jwt.RegisteredClaims
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"role":    role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // 24 hour expiration
+// GenerateToken issues an access token for a user's session, signed with the
+// active key
+func GenerateToken(userID int64, role string, sessionID int64) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(activeKey.Method, Claims{
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			Subject:   strconv.FormatInt(userID, 10),
+			Audience:  jwt.ClaimStrings{TokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		},
 	})
+	token.Header["kid"] = activeKey.ID
 
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString(activeKey.signKey)
 	if err != nil {
-		log.Printf("Token signing failed: %v", err)
-		return "", err
+		return "", fmt.Errorf("failed to sign token: %v", err)
 	}
-
-	log.Printf("Token generated successfully")
 	return tokenString, nil
 }
 
-// Auth middleware
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// In development mode, bypass authentication
-		if DevMode {
-			// Set a default admin user
-			log.Printf("WARNING: DevMode is enabled, using admin user (ID: 1) for all requests")
-			c.Set("userID", int64(1))
-			c.Set("role", "admin")
-			c.Next()
-			return
+// ParseToken verifies an access token's signature against the key named by
+// its kid header and validates its claims. The error is meant for logs;
+// clients only get told that the token is invalid.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := verifyingKey[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
 		}
+		// The key decides the algorithm, never the token
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		authHeader := c.GetHeader("Authorization")
-		log.Printf("Auth header received: %s", authHeader)
+	// RegisteredClaims.Valid only checks the time claims
+	if !claims.VerifyIssuer(TokenIssuer, true) {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(TokenAudience, true) {
+		return nil, fmt.Errorf("unexpected audience %v", claims.Audience)
+	}
+	if claims.ExpiresAt == nil || claims.NotBefore == nil {
+		return nil, fmt.Errorf("token has no exp or nbf claim")
+	}
+	if claims.UserID <= 0 || claims.SessionID <= 0 || claims.Role == "" {
+		return nil, fmt.Errorf("token is missing user, session or role claims")
+	}
+	return claims, nil
+}
 
-		if authHeader == "" {
-			log.Printf("No auth header")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
-		}
+// bearerToken returns the token of a "Bearer" Authorization header
+func bearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", fmt.Errorf("authorization header is required")
+	}
+
+	token, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok || token == "" {
+		return "", fmt.Errorf("invalid authorization header format")
+	}
+	return token, nil
+}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			log.Printf("Invalid auth format: %v", parts)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+// Auth middleware
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := bearerToken(c.Request)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required", "code": "unauthorized"})
 			c.Abort()
 			return
 		}
 
-		token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-			// Don't forget to validate the alg is what you expect
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				log.Printf("Unexpected signing method: %v", token.Header["alg"])
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return secretKey, nil
-		})
-
+		claims, err := ParseToken(tokenString)
 		if err != nil {
-			log.Printf("Token parsing failed: %v", err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			slog.InfoContext(c.Request.Context(), "Rejected access token", "method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "code": "unauthorized"})
 			c.Abort()
 			return
 		}
 
-		if !token.Valid {
-			log.Printf("Token invalid")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		// The session must still be active and belong to the token's user.
+		// The role claim is only informational; permissions follow the
+		// user's current role.
+		role, active, err := models.SessionRole(c.Request.Context(), claims.SessionID, claims.UserID)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to check session", "session_id", claims.SessionID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error", "code": "internal_error"})
 			c.Abort()
 			return
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			log.Printf("Failed to get claims")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked", "code": "unauthorized"})
 			c.Abort()
 			return
 		}
 
-		userID := int64(claims["user_id"].(float64))
-		role := claims["role"].(string)
-		log.Printf("Token validated for userID: %v, role: %v", userID, role)
-		c.Set("userID", userID)
+		c.Set("userID", claims.UserID)
 		c.Set("role", role)
+		c.Set("sessionID", claims.SessionID)
+
+		// Writes made for this request are attributed to the user in the
+		// audit log
+		c.Request = c.Request.WithContext(models.WithActor(c.Request.Context(), claims.UserID, c.ClientIP()))
 
 		c.Next()
 	}
 }
 
-// Admin middleware
-func AdminMiddleware() gin.HandlerFunc {
+// RequirePermission allows only users whose role grants a permission. It
+// must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// In development mode, bypass admin check
-		if DevMode {
-			c.Next()
-			return
-		}
-
 		role, exists := c.Get("role")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized", "code": "unauthorized"})
 			c.Abort()
 			return
 		}
 
-		if role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		roleName, _ := role.(string)
+		if !models.RoleHasPermission(roleName, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission required: " + permission, "code": "forbidden"})
 			c.Abort()
 			return
 		}
@@ -137,43 +178,17 @@ func AdminMiddleware() gin.HandlerFunc {
 }
 
 // GetUserIDFromRequest extracts the user ID from the JWT token in a standard HTTP request
-// This can be used outside of Gin context if needed
+// This can be used outside of Gin context if needed. It validates the token the
+// same way as AuthMiddleware, apart from the session revocation check.
 func GetUserIDFromRequest(r *http.Request) (int64, error) {
-	// Get the Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return 0, fmt.Errorf("authorization header is required")
-	}
-
-	// Check if the header has the Bearer prefix
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return 0, fmt.Errorf("invalid authorization header format")
-	}
-
-	// Extract the token
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-	// Parse the token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return secretKey, nil
-	})
-
+	tokenString, err := bearerToken(r)
 	if err != nil {
 		return 0, err
 	}
 
-	// Extract claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Get the user ID from claims
-		if userID, ok := claims["user_id"].(float64); ok {
-			return int64(userID), nil
-		}
-		return 0, fmt.Errorf("user ID not found in token")
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return 0, err
 	}
-
-	return 0, fmt.Errorf("invalid token")
+	return claims.UserID, nil
 }
@@ -0,0 +1,164 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go_module/internal/authtest"
+	"go_module/internal/dbtest"
+	"go_module/internal/middleware"
+	"go_module/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// authRouter serves GET /whoami behind AuthMiddleware, answering with the
+// user and role the middleware set
+func authRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/whoami", middleware.AuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt64("userID"), "role": c.GetString("role")})
+	})
+	return r
+}
+
+// get requests /whoami with an Authorization header, if any
+func get(t *testing.T, authorization string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	authRouter().ServeHTTP(rec, req)
+	return rec
+}
+
+// newSession logs a user in and returns the session ID
+func newSession(t *testing.T, userID int64) int64 {
+	t.Helper()
+	session, _, err := models.CreateSession(context.Background(), userID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session.SessionID
+}
+
+// token signs an access token with the active key
+func token(t *testing.T, userID int64, role string, sessionID int64) string {
+	t.Helper()
+	tok, err := middleware.GenerateToken(userID, role, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + tok
+}
+
+func TestAuthMiddlewareRejectsAnotherUsersSession(t *testing.T) {
+	victim := dbtest.NewUser(t, "admin")
+	attacker := dbtest.NewUser(t, "customer")
+
+	// A token naming the attacker but carrying the admin's session ID
+	rec := get(t, token(t, attacker.UserID, "customer", newSession(t, victim.UserID)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401: %s", rec.Code, rec.Body)
+	}
+
+	// And the reverse: the admin's user ID on the attacker's session
+	rec = get(t, token(t, victim.UserID, "admin", newSession(t, attacker.UserID)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAuthMiddlewareUsesCurrentRole(t *testing.T) {
+	user := dbtest.NewUser(t, "customer")
+
+	rec := get(t, token(t, user.UserID, "admin", newSession(t, user.UserID)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if want := `"role":"customer"`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("body = %s, want %s", rec.Body, want)
+	}
+}
+
+// forge signs claims for a user's session with any method, key and kid
+func forge(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, userID, sessionID int64) string {
+	t.Helper()
+	now := time.Now()
+	tok := jwt.NewWithClaims(method, middleware.Claims{
+		UserID:    userID,
+		Role:      "customer",
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    middleware.TokenIssuer,
+			Audience:  jwt.ClaimStrings{middleware.TokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	})
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	signed, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	user := dbtest.NewUser(t, "customer")
+	sessionID := newSession(t, user.UserID)
+
+	valid, err := authtest.MintToken(context.Background(), user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := authtest.MintToken(context.Background(), user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := middleware.ParseToken(revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.RevokeSession(context.Background(), claims.SessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"valid token", "Bearer " + valid, http.StatusOK},
+		{"forged claims signed with the active key", forge(t, jwt.SigningMethodHS256, []byte("your-secret-key-here"), "dev", user.UserID, sessionID), http.StatusOK},
+		{"missing token", "", http.StatusUnauthorized},
+		{"not a bearer token", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"garbage", "Bearer not-a-token", http.StatusUnauthorized},
+		{"wrong key", forge(t, jwt.SigningMethodHS256, []byte("some-other-secret-of-32-bytes!!!"), "dev", user.UserID, sessionID), http.StatusUnauthorized},
+		{"wrong algorithm", forge(t, jwt.SigningMethodHS512, []byte("your-secret-key-here"), "dev", user.UserID, sessionID), http.StatusUnauthorized},
+		{"alg none", forge(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "dev", user.UserID, sessionID), http.StatusUnauthorized},
+		{"unknown kid", forge(t, jwt.SigningMethodHS256, []byte("your-secret-key-here"), "other", user.UserID, sessionID), http.StatusUnauthorized},
+		{"no kid", forge(t, jwt.SigningMethodHS256, []byte("your-secret-key-here"), "", user.UserID, sessionID), http.StatusUnauthorized},
+		{"revoked session", "Bearer " + revoked, http.StatusUnauthorized},
+		{"unknown session", token(t, user.UserID, "customer", 1<<40), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(t, tt.authorization)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
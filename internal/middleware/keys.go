@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// signingKey is one key in the token key set, identified in tokens by the
+// kid header. Keys without a private half can only verify tokens; they keep
+// tokens signed before a rotation valid until they expire.
+type signingKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// keyConfig is an entry of the JWT_KEYS_CONFIG file. HS256 keys take a
+// secret; EdDSA and RS256 keys take PEM files, and a key with only a public
+// key file is accepted for verification but never used for signing.
+type keyConfig struct {
+	ID             string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	Secret         string `json:"secret"`
+	PrivateKeyFile string `json:"private_key_file"`
+	PublicKeyFile  string `json:"public_key_file"`
+}
+
+// keySetConfig is the JWT_KEYS_CONFIG file: the keys accepted for
+// verification and the kid of the one new tokens are signed with
+type keySetConfig struct {
+	Active string      `json:"active"`
+	Keys   []keyConfig `json:"keys"`
+}
+
+// Simple hardcoded secret key - this is fine for a lab project
+// In a real app, this would come from JWT_KEYS_CONFIG
+var devKey = &signingKey{
+	ID:        "dev",
+	Method:    jwt.SigningMethodHS256,
+	signKey:   []byte("your-secret-key-here"),
+	verifyKey: []byte("your-secret-key-here"),
+}
+
+var (
+	activeKey    = devKey
+	verifyingKey = map[string]*signingKey{devKey.ID: devKey}
+)
+
+// LoadSigningKeys replaces the development key with the key set in the file
+// named by JWT_KEYS_CONFIG. The development key's secret is public, so
+// without JWT_KEYS_CONFIG it is an error unless allowDevKey is set.
+func LoadSigningKeys(allowDevKey bool) error {
+	path := os.Getenv("JWT_KEYS_CONFIG")
+	if path == "" {
+		if !allowDevKey {
+			return fmt.Errorf("JWT_KEYS_CONFIG is not set; the development key is only allowed with --dev")
+		}
+		slog.Warn("JWT_KEYS_CONFIG is not set, signing tokens with the development key")
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWT key config: %v", err)
+	}
+
+	var cfg keySetConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse JWT key config: %v", err)
+	}
+
+	keys := make(map[string]*signingKey, len(cfg.Keys))
+	for _, kc := range cfg.Keys {
+		if kc.ID == "" {
+			return fmt.Errorf("JWT key config has an entry without a kid")
+		}
+		if _, ok := keys[kc.ID]; ok {
+			return fmt.Errorf("JWT key config has duplicate kid %q", kc.ID)
+		}
+		key, err := loadKey(kc)
+		if err != nil {
+			return fmt.Errorf("JWT key %q: %v", kc.ID, err)
+		}
+		keys[kc.ID] = key
+	}
+
+	active, ok := keys[cfg.Active]
+	if !ok {
+		return fmt.Errorf("JWT key config: active key %q is not in the key set", cfg.Active)
+	}
+	if active.signKey == nil {
+		return fmt.Errorf("JWT key config: active key %q has no private key", cfg.Active)
+	}
+
+	activeKey = active
+	verifyingKey = keys
+	slog.Info("Loaded JWT keys", "count", len(keys), "path", path, "signing_key", active.ID, "alg", active.Method.Alg())
+	return nil
+}
+
+// loadKey builds a signing key from its config entry
+func loadKey(kc keyConfig) (*signingKey, error) {
+	key := &signingKey{ID: kc.ID}
+
+	switch kc.Algorithm {
+	case "HS256":
+		if len(kc.Secret) < 32 {
+			return nil, fmt.Errorf("HS256 secret must be at least 32 bytes")
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.signKey = []byte(kc.Secret)
+		key.verifyKey = []byte(kc.Secret)
+		return key, nil
+
+	case "EdDSA":
+		key.Method = jwt.SigningMethodEdDSA
+		if kc.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read private key: %v", err)
+			}
+			priv, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("invalid private key: %v", err)
+			}
+			key.signKey = priv
+			if signer, ok := priv.(crypto.Signer); ok {
+				key.verifyKey = signer.Public()
+			}
+		}
+		if kc.PublicKeyFile != "" {
+			pem, err := os.ReadFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read public key: %v", err)
+			}
+			pub, err := jwt.ParseEdPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("invalid public key: %v", err)
+			}
+			key.verifyKey = pub
+		}
+
+	case "RS256":
+		key.Method = jwt.SigningMethodRS256
+		if kc.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read private key: %v", err)
+			}
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("invalid private key: %v", err)
+			}
+			key.signKey = priv
+			key.verifyKey = &priv.PublicKey
+		}
+		if kc.PublicKeyFile != "" {
+			pem, err := os.ReadFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read public key: %v", err)
+			}
+			pub, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("invalid public key: %v", err)
+			}
+			key.verifyKey = pub
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q (use HS256, EdDSA or RS256)", kc.Algorithm)
+	}
+
+	if key.verifyKey == nil {
+		return nil, fmt.Errorf("a public or private key file is required")
+	}
+	return key, nil
+}
@@ -0,0 +1,18 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"go_module/internal/middleware"
+)
+
+func TestLoadSigningKeysRequiresConfigOutsideDev(t *testing.T) {
+	t.Setenv("JWT_KEYS_CONFIG", "")
+
+	if err := middleware.LoadSigningKeys(false); err == nil {
+		t.Error("LoadSigningKeys accepted the development key outside --dev")
+	}
+	if err := middleware.LoadSigningKeys(true); err != nil {
+		t.Errorf("LoadSigningKeys in --dev: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/tracetest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// spans records the request spans the Tracing middleware starts
+var spans *tracetest.Recorder
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	spans = tracetest.Install()
+	dbtest.Main(m)
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"go_module/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the latency of every request by route. Requests that match
+// no route share the "unmatched" label, and nonstandard methods the "OTHER"
+// label, so scans for random paths or methods can't create new series.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(metricMethod(c.Request.Method), route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// metricMethod returns the method label for a request method: the method
+// itself if it is a standard one, OTHER if not
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
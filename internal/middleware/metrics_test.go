@@ -0,0 +1,42 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go_module/internal/metrics"
+	"go_module/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Clients choose the method, so only the standard ones get their own series
+func TestMetricsMethodLabel(t *testing.T) {
+	metrics.Register()
+
+	r := gin.New()
+	r.Use(middleware.Metrics())
+	r.Handle("BREW", "/pot", func(c *gin.Context) { c.Status(http.StatusTeapot) })
+	r.GET("/pot", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, method := range []string{"BREW", "brew", http.MethodGet} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/pot", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`http_request_duration_seconds_count{method="OTHER",route="/pot",status="418"} 1`,
+		`http_request_duration_seconds_count{method="OTHER",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/pot",status="200"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+	if strings.Contains(body, `method="BREW"`) || strings.Contains(body, `method="brew"`) {
+		t.Error("a nonstandard method got its own series")
+	}
+}
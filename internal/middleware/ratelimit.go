@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"go_module/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc picks the bucket a request is counted against. An empty key
+// exempts the request.
+type KeyFunc func(c *gin.Context) string
+
+// ByIP counts requests per client IP. Forwarded headers are only believed
+// from the engine's trusted proxies (TRUSTED_PROXIES), so a client can't
+// spread its requests over made-up addresses.
+func ByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// malformedKey is the bucket of requests whose key field is missing or not a
+// string. They share one bucket rather than going unlimited.
+const malformedKey = "!malformed"
+
+// ByJSONField counts requests per value of a field in the JSON body, such
+// as the account a login is for. The value is used exactly as given, the way
+// accounts are looked up by email, and the body is left for the handler to
+// read. Bodies without the field as a string share one bucket.
+func ByJSONField(field string) KeyFunc {
+	return func(c *gin.Context) string {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		if err != nil {
+			return malformedKey
+		}
+
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			return malformedKey
+		}
+		value, ok := fields[field].(string)
+		if !ok || value == "" {
+			return malformedKey
+		}
+		return value
+	}
+}
+
+// RateLimit rejects requests with 429 and a Retry-After header once the
+// bucket picked by key is empty. Buckets are named name:key in store, so
+// one store can hold several limits. A nil store turns limiting off. If the
+// store fails the request is let through, so an outage of a shared store
+// doesn't take logins down with it.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, key KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store == nil {
+			c.Next()
+			return
+		}
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter, err := store.Take(c.Request.Context(), name+":"+k, limit)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Rate limiter failed, allowing request", "limiter", name, "error", err)
+			c.Next()
+			return
+		}
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests. Please try again later.", "code": "rate_limited"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
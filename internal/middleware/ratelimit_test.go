@@ -0,0 +1,56 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go_module/internal/middleware"
+	"go_module/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A body without the email as a string must not escape the per-account limit
+func TestRateLimitByJSONField(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		other string // a body that shares the bucket
+	}{
+		{"email", `{"email":"a@example.com"}`, `{"email":"a@example.com","password":"x"}`},
+		{"number", `{"email":1}`, `{"email":2}`},
+		{"array", `{"email":["a@example.com"]}`, `{"email":{"x":1}}`},
+		{"missing", `{}`, `{"email":""}`},
+		{"not JSON", `email=a@example.com`, `{"email":null}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			limit := ratelimit.Limit{Burst: 1, Per: time.Hour}
+			r.POST("/login", middleware.RateLimit(ratelimit.NewMemoryStore(), "login-account", limit, middleware.ByJSONField("email")),
+				func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+			for i, body := range []string{tt.body, tt.other} {
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body)))
+				want := http.StatusNoContent
+				if i > 0 {
+					want = http.StatusTooManyRequests
+				}
+				if rec.Code != want {
+					t.Fatalf("request %d (%s): status = %d, want %d", i+1, body, rec.Code, want)
+				}
+			}
+
+			// Other accounts have their own bucket
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"b@example.com"}`)))
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("other account: status = %d, want %d", rec.Code, http.StatusNoContent)
+			}
+		})
+	}
+}
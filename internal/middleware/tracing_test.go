@@ -0,0 +1,84 @@
+package middleware_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go_module/internal/middleware"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTracing(t *testing.T) {
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.Tracing())
+	r.GET("/orders/:id", func(c *gin.Context) {
+		// Work done for the request joins its trace
+		if !trace.SpanFromContext(c.Request.Context()).SpanContext().IsValid() {
+			t.Error("request context has no span")
+		}
+		c.Status(http.StatusOK)
+	})
+	r.POST("/orders/:id/pay", func(c *gin.Context) {
+		c.Error(errors.New("gateway exploded"))
+		c.Status(http.StatusInternalServerError)
+	})
+
+	serve := func(method, path string) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set("X-Request-ID", "req-"+method)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	spans.Reset()
+	serve(http.MethodGet, "/orders/42")
+	serve(http.MethodPost, "/orders/42/pay")
+
+	get := spans.Find("GET /orders/:id")
+	if get == nil {
+		t.Fatalf("no span named after the route in %v", spans.Names())
+	}
+	if got := get.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the incoming traceparent's", got)
+	}
+	if got := get.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s, want the incoming traceparent's", got)
+	}
+	if get.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span kind = %v, want server", get.SpanKind())
+	}
+	attrs := map[string]string{}
+	for _, kv := range get.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	for key, want := range map[string]string{
+		"http.route":                       "/orders/:id",
+		"url.path":                         "/orders/42",
+		"http.response.status_code":        "200",
+		"http.request.header.x-request-id": "req-GET",
+	} {
+		if attrs[key] != want {
+			t.Errorf("attribute %s = %q, want %q", key, attrs[key], want)
+		}
+	}
+	if get.Status().Code != codes.Unset {
+		t.Errorf("status = %v, want unset", get.Status().Code)
+	}
+
+	pay := spans.Find("POST /orders/:id/pay")
+	if pay == nil {
+		t.Fatalf("no span for the failed request in %v", spans.Names())
+	}
+	if pay.Status().Code != codes.Error {
+		t.Errorf("status of a 500 = %v, want error", pay.Status().Code)
+	}
+	if events := pay.Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("events = %v, want the handler's error recorded", events)
+	}
+}
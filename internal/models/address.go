@@ -0,0 +1,357 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go_module/internal/database"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Address is a structured Philippine shipping address. Saved addresses belong
+// to a user's address book; orders keep a copy taken at checkout.
+type Address struct {
+	AddressID   int64     `json:"address_id,omitempty"`
+	UserID      int64     `json:"user_id,omitempty"`
+	Label       string    `json:"label,omitempty"`
+	FullName    string    `json:"full_name"`
+	PhoneNumber string    `json:"phone_number"`
+	AddressLine string    `json:"address"`
+	City        string    `json:"city"`
+	Province    string    `json:"province"`
+	PostalCode  string    `json:"postal_code"`
+	IsDefault   bool      `json:"is_default"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+// ShippingDetails is the structured address copied onto an order at checkout
+type ShippingDetails struct {
+	FullName    string `json:"full_name"`
+	PhoneNumber string `json:"phone_number"`
+	AddressLine string `json:"address"`
+	City        string `json:"city"`
+	Province    string `json:"province"`
+	PostalCode  string `json:"postal_code"`
+}
+
+var (
+	// Mobile (09XX XXX XXXX / +63 9XX XXX XXXX), or a landline: Metro Manila
+	// (02) XXXX XXXX and provincial (0XX) XXX XXXX both have nine digits after
+	// the trunk prefix
+	mobilePattern   = regexp.MustCompile(`^(?:09|\+639|639)\d{9}$`)
+	landlinePattern = regexp.MustCompile(`^(?:0|\+63|63)[2-8]\d{8}$`)
+	postalPattern   = regexp.MustCompile(`^\d{4}$`)
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+)
+
+// NormalizePhoneNumber strips separators and rewrites mobile numbers to the
+// 09XXXXXXXXX form. It returns an error for numbers that are not valid in the
+// Philippines.
+func NormalizePhoneNumber(phone string) (string, error) {
+	p := phoneSeparators.Replace(strings.TrimSpace(phone))
+
+	if mobilePattern.MatchString(p) {
+		switch {
+		case strings.HasPrefix(p, "+63"):
+			p = "0" + p[3:]
+		case strings.HasPrefix(p, "63"):
+			p = "0" + p[2:]
+		}
+		return p, nil
+	}
+
+	if landlinePattern.MatchString(p) {
+		return p, nil
+	}
+
+	return "", FieldError("phone_number", "invalid phone number: expected a Philippine mobile (09XXXXXXXXX) or landline number")
+}
+
+// Validate checks required fields, the phone number and the postal code, and
+// normalises the values in place
+func (a *Address) Validate() error {
+	a.FullName = strings.TrimSpace(a.FullName)
+	a.AddressLine = strings.TrimSpace(a.AddressLine)
+	a.City = strings.TrimSpace(a.City)
+	a.Province = strings.TrimSpace(a.Province)
+	a.PostalCode = strings.TrimSpace(a.PostalCode)
+	a.Label = strings.TrimSpace(a.Label)
+
+	switch {
+	case a.FullName == "":
+		return FieldError("full_name", "full name is required")
+	case a.AddressLine == "":
+		return FieldError("address", "address is required")
+	case a.City == "":
+		return FieldError("city", "city is required")
+	case a.Province == "":
+		return FieldError("province", "province is required")
+	}
+
+	phone, err := NormalizePhoneNumber(a.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	a.PhoneNumber = phone
+
+	if !postalPattern.MatchString(a.PostalCode) {
+		return FieldError("postal_code", "invalid postal code: expected 4 digits")
+	}
+
+	return nil
+}
+
+// String formats the address as the multi-line text printed on labels
+func (a Address) String() string {
+	return fmt.Sprintf("%s\n%s\n%s\n%s, %s %s",
+		a.FullName, a.PhoneNumber, a.AddressLine, a.City, a.Province, a.PostalCode)
+}
+
+// Snapshot returns the address fields stored on an order
+func (a Address) Snapshot() *ShippingDetails {
+	return &ShippingDetails{
+		FullName:    a.FullName,
+		PhoneNumber: a.PhoneNumber,
+		AddressLine: a.AddressLine,
+		City:        a.City,
+		Province:    a.Province,
+		PostalCode:  a.PostalCode,
+	}
+}
+
+// addressColumns is the column list scanAddress expects
+const addressColumns = `AddressID, UserID, Label, FullName, PhoneNumber, AddressLine,
+	City, Province, PostalCode, IsDefault, CreatedAt, UpdatedAt`
+
+// scanAddress reads one row selected with addressColumns
+func scanAddress(row interface{ Scan(...interface{}) error }) (*Address, error) {
+	var a Address
+	var label sql.NullString
+	var createdAt, updatedAt string
+
+	err := row.Scan(
+		&a.AddressID,
+		&a.UserID,
+		&label,
+		&a.FullName,
+		&a.PhoneNumber,
+		&a.AddressLine,
+		&a.City,
+		&a.Province,
+		&a.PostalCode,
+		&a.IsDefault,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if label.Valid {
+		a.Label = label.String
+	}
+	a.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	a.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+
+	return &a, nil
+}
+
+// GetAddressesByUserID returns a user's saved addresses, default first
+func GetAddressesByUserID(ctx context.Context, userID int64) ([]Address, error) {
+	ctx, span := startSpan(ctx, "models.GetAddressesByUserID")
+	defer span.End()
+
+	rows, err := database.ReadDB.QueryContext(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE UserID = ?
+		ORDER BY IsDefault DESC, AddressID
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch addresses: %v", err)
+	}
+	defer rows.Close()
+
+	addresses := []Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan address: %v", err)
+		}
+		addresses = append(addresses, *a)
+	}
+
+	return addresses, rows.Err()
+}
+
+// GetAddress returns a saved address owned by the user
+func GetAddress(ctx context.Context, userID, addressID int64) (*Address, error) {
+	ctx, span := startSpan(ctx, "models.GetAddress")
+	defer span.End()
+
+	a, err := scanAddress(database.ReadDB.QueryRowContext(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE AddressID = ? AND UserID = ?
+	`, addressID, userID))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("address not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch address: %v", err)
+	}
+	return a, nil
+}
+
+// CreateAddress saves a new address for the user. The first address a user
+// saves becomes the default.
+func CreateAddress(ctx context.Context, userID int64, a Address) (*Address, error) {
+	ctx, span := startSpan(ctx, "models.CreateAddress")
+	defer span.End()
+
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		isDefault := a.IsDefault
+
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM addresses WHERE UserID = ?", userID).Scan(&count); err != nil {
+			return fmt.Errorf("failed to count addresses: %v", err)
+		}
+		if count == 0 {
+			isDefault = true
+		}
+
+		if isDefault {
+			if _, err := tx.ExecContext(ctx, "UPDATE addresses SET IsDefault = 0 WHERE UserID = ?", userID); err != nil {
+				return fmt.Errorf("failed to clear default address: %v", err)
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO addresses (
+				UserID, Label, FullName, PhoneNumber, AddressLine, City, Province, PostalCode,
+				IsDefault, CreatedAt, UpdatedAt
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))
+		`, userID, a.Label, a.FullName, a.PhoneNumber, a.AddressLine, a.City, a.Province, a.PostalCode, isDefault)
+		if err != nil {
+			return fmt.Errorf("failed to create address: %v", err)
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get address ID: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetAddress(ctx, userID, id)
+}
+
+// UpdateAddress replaces the fields of a saved address
+func UpdateAddress(ctx context.Context, userID, addressID int64, a Address) (*Address, error) {
+	ctx, span := startSpan(ctx, "models.UpdateAddress")
+	defer span.End()
+
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if a.IsDefault {
+			if _, err := tx.ExecContext(ctx, "UPDATE addresses SET IsDefault = 0 WHERE UserID = ?", userID); err != nil {
+				return fmt.Errorf("failed to clear default address: %v", err)
+			}
+		}
+
+		// IsDefault is only ever set here; unsetting happens by choosing another default
+		result, err := tx.ExecContext(ctx, `
+			UPDATE addresses
+			SET Label = ?, FullName = ?, PhoneNumber = ?, AddressLine = ?, City = ?, Province = ?,
+				PostalCode = ?, IsDefault = MAX(IsDefault, ?), UpdatedAt = datetime('now')
+			WHERE AddressID = ? AND UserID = ?
+		`, a.Label, a.FullName, a.PhoneNumber, a.AddressLine, a.City, a.Province, a.PostalCode, a.IsDefault,
+			addressID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to update address: %v", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %v", err)
+		}
+		if rowsAffected == 0 {
+			return NotFoundError("address not found")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetAddress(ctx, userID, addressID)
+}
+
+// SetDefaultAddress makes the address the user's default
+func SetDefaultAddress(ctx context.Context, userID, addressID int64) error {
+	ctx, span := startSpan(ctx, "models.SetDefaultAddress")
+	defer span.End()
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM addresses WHERE AddressID = ? AND UserID = ?)", addressID, userID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check address: %v", err)
+		}
+		if !exists {
+			return NotFoundError("address not found")
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE addresses SET IsDefault = (AddressID = ?) WHERE UserID = ?", addressID, userID); err != nil {
+			return fmt.Errorf("failed to set default address: %v", err)
+		}
+		return nil
+	})
+}
+
+// DeleteAddress removes a saved address. When the default is removed the most
+// recently added remaining address becomes the default.
+func DeleteAddress(ctx context.Context, userID, addressID int64) error {
+	ctx, span := startSpan(ctx, "models.DeleteAddress")
+	defer span.End()
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var isDefault bool
+		err := tx.QueryRowContext(ctx, "SELECT IsDefault FROM addresses WHERE AddressID = ? AND UserID = ?", addressID, userID).Scan(&isDefault)
+		if err == sql.ErrNoRows {
+			return NotFoundError("address not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check address: %v", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM addresses WHERE AddressID = ?", addressID); err != nil {
+			return fmt.Errorf("failed to delete address: %v", err)
+		}
+
+		if isDefault {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE addresses SET IsDefault = 1
+				WHERE AddressID = (SELECT MAX(AddressID) FROM addresses WHERE UserID = ?)
+			`, userID)
+			if err != nil {
+				return fmt.Errorf("failed to reassign default address: %v", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,314 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_module/internal/database"
+)
+
+// Audit actions
+const (
+	AuditLoginLockout         = "auth.lockout"
+	AuditProductCreate        = "product.create"
+	AuditProductUpdate        = "product.update"
+	AuditProductDelete        = "product.delete"
+	AuditOrderStatusUpdate    = "order.status_update"
+	AuditOrderPaymentVerified = "order.payment_verified"
+	AuditRefundCreate         = "refund.create"
+	AuditRefundComplete       = "refund.complete"
+	AuditRefundFail           = "refund.fail"
+	AuditPaymentProofReview   = "payment_proof.review"
+	AuditUserRoleChange       = "user.role_change"
+	AuditRoleCreate           = "role.create"
+	AuditRoleUpdate           = "role.update"
+	AuditRoleDelete           = "role.delete"
+	AuditWebhookCreate        = "webhook.create"
+	AuditWebhookUpdate        = "webhook.update"
+	AuditWebhookDelete        = "webhook.delete"
+	AuditWebhookRotateSecret  = "webhook.rotate_secret"
+	AuditWebhookPing          = "webhook.ping"
+	AuditWebhookReplay        = "webhook.replay"
+)
+
+// AuditEntry is one record in the append-only audit log. ActorID is nil for
+// actions taken by the system or by someone who isn't logged in. Before and
+// After are snapshots of the target around the change; either is nil when
+// the target was created or deleted.
+type AuditEntry struct {
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+	Details    interface{}
+	IPAddress  string
+}
+
+// AuditRecord is an audit log entry as read back. Changes lists the fields
+// that differ between Before and After.
+type AuditRecord struct {
+	AuditID    int64                  `json:"audit_id"`
+	ActorID    *int64                 `json:"actor_id"`
+	ActorEmail string                 `json:"actor_email,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	Before     json.RawMessage        `json:"before,omitempty"`
+	After      json.RawMessage        `json:"after,omitempty"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"`
+	Details    json.RawMessage        `json:"details,omitempty"`
+	IPAddress  string                 `json:"ip_address,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// AuditChange is one field's value before and after a change
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditFilter narrows a search of the audit log. Zero fields match
+// everything. Action matches exactly, or every action in a group when given
+// without a dot, so "product" matches "product.update". Start and End are
+// YYYY-MM-DD dates, both inclusive. BeforeID pages backwards from a
+// previous page's last AuditID.
+type AuditFilter struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Start      string
+	End        string
+	BeforeID   int64
+}
+
+type actorKey struct{}
+
+type actor struct {
+	userID    int64
+	ipAddress string
+}
+
+// WithActor returns a context whose writes are attributed to userID at
+// ipAddress in the audit log and order history
+func WithActor(ctx context.Context, userID int64, ipAddress string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{userID: userID, ipAddress: ipAddress})
+}
+
+// actorFrom returns the actor set by WithActor, if any
+func actorFrom(ctx context.Context) (actor, bool) {
+	a, ok := ctx.Value(actorKey{}).(actor)
+	return a, ok
+}
+
+// actorID returns the ID of the user set by WithActor, or nil
+func actorID(ctx context.Context) *int64 {
+	if a, ok := actorFrom(ctx); ok {
+		return &a.userID
+	}
+	return nil
+}
+
+// recordAudit appends an entry to the audit log inside tx, so the entry
+// exists exactly when the change it describes commits. The actor and IP
+// address come from ctx unless the entry sets them.
+func recordAudit(ctx context.Context, tx *sql.Tx, e AuditEntry) error {
+	if a, ok := actorFrom(ctx); ok {
+		if e.ActorID == nil {
+			e.ActorID = &a.userID
+		}
+		if e.IPAddress == "" {
+			e.IPAddress = a.ipAddress
+		}
+	}
+
+	var encoded [3][]byte
+	for i, v := range []interface{}{e.Before, e.After, e.Details} {
+		if v == nil {
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit entry: %v", err)
+		}
+		encoded[i] = b
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (ActorID, Action, TargetType, TargetID, Before, After, Details, IPAddress, CreatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), datetime('now'))
+	`, e.ActorID, e.Action, e.TargetType, e.TargetID,
+		nullableJSON(encoded[0]), nullableJSON(encoded[1]), nullableJSON(encoded[2]), e.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to record %s audit entry: %v", e.Action, err)
+	}
+	return nil
+}
+
+// nullableJSON stores missing details as NULL rather than an empty string
+func nullableJSON(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+// GetAuditLog returns up to limit entries matching f, newest first
+func GetAuditLog(ctx context.Context, f AuditFilter, limit int) ([]AuditRecord, error) {
+	ctx, span := startSpan(ctx, "models.GetAuditLog")
+	defer span.End()
+
+	records := []AuditRecord{}
+	err := EachAuditRecord(ctx, f, limit, func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// EachAuditRecord calls fn with every entry matching f, newest first, up to
+// limit entries or all of them when limit is 0. Entries are read one at a
+// time, so exports of the whole log don't have to fit in memory.
+func EachAuditRecord(ctx context.Context, f AuditFilter, limit int, fn func(AuditRecord) error) error {
+	ctx, span := startSpan(ctx, "models.EachAuditRecord")
+	defer span.End()
+
+	query := `
+		SELECT a.AuditID, a.ActorID, COALESCE(u.Email, ''), a.Action, COALESCE(a.TargetType, ''), COALESCE(a.TargetID, ''),
+			a.Before, a.After, a.Details, COALESCE(a.IPAddress, ''), a.CreatedAt
+		FROM audit_log a
+		LEFT JOIN users u ON u.UserID = a.ActorID
+	`
+	var where []string
+	var args []interface{}
+	if f.ActorID != 0 {
+		where = append(where, "a.ActorID = ?")
+		args = append(args, f.ActorID)
+	}
+	if f.Action != "" {
+		if strings.Contains(f.Action, ".") {
+			where = append(where, "a.Action = ?")
+			args = append(args, f.Action)
+		} else {
+			where = append(where, "substr(a.Action, 1, length(?) + 1) = ? || '.'")
+			args = append(args, f.Action, f.Action)
+		}
+	}
+	if f.TargetType != "" {
+		where = append(where, "a.TargetType = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		where = append(where, "a.TargetID = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.Start != "" {
+		where = append(where, "a.CreatedAt >= date(?)")
+		args = append(args, f.Start)
+	}
+	if f.End != "" {
+		where = append(where, "a.CreatedAt < date(?, '+1 day')")
+		args = append(args, f.End)
+	}
+	if f.BeforeID != 0 {
+		where = append(where, "a.AuditID < ?")
+		args = append(args, f.BeforeID)
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY a.AuditID DESC"
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+
+	rows, err := database.ReadDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r AuditRecord
+		var actorID sql.NullInt64
+		var before, after, details sql.NullString
+		var createdAt string
+		err := rows.Scan(&r.AuditID, &actorID, &r.ActorEmail, &r.Action, &r.TargetType, &r.TargetID,
+			&before, &after, &details, &r.IPAddress, &createdAt)
+		if err != nil {
+			return fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+		if actorID.Valid {
+			r.ActorID = &actorID.Int64
+		}
+		if before.Valid {
+			r.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			r.After = json.RawMessage(after.String)
+		}
+		if details.Valid {
+			r.Details = json.RawMessage(details.String)
+		}
+		r.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+		r.Changes = auditChanges(r.Before, r.After)
+
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %v", err)
+	}
+	return nil
+}
+
+// ChangedFields returns the names of the fields in r.Changes in order
+func (r AuditRecord) ChangedFields() []string {
+	fields := make([]string, 0, len(r.Changes))
+	for field := range r.Changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// auditChanges diffs two JSON object snapshots field by field. It returns
+// nil unless both snapshots are objects.
+func auditChanges(before, after json.RawMessage) map[string]AuditChange {
+	if before == nil || after == nil {
+		return nil
+	}
+	var b, a map[string]interface{}
+	if json.Unmarshal(before, &b) != nil || json.Unmarshal(after, &a) != nil {
+		return nil
+	}
+
+	changes := map[string]AuditChange{}
+	for field, from := range b {
+		if to := a[field]; !reflect.DeepEqual(from, to) {
+			changes[field] = AuditChange{From: from, To: to}
+		}
+	}
+	for field, to := range a {
+		if _, ok := b[field]; !ok {
+			changes[field] = AuditChange{From: nil, To: to}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
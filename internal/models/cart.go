@@ -1,10 +1,11 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"go_module/internal/database"
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -15,6 +16,8 @@ type CartItem struct {
 	Price      float64 `json:"price"`
 	Quantity   int     `json:"quantity"`
 	ImageURL   string  `json:"image_url"`
+	WeightKg   float64 `json:"weight_kg"`
+	TaxClass   string  `json:"tax_class"`
 }
 
 type Cart struct {
@@ -27,190 +30,163 @@ type Cart struct {
 }
 
 // GetOrCreateCart gets the user's cart or creates one if it doesn't exist
-func GetOrCreateCart(userID int64) (int64, error) {
-	log.Printf("GetOrCreateCart: Starting for userID: %d", userID)
+func GetOrCreateCart(ctx context.Context, userID int64) (int64, error) {
+	ctx, span := startSpan(ctx, "models.GetOrCreateCart")
+	defer span.End()
 
 	// Check if cart exists
 	var cartID int64
-	err := database.DB.QueryRow("SELECT CartID FROM carts WHERE UserID = ?", userID).Scan(&cartID)
+	err := database.ReadDB.QueryRowContext(ctx, "SELECT CartID FROM carts WHERE UserID = ?", userID).Scan(&cartID)
 
 	if err == nil {
 		// Cart exists
-		log.Printf("GetOrCreateCart: Found existing cart (ID: %d) for userID: %d", cartID, userID)
 		return cartID, nil
 	}
 
 	if err != sql.ErrNoRows {
 		// Unexpected error
-		log.Printf("GetOrCreateCart: Error checking for existing cart: %v", err)
+		slog.ErrorContext(ctx, "Failed to check for existing cart", "user_id", userID, "error", err)
 		return 0, fmt.Errorf("failed to check for existing cart: %v", err)
 	}
 
 	// Cart doesn't exist, create one
-	log.Printf("GetOrCreateCart: No cart found for userID: %d, creating new cart", userID)
-	result, err := database.DB.Exec(
+	result, err := database.DB.ExecContext(ctx,
 		"INSERT INTO carts (UserID, CreatedAt, UpdatedAt) VALUES (?, datetime('now'), datetime('now'))",
 		userID,
 	)
 	if err != nil {
-		log.Printf("GetOrCreateCart: Failed to create cart: %v", err)
+		slog.ErrorContext(ctx, "Failed to create cart", "user_id", userID, "error", err)
 		return 0, fmt.Errorf("failed to create cart: %v", err)
 	}
 
 	cartID, err = result.LastInsertId()
 	if err != nil {
-		log.Printf("GetOrCreateCart: Failed to get cart ID: %v", err)
+		slog.ErrorContext(ctx, "Failed to get cart ID", "user_id", userID, "error", err)
 		return 0, fmt.Errorf("failed to get cart ID: %v", err)
 	}
 
-	log.Printf("GetOrCreateCart: Created new cart (ID: %d) for userID: %d", cartID, userID)
+	slog.DebugContext(ctx, "Created cart", "cart_id", cartID, "user_id", userID)
 	return cartID, nil
 }
 
 // Add to cart with improved error handling
-func AddToCart(userID int64, productID int64, quantity int) error {
+func AddToCart(ctx context.Context, userID int64, productID int64, quantity int) error {
+	ctx, span := startSpan(ctx, "models.AddToCart")
+	defer span.End()
+
 	// Validate inputs
 	if quantity <= 0 {
-		return fmt.Errorf("quantity must be positive")
+		return FieldError("quantity", "quantity must be positive")
 	}
 
-	log.Printf("AddToCart: Starting transaction - UserID: %d, ProductID: %d, Quantity: %d",
-		userID, productID, quantity)
-
 	// Get or create cart
-	cartID, err := GetOrCreateCart(userID)
+	cartID, err := GetOrCreateCart(ctx, userID)
 	if err != nil {
-		log.Printf("AddToCart: Failed to get or create cart: %v", err)
+		slog.ErrorContext(ctx, "Failed to get or create cart", "error", err)
 		return fmt.Errorf("failed to get or create cart: %v", err)
 	}
 
-	// Start transaction
-	tx, err := database.DB.Begin()
-	if err != nil {
-		log.Printf("AddToCart: Failed to start transaction: %v", err)
-		return fmt.Errorf("database error: %v", err)
-	}
-
-	// Use defer with a named error to ensure proper cleanup
-	var txErr error
-	defer func() {
-		if txErr != nil || err != nil {
-			log.Printf("AddToCart: Rolling back transaction due to error: %v", err)
-			tx.Rollback()
-		}
-	}()
-
-	// First check if product exists and has enough stock
-	var stock int
-	err = tx.QueryRow("SELECT Stock FROM products WHERE ProductID = ?", productID).Scan(&stock)
-	if err == sql.ErrNoRows {
-		log.Printf("AddToCart: Product not found: %d", productID)
-		return fmt.Errorf("product not found")
-	}
-	if err != nil {
-		log.Printf("AddToCart: Error checking product stock: %v", err)
-		return fmt.Errorf("failed to check product stock: %v", err)
-	}
-
-	log.Printf("AddToCart: Product %d has stock: %d", productID, stock)
-
-	// Check if item already exists in cart
-	var existingQuantity int
-	var cartItemID int64
-	err = tx.QueryRow(`
-		SELECT CartItemID, Quantity FROM cart_items 
-		WHERE CartID = ? AND ProductID = ?`,
-		cartID, productID,
-	).Scan(&cartItemID, &existingQuantity)
-
-	if err == sql.ErrNoRows {
-		// Item not in cart, insert new item
-		log.Printf("AddToCart: Item not in cart for cartID: %d, adding new item", cartID)
-
-		// Check if there's enough stock
-		if stock < quantity {
-			log.Printf("AddToCart: Insufficient stock for new item: available=%d, requested=%d",
-				stock, quantity)
-			return fmt.Errorf("insufficient stock (available: %d, requested: %d)",
-				stock, quantity)
+	// Retried as a whole if another writer holds the database
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		// First check if product exists and has enough stock
+		var stock int
+		err = tx.QueryRowContext(ctx, "SELECT Stock FROM products WHERE ProductID = ?", productID).Scan(&stock)
+		if err == sql.ErrNoRows {
+			slog.DebugContext(ctx, "Product not found for cart", "product_id", productID)
+			return NotFoundError("product not found")
 		}
-
-		_, err = tx.Exec(`
-			INSERT INTO cart_items (CartID, ProductID, Quantity)
-			VALUES (?, ?, ?)`,
-			cartID, productID, quantity,
-		)
 		if err != nil {
-			log.Printf("AddToCart: Failed to insert cart item: %v", err)
-			return fmt.Errorf("failed to add item to cart: %v", err)
+			slog.ErrorContext(ctx, "Failed to check product stock", "product_id", productID, "error", err)
+			return fmt.Errorf("failed to check product stock: %v", err)
 		}
 
-		log.Printf("AddToCart: Successfully added new item to cart for cartID: %d", cartID)
-	} else if err != nil {
-		log.Printf("AddToCart: Error checking existing cart item: %v", err)
-		return fmt.Errorf("failed to check cart: %v", err)
-	} else {
-		// Item exists in cart
-		log.Printf("AddToCart: Item exists in cart for cartID: %d with quantity: %d", cartID, existingQuantity)
-
-		// Check if total quantity would exceed stock
-		if existingQuantity+quantity > stock {
-			log.Printf("AddToCart: Insufficient stock for update: available=%d, in cart=%d, requested=%d",
-				stock, existingQuantity, quantity)
-			return fmt.Errorf("insufficient stock (available: %d, in cart: %d, requested: %d)",
-				stock, existingQuantity, quantity)
+		// Check if item already exists in cart
+		var existingQuantity int
+		var cartItemID int64
+		err = tx.QueryRowContext(ctx, `
+			SELECT CartItemID, Quantity FROM cart_items 
+			WHERE CartID = ? AND ProductID = ?`,
+			cartID, productID,
+		).Scan(&cartItemID, &existingQuantity)
+
+		if err == sql.ErrNoRows {
+			// Item not in cart, insert new item
+
+			// Check if there's enough stock
+			if stock < quantity {
+				return OutOfStockError("insufficient stock (available: %d, requested: %d)",
+					stock, quantity)
+			}
+
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO cart_items (CartID, ProductID, Quantity)
+				VALUES (?, ?, ?)`,
+				cartID, productID, quantity,
+			)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to insert cart item", "cart_id", cartID, "error", err)
+				return fmt.Errorf("failed to add item to cart: %v", err)
+			}
+
+		} else if err != nil {
+			slog.ErrorContext(ctx, "Failed to check existing cart item", "cart_id", cartID, "error", err)
+			return fmt.Errorf("failed to check cart: %v", err)
+		} else {
+			// Item exists in cart
+
+			// Check if total quantity would exceed stock
+			if existingQuantity+quantity > stock {
+				return OutOfStockError("insufficient stock (available: %d, in cart: %d, requested: %d)",
+					stock, existingQuantity, quantity)
+			}
+
+			// Item exists, update quantity
+			_, err = tx.ExecContext(ctx, `
+				UPDATE cart_items 
+				SET Quantity = Quantity + ?
+				WHERE CartItemID = ?`,
+				quantity, cartItemID,
+			)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to update cart item", "cart_id", cartID, "error", err)
+				return fmt.Errorf("failed to update cart: %v", err)
+			}
+
 		}
 
-		// Item exists, update quantity
-		_, err = tx.Exec(`
-			UPDATE cart_items 
-			SET Quantity = Quantity + ?
-			WHERE CartItemID = ?`,
-			quantity, cartItemID,
-		)
+		// Update cart's UpdatedAt timestamp
+		_, err = tx.ExecContext(ctx, "UPDATE carts SET UpdatedAt = datetime('now') WHERE CartID = ?", cartID)
 		if err != nil {
-			log.Printf("AddToCart: Failed to update cart item: %v", err)
-			return fmt.Errorf("failed to update cart: %v", err)
+			slog.ErrorContext(ctx, "Failed to update cart timestamp", "cart_id", cartID, "error", err)
+			return fmt.Errorf("failed to update cart timestamp: %v", err)
 		}
-
-		log.Printf("AddToCart: Successfully updated cart item quantity to: %d for cartID: %d", existingQuantity+quantity, cartID)
-	}
-
-	// Update cart's UpdatedAt timestamp
-	_, err = tx.Exec("UPDATE carts SET UpdatedAt = datetime('now') WHERE CartID = ?", cartID)
-	if err != nil {
-		log.Printf("AddToCart: Failed to update cart timestamp: %v", err)
-		return fmt.Errorf("failed to update cart timestamp: %v", err)
-	}
-
-	// Commit transaction
-	log.Printf("AddToCart: Committing transaction for cartID: %d", cartID)
-	err = tx.Commit()
+		return nil
+	})
 	if err != nil {
-		log.Printf("AddToCart: Failed to commit transaction: %v", err)
-		txErr = fmt.Errorf("failed to commit transaction: %v", err)
-		return txErr
+		slog.WarnContext(ctx, "Add to cart failed", "cart_id", cartID, "error", err)
+		return err
 	}
 
-	log.Printf("AddToCart: Transaction completed successfully for cartID: %d", cartID)
+	slog.DebugContext(ctx, "Added to cart", "cart_id", cartID, "product_id", productID, "quantity", quantity)
 	return nil
 }
 
 // Get cart contents
-func GetCartByUserID(userID int64) (*Cart, error) {
-	log.Printf("GetCartByUserID: Starting for userID: %d", userID)
+func GetCartByUserID(ctx context.Context, userID int64) (*Cart, error) {
+	ctx, span := startSpan(ctx, "models.GetCartByUserID")
+	defer span.End()
 
 	// Get or create cart
-	cartID, err := GetOrCreateCart(userID)
+	cartID, err := GetOrCreateCart(ctx, userID)
 	if err != nil {
-		log.Printf("GetCartByUserID: Failed to get or create cart: %v", err)
+		slog.ErrorContext(ctx, "Failed to get or create cart", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("failed to get or create cart: %v", err)
 	}
 
 	// Start transaction for consistent read
-	tx, err := database.DB.Begin()
+	tx, err := database.ReadDB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("GetCartByUserID: Failed to start transaction: %v", err)
+		slog.ErrorContext(ctx, "Failed to start cart transaction", "error", err)
 		return nil, fmt.Errorf("failed to start transaction: %v", err)
 	}
 	defer tx.Rollback()
@@ -218,14 +194,14 @@ func GetCartByUserID(userID int64) (*Cart, error) {
 	// Get cart details
 	var cart Cart
 	var createdAt, updatedAt string
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		SELECT CartID, UserID, CreatedAt, UpdatedAt
 		FROM carts
 		WHERE CartID = ?`,
 		cartID,
 	).Scan(&cart.CartID, &cart.UserID, &createdAt, &updatedAt)
 	if err != nil {
-		log.Printf("GetCartByUserID: Failed to get cart details: %v", err)
+		slog.ErrorContext(ctx, "Failed to get cart details", "cart_id", cartID, "error", err)
 		return nil, fmt.Errorf("failed to get cart details: %v", err)
 	}
 
@@ -233,22 +209,23 @@ func GetCartByUserID(userID int64) (*Cart, error) {
 	cart.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 	cart.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
 
-	log.Printf("GetCartByUserID: Querying cart items for cartID: %d", cartID)
-	rows, err := tx.Query(`
+	rows, err := tx.QueryContext(ctx, `
 		SELECT 
 			ci.CartItemID,
 			ci.ProductID,
 			p.Name,
 			p.Price,
 			ci.Quantity,
-			p.ImageURL
+			p.ImageURL,
+			p.WeightKg,
+			p.TaxClass
 		FROM cart_items ci
 		JOIN products p ON ci.ProductID = p.ProductID
 		WHERE ci.CartID = ?`,
 		cartID,
 	)
 	if err != nil {
-		log.Printf("GetCartByUserID: Failed to fetch cart items: %v", err)
+		slog.ErrorContext(ctx, "Failed to fetch cart items", "cart_id", cartID, "error", err)
 		return nil, fmt.Errorf("failed to fetch cart items: %v", err)
 	}
 	defer rows.Close()
@@ -266,9 +243,11 @@ func GetCartByUserID(userID int64) (*Cart, error) {
 			&item.Price,
 			&item.Quantity,
 			&item.ImageURL,
+			&item.WeightKg,
+			&item.TaxClass,
 		)
 		if err != nil {
-			log.Printf("GetCartByUserID: Failed to scan cart item: %v", err)
+			slog.ErrorContext(ctx, "Failed to scan cart item", "cart_id", cartID, "error", err)
 			return nil, fmt.Errorf("failed to scan cart item: %v", err)
 		}
 		cart.Items = append(cart.Items, item)
@@ -278,11 +257,11 @@ func GetCartByUserID(userID int64) (*Cart, error) {
 
 	// Commit the transaction
 	if err = tx.Commit(); err != nil {
-		log.Printf("GetCartByUserID: Failed to commit transaction: %v", err)
+		slog.ErrorContext(ctx, "Failed to commit cart transaction", "error", err)
 		return nil, fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
-	log.Printf("GetCartByUserID: Successfully fetched cart for userID: %d with %d items", userID, itemCount)
+	slog.DebugContext(ctx, "Fetched cart", "user_id", userID, "items", itemCount)
 	return &cart, nil
 }
 
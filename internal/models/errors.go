@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Error kinds returned by model functions. Check for them with errors.Is;
+// anything else returned by a model function is an internal error whose
+// message must not reach clients.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrOutOfStock   = errors.New("out of stock")
+	ErrValidation   = errors.New("validation failed")
+	ErrConflict     = errors.New("conflict")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// Error is a domain error whose message is safe to show to clients. Fields
+// holds per-field messages for validation errors, and RetryAfter says when
+// a rate limited request may be tried again.
+type Error struct {
+	Kind       error
+	Message    string
+	Fields     map[string]string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap lets errors.Is match the error's kind
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// NotFoundError reports a missing record
+func NotFoundError(format string, args ...interface{}) error {
+	return &Error{Kind: ErrNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+// OutOfStockError reports that a product cannot cover the requested quantity
+func OutOfStockError(format string, args ...interface{}) error {
+	return &Error{Kind: ErrOutOfStock, Message: fmt.Sprintf(format, args...)}
+}
+
+// ConflictError reports a request that clashes with the record's current state
+func ConflictError(format string, args ...interface{}) error {
+	return &Error{Kind: ErrConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// ValidationError reports invalid input that is not tied to a single field
+func ValidationError(format string, args ...interface{}) error {
+	return &Error{Kind: ErrValidation, Message: fmt.Sprintf(format, args...)}
+}
+
+// FieldError reports invalid input for one field
+func FieldError(field, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return &Error{Kind: ErrValidation, Message: msg, Fields: map[string]string{field: msg}}
+}
+
+// UnauthorizedError reports missing, wrong or revoked credentials
+func UnauthorizedError(format string, args ...interface{}) error {
+	return &Error{Kind: ErrUnauthorized, Message: fmt.Sprintf(format, args...)}
+}
+
+// ForbiddenError reports an action the caller is not allowed to take
+func ForbiddenError(format string, args ...interface{}) error {
+	return &Error{Kind: ErrForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+// RateLimitedError reports a request refused until retryAfter has passed,
+// such as a login to a locked account
+func RateLimitedError(retryAfter time.Duration, format string, args ...interface{}) error {
+	return &Error{Kind: ErrRateLimited, Message: fmt.Sprintf(format, args...), RetryAfter: retryAfter}
+}
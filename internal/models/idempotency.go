@@ -0,0 +1,114 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go_module/internal/database"
+	"time"
+)
+
+// Idempotency key statuses
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key, used to replay the response when the client retries
+type IdempotencyRecord struct {
+	UserID       int64
+	Key          string
+	Method       string
+	Path         string
+	Fingerprint  string
+	Status       string
+	ResponseCode int
+	ContentType  string
+	ResponseBody []byte
+	CreatedAt    time.Time
+}
+
+// BeginIdempotentRequest claims an idempotency key for a user. It returns nil
+// when the key is new and the request should be processed, or the existing
+// record when the key has been used before. Keys expire after 24 hours.
+func BeginIdempotentRequest(ctx context.Context, userID int64, key, method, path, fingerprint string) (*IdempotencyRecord, error) {
+	ctx, span := startSpan(ctx, "models.BeginIdempotentRequest")
+	defer span.End()
+
+	_, err := database.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE UserID = ? AND IdemKey = ? AND CreatedAt < datetime('now', '-24 hours')
+	`, userID, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire idempotency key: %v", err)
+	}
+
+	result, err := database.DB.ExecContext(ctx, `
+		INSERT OR IGNORE INTO idempotency_keys (UserID, IdemKey, Method, Path, Fingerprint, Status, CreatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, datetime('now'))
+	`, userID, key, method, path, fingerprint, IdempotencyProcessing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	var r IdempotencyRecord
+	var responseCode sql.NullInt64
+	var contentType sql.NullString
+	var createdAt string
+	err = database.ReadDB.QueryRowContext(ctx, `
+		SELECT UserID, IdemKey, Method, Path, Fingerprint, Status, ResponseCode, ContentType, ResponseBody, CreatedAt
+		FROM idempotency_keys
+		WHERE UserID = ? AND IdemKey = ?
+	`, userID, key).Scan(
+		&r.UserID,
+		&r.Key,
+		&r.Method,
+		&r.Path,
+		&r.Fingerprint,
+		&r.Status,
+		&responseCode,
+		&contentType,
+		&r.ResponseBody,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch idempotency key: %v", err)
+	}
+
+	r.ResponseCode = int(responseCode.Int64)
+	r.ContentType = contentType.String
+	r.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	return &r, nil
+}
+
+// CompleteIdempotentRequest stores the response for a claimed key
+func CompleteIdempotentRequest(ctx context.Context, userID int64, key string, code int, contentType string, body []byte) error {
+	ctx, span := startSpan(ctx, "models.CompleteIdempotentRequest")
+	defer span.End()
+
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET Status = ?, ResponseCode = ?, ContentType = ?, ResponseBody = ?
+		WHERE UserID = ? AND IdemKey = ?
+	`, IdempotencyCompleted, code, contentType, body, userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %v", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotentRequest forgets a claimed key so the request can be retried
+func ReleaseIdempotentRequest(ctx context.Context, userID int64, key string) error {
+	ctx, span := startSpan(ctx, "models.ReleaseIdempotentRequest")
+	defer span.End()
+
+	_, err := database.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE UserID = ? AND IdemKey = ?", userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %v", err)
+	}
+	return nil
+}
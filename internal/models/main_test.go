@@ -0,0 +1,51 @@
+package models_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/tracetest"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spans records the spans of every test. It is installed before the
+// database is opened so SQL statements are traced too.
+var spans *tracetest.Recorder
+
+func TestMain(m *testing.M) {
+	spans = tracetest.Install()
+	dbtest.Main(m)
+}
+
+// cancelAt returns a context that is cancelled as soon as a SQL statement
+// containing statement starts, making the code under test fail at that
+// point. reached reports whether the statement ran.
+func cancelAt(t *testing.T, statement string) (ctx context.Context, reached func() bool) {
+	t.Helper()
+
+	// SQL statements are only traced inside a span
+	ctx, span := otel.Tracer("test").Start(context.Background(), t.Name())
+	ctx, cancel := context.WithCancel(ctx)
+	hit := false
+	spans.OnStart(func(s sdktrace.ReadWriteSpan) {
+		for _, kv := range s.Attributes() {
+			if kv.Key == "db.statement" && strings.Contains(kv.Value.AsString(), statement) {
+				hit = true
+				cancel()
+			}
+		}
+	})
+	t.Cleanup(func() {
+		spans.OnStart(nil)
+		cancel()
+		span.End()
+	})
+	return ctx, func() bool {
+		spans.OnStart(nil)
+		return hit
+	}
+}
@@ -1,272 +1,382 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"go_module/internal/database"
-	"log"
+	"go_module/internal/events"
+	"log/slog"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type OrderItem struct {
+	OrderItemID     int64   `json:"order_item_id"`
 	ProductID       int64   `json:"product_id"`
 	Name            string  `json:"name"`
 	Quantity        int     `json:"quantity"`
 	PriceAtPurchase float64 `json:"price_at_purchase"`
+	TaxClass        string  `json:"tax_class"`
+	TaxRate         float64 `json:"tax_rate"`
+	TaxAmount       float64 `json:"tax_amount"`
 }
 
 type Order struct {
-	OrderID          int64       `json:"order_id"`
-	UserID           int64       `json:"user_id"`
-	ShippingAddress  string      `json:"shipping_address"`
-	PaymentMethod    string      `json:"payment_method"`
-	OrderDate        time.Time   `json:"order_date"`
-	TotalAmount      float64     `json:"total_amount"`
-	Status           string      `json:"status"`
-	TrackingNumber   string      `json:"tracking_number,omitempty"`
-	PaymentVerified  bool        `json:"payment_verified"`
-	PaymentReference string      `json:"payment_reference,omitempty"`
-	Items            []OrderItem `json:"items,omitempty"`
+	OrderID          int64            `json:"order_id"`
+	UserID           int64            `json:"user_id"`
+	ShippingAddress  string           `json:"shipping_address"`
+	ShippingDetails  *ShippingDetails `json:"shipping_details,omitempty"`
+	PaymentMethod    string           `json:"payment_method"`
+	OrderDate        time.Time        `json:"order_date"`
+	Subtotal         float64          `json:"subtotal"`
+	ShippingFee      float64          `json:"shipping_fee"`
+	ShippingZone     string           `json:"shipping_zone,omitempty"`
+	VatableSales     float64          `json:"vatable_sales"`
+	VatExemptSales   float64          `json:"vat_exempt_sales"`
+	ZeroRatedSales   float64          `json:"zero_rated_sales"`
+	TaxAmount        float64          `json:"tax_amount"`
+	PricesIncludeTax bool             `json:"prices_include_tax"`
+	TotalAmount      float64          `json:"total_amount"`
+	Status           string           `json:"status"`
+	TrackingNumber   string           `json:"tracking_number,omitempty"`
+	PaymentVerified  bool             `json:"payment_verified"`
+	PaymentReference string           `json:"payment_reference,omitempty"`
+	RefundStatus     string           `json:"refund_status"`
+	RefundedAmount   float64          `json:"refunded_amount"`
+	Items            []OrderItem      `json:"items,omitempty"`
 }
 
-// Create a new order from cart
-func CreateOrder(userID int64, shippingAddress, paymentMethod string) (*Order, error) {
-	log.Printf("Starting CreateOrder for userID: %d", userID)
+// Create a new order from cart. The shipping address is validated and stored
+// as a structured snapshot; the shipping fee is quoted from its province and
+// postal code and added to the cart subtotal, and VAT is computed per line
+// using the active tax configuration.
+func CreateOrder(ctx context.Context, userID int64, address Address, paymentMethod string) (*Order, error) {
+	ctx, span := startSpan(ctx, "models.CreateOrder")
+	defer span.End()
 
-	// Start transaction with a timeout context
-	tx, err := database.DB.Begin()
-	if err != nil {
-		log.Printf("Failed to start transaction: %v", err)
-		return nil, fmt.Errorf("failed to start transaction: %v", err)
-	}
+	slog.DebugContext(ctx, "Creating order", "user_id", userID)
 
-	// Make sure we either commit or rollback the transaction
-	committed := false
-	defer func() {
-		if !committed && tx != nil {
-			log.Printf("Rolling back transaction for userID: %d", userID)
-			tx.Rollback()
-		}
+	if err := address.Validate(); err != nil {
+		return nil, err
+	}
+	shippingAddress := address.String()
 
-		// Recover from any panics
-		if r := recover(); r != nil {
-			log.Printf("Recovered from panic in CreateOrder: %v", r)
-		}
-	}()
+	method, err := GetPaymentMethod(paymentMethod)
+	if err != nil {
+		return nil, err
+	}
 
 	// Get cart
-	log.Printf("Fetching cart for userID: %d", userID)
-	cart, err := GetCartByUserID(userID)
+	cart, err := GetCartByUserID(ctx, userID)
 	if err != nil {
-		log.Printf("Failed to get cart: %v", err)
+		slog.ErrorContext(ctx, "Failed to get cart", "error", err)
 		return nil, fmt.Errorf("failed to get cart: %v", err)
 	}
 
 	// Check if cart is empty
 	if len(cart.Items) == 0 {
-		log.Printf("Cart is empty for userID: %d", userID)
-		return nil, fmt.Errorf("cart is empty")
+		slog.DebugContext(ctx, "Cart is empty", "user_id", userID)
+		return nil, ValidationError("cart is empty")
 	}
 
-	log.Printf("Creating order record for userID: %d with %d items", userID, len(cart.Items))
-
-	// Create order directly with shipping address and payment method
-	result, err := tx.Exec(`
-		INSERT INTO orders (
-			UserID, ShippingAddress, PaymentMethod, 
-			TotalAmount, Status, CreatedAt, PaymentVerified
-		) VALUES (?, ?, ?, ?, ?, datetime('now'), ?)
-	`, userID, shippingAddress, paymentMethod, cart.Subtotal, "pending", paymentMethod == "cash_on_delivery")
-	if err != nil {
-		log.Printf("Failed to create order record: %v", err)
-		return nil, fmt.Errorf("failed to create order: %v", err)
-	}
-
-	orderID, err := result.LastInsertId()
+	// Quote shipping for the destination
+	quote, err := QuoteShipping(cart, address.Province, address.PostalCode)
 	if err != nil {
-		log.Printf("Failed to get order ID: %v", err)
-		return nil, fmt.Errorf("failed to get order ID: %v", err)
-	}
-
-	log.Printf("Created order with ID: %d for userID: %d", orderID, userID)
+		slog.ErrorContext(ctx, "Failed to quote shipping", "error", err)
+		return nil, err
+	}
+
+	// Compute VAT for the items and shipping. With VAT-inclusive pricing the
+	// gross total equals subtotal plus shipping; otherwise tax is added on top.
+	taxLines, taxSummary := CalculateOrderTax(cart, quote.ShippingFee)
+	total := taxSummary.GrossTotal
+
+	// Enforce the payment method's amount and delivery area rules
+	if err := method.CheckOrder(total, address.Province, quote.Zone); err != nil {
+		slog.InfoContext(ctx, "Payment method rejected", "user_id", userID, "error", err)
+		return nil, err
+	}
+
+	// Write everything in one transaction bound to the caller's context so a
+	// cancelled or timed out checkout rolls back instead of committing in the
+	// background. Nothing inside may use another connection: there is only one
+	// writer.
+	var orderID int64
+	itemIDs := make([]int64, len(cart.Items))
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		// The cart was priced outside the transaction; make sure a concurrent
+		// checkout or cart change hasn't altered it since
+		if err := checkCartUnchanged(ctx, tx, cart); err != nil {
+			return err
+		}
 
-	// Create order items and update stock in one transaction
-	for _, item := range cart.Items {
-		log.Printf("Adding item %d (qty: %d) to order %d", item.ProductID, item.Quantity, orderID)
-
-		// Add to order details
-		_, err = tx.Exec(`
-			INSERT INTO order_details (
-				OrderID, ProductID, Quantity, Price
-			) VALUES (?, ?, ?, ?)
-		`, orderID, item.ProductID, item.Quantity, item.Price)
+		slog.DebugContext(ctx, "Creating order record", "user_id", userID, "items", len(cart.Items),
+			"shipping_fee", quote.ShippingFee, "zone", quote.Zone, "tax", taxSummary.TaxAmount)
+
+		// Create order directly with shipping address and payment method
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO orders (
+				UserID, ShippingAddress, PaymentMethod, Subtotal, ShippingFee, ShippingZone,
+				VatableSales, VatExemptSales, ZeroRatedSales, TaxAmount, PricesIncludeTax,
+				ShipFullName, ShipPhoneNumber, ShipAddressLine, ShipCity, ShipProvince, ShipPostalCode,
+				TotalAmount, Status, CreatedAt, PaymentVerified
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'), ?)
+		`, userID, shippingAddress, paymentMethod, quote.Subtotal, quote.ShippingFee, quote.Zone,
+			taxSummary.VatableSales, taxSummary.VatExemptSales, taxSummary.ZeroRatedSales,
+			taxSummary.TaxAmount, taxSummary.PricesIncludeTax,
+			address.FullName, address.PhoneNumber, address.AddressLine, address.City, address.Province, address.PostalCode,
+			total, "pending", method.PayOnDelivery)
 		if err != nil {
-			log.Printf("Failed to create order item: %v", err)
-			return nil, fmt.Errorf("failed to create order item: %v", err)
+			slog.ErrorContext(ctx, "Failed to create order record", "error", err)
+			return fmt.Errorf("failed to create order: %v", err)
 		}
 
-		// Update product stock
-		_, err = tx.Exec(
-			"UPDATE products SET Stock = Stock - ? WHERE ProductID = ?",
-			item.Quantity, item.ProductID,
-		)
+		orderID, err = result.LastInsertId()
 		if err != nil {
-			log.Printf("Failed to update stock: %v", err)
-			return nil, fmt.Errorf("failed to update stock: %v", err)
+			slog.ErrorContext(ctx, "Failed to get order ID", "error", err)
+			return fmt.Errorf("failed to get order ID: %v", err)
 		}
-	}
 
-	// Clear cart within the same transaction
-	log.Printf("Clearing cart for userID: %d", userID)
+		// Create order items and update stock in one transaction
+		for i, item := range cart.Items {
+			slog.DebugContext(ctx, "Adding order item", "order_id", orderID, "product_id", item.ProductID, "quantity", item.Quantity)
+
+			// Add to order details
+			detail, err := tx.ExecContext(ctx, `
+				INSERT INTO order_details (
+					OrderID, ProductID, Quantity, Price, TaxClass, TaxRate, TaxAmount
+				) VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, orderID, item.ProductID, item.Quantity, item.Price,
+				taxLines[i].TaxClass, taxLines[i].TaxRate, taxLines[i].TaxAmount)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to create order item", "error", err)
+				return fmt.Errorf("failed to create order item: %v", err)
+			}
+			itemIDs[i], err = detail.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("failed to get order item ID: %v", err)
+			}
 
-	// Get the cart ID
-	var cartID int64
-	err = tx.QueryRow("SELECT CartID FROM carts WHERE UserID = ?", userID).Scan(&cartID)
-	if err != nil {
-		log.Printf("Failed to get cart ID: %v", err)
-		return nil, fmt.Errorf("failed to get cart ID: %v", err)
-	}
+			// Update product stock. The cart was read before the write lock was
+			// taken, so only take stock that is still there.
+			stock, err := tx.ExecContext(ctx,
+				"UPDATE products SET Stock = Stock - ? WHERE ProductID = ? AND Stock >= ?",
+				item.Quantity, item.ProductID, item.Quantity,
+			)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to update stock", "error", err)
+				return fmt.Errorf("failed to update stock: %v", err)
+			}
+			if n, _ := stock.RowsAffected(); n == 0 {
+				return OutOfStockError("insufficient stock for %s", item.Name)
+			}
+			if err := recordStockLow(ctx, tx, item.ProductID, item.Name, item.Quantity); err != nil {
+				return err
+			}
+		}
 
-	// Delete cart items
-	_, err = tx.Exec("DELETE FROM cart_items WHERE CartID = ?", cartID)
-	if err != nil {
-		log.Printf("Failed to clear cart items: %v", err)
-		return nil, fmt.Errorf("failed to clear cart items: %v", err)
-	}
+		err = events.Record(ctx, tx, events.OrderPlaced, events.OrderPlacedData{
+			OrderID:       orderID,
+			UserID:        userID,
+			TotalAmount:   total,
+			PaymentMethod: paymentMethod,
+			ItemCount:     len(cart.Items),
+		})
+		if err != nil {
+			return err
+		}
 
-	// Update cart timestamp
-	_, err = tx.Exec("UPDATE carts SET UpdatedAt = datetime('now') WHERE CartID = ?", cartID)
-	if err != nil {
-		log.Printf("Failed to update cart timestamp: %v", err)
-		// Non-critical error, continue
-	}
+		// Clear cart within the same transaction
 
-	// Commit transaction
-	log.Printf("Committing transaction for order %d", orderID)
-	err = tx.Commit()
+		// Get the cart ID
+		var cartID int64
+		err = tx.QueryRowContext(ctx, "SELECT CartID FROM carts WHERE UserID = ?", userID).Scan(&cartID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get cart ID", "error", err)
+			return fmt.Errorf("failed to get cart ID: %v", err)
+		}
+
+		// Delete cart items
+		_, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE CartID = ?", cartID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to clear cart items", "error", err)
+			return fmt.Errorf("failed to clear cart items: %v", err)
+		}
+
+		// Update cart timestamp
+		_, err = tx.ExecContext(ctx, "UPDATE carts SET UpdatedAt = datetime('now') WHERE CartID = ?", cartID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to update cart timestamp", "error", err)
+			// Non-critical error, continue
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
-		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+		slog.WarnContext(ctx, "Order transaction failed", "user_id", userID, "error", err)
+		return nil, err
 	}
 
-	committed = true
-	log.Printf("Transaction committed successfully for order %d", orderID)
-
 	// Return order
 	order := &Order{
-		OrderID:         orderID,
-		UserID:          userID,
-		ShippingAddress: shippingAddress,
-		PaymentMethod:   paymentMethod,
-		OrderDate:       time.Now(),
-		TotalAmount:     cart.Subtotal,
-		Status:          "pending",
-		PaymentVerified: paymentMethod == "cash_on_delivery",
-		Items:           make([]OrderItem, len(cart.Items)),
+		OrderID:          orderID,
+		UserID:           userID,
+		ShippingAddress:  shippingAddress,
+		ShippingDetails:  address.Snapshot(),
+		PaymentMethod:    paymentMethod,
+		OrderDate:        time.Now(),
+		Subtotal:         quote.Subtotal,
+		ShippingFee:      quote.ShippingFee,
+		ShippingZone:     quote.Zone,
+		VatableSales:     taxSummary.VatableSales,
+		VatExemptSales:   taxSummary.VatExemptSales,
+		ZeroRatedSales:   taxSummary.ZeroRatedSales,
+		TaxAmount:        taxSummary.TaxAmount,
+		PricesIncludeTax: taxSummary.PricesIncludeTax,
+		TotalAmount:      total,
+		Status:           "pending",
+		PaymentVerified:  method.PayOnDelivery,
+		RefundStatus:     OrderRefundNone,
+		Items:            make([]OrderItem, len(cart.Items)),
 	}
 
 	// Add items to order response
 	for i, item := range cart.Items {
 		order.Items[i] = OrderItem{
+			OrderItemID:     itemIDs[i],
 			ProductID:       item.ProductID,
 			Name:            item.Name,
 			Quantity:        item.Quantity,
 			PriceAtPurchase: item.Price,
+			TaxClass:        taxLines[i].TaxClass,
+			TaxRate:         taxLines[i].TaxRate,
+			TaxAmount:       taxLines[i].TaxAmount,
 		}
 	}
 
-	log.Printf("Order %d created successfully with %d items", orderID, len(order.Items))
+	slog.InfoContext(ctx, "Order created", "order_id", orderID, "user_id", userID, "items", len(order.Items))
 	return order, nil
 }
 
-// Get orders by user ID
-func GetOrdersByUserID(userID int64) ([]Order, error) {
-	rows, err := database.DB.Query(`
-		SELECT OrderID, UserID, ShippingAddress, PaymentMethod, 
-			   CreatedAt, TotalAmount, Status, PaymentVerified, PaymentReference, TrackingNumber
-		FROM orders
-		WHERE UserID = ?
-		ORDER BY CreatedAt DESC
-	`, userID)
+// checkCartUnchanged returns an error if the cart's items differ from the
+// snapshot the order was priced from
+func checkCartUnchanged(ctx context.Context, tx *sql.Tx, cart *Cart) error {
+	rows, err := tx.QueryContext(ctx, "SELECT ProductID, Quantity FROM cart_items WHERE CartID = ?", cart.CartID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch orders: %v", err)
+		return fmt.Errorf("failed to check cart: %v", err)
 	}
 	defer rows.Close()
 
-	// Initialize orders as an empty slice to ensure we return an empty array instead of null
-	orders := []Order{}
+	want := make(map[int64]int, len(cart.Items))
+	for _, item := range cart.Items {
+		want[item.ProductID] = item.Quantity
+	}
 
+	count := 0
 	for rows.Next() {
-		var o Order
-		var createdAt string
-		var paymentReference, trackingNumber sql.NullString
-
-		err := rows.Scan(
-			&o.OrderID,
-			&o.UserID,
-			&o.ShippingAddress,
-			&o.PaymentMethod,
-			&createdAt,
-			&o.TotalAmount,
-			&o.Status,
-			&o.PaymentVerified,
-			&paymentReference,
-			&trackingNumber,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %v", err)
+		var productID int64
+		var quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			return fmt.Errorf("failed to check cart: %v", err)
 		}
+		if want[productID] != quantity {
+			return ConflictError("cart changed during checkout")
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check cart: %v", err)
+	}
+	if count == 0 {
+		return ValidationError("cart is empty")
+	}
+	if count != len(want) {
+		return ConflictError("cart changed during checkout")
+	}
+	return nil
+}
+
+// orderColumns is the column list shared by every order query, in the order
+// scanOrder expects them
+const orderColumns = `OrderID, UserID, ShippingAddress, PaymentMethod, CreatedAt,
+	Subtotal, ShippingFee, ShippingZone, VatableSales, VatExemptSales, ZeroRatedSales,
+	TaxAmount, PricesIncludeTax, TotalAmount, Status, PaymentVerified, PaymentReference, TrackingNumber,
+	ShipFullName, ShipPhoneNumber, ShipAddressLine, ShipCity, ShipProvince, ShipPostalCode,
+	RefundStatus, RefundedAmount`
+
+// scanOrder reads one row selected with orderColumns
+func scanOrder(rows *sql.Rows) (Order, error) {
+	var o Order
+	var createdAt string
+	var paymentReference, trackingNumber, shippingZone sql.NullString
+	var shipFullName, shipPhone, shipLine, shipCity, shipProvince, shipPostal sql.NullString
+
+	err := rows.Scan(
+		&o.OrderID,
+		&o.UserID,
+		&o.ShippingAddress,
+		&o.PaymentMethod,
+		&createdAt,
+		&o.Subtotal,
+		&o.ShippingFee,
+		&shippingZone,
+		&o.VatableSales,
+		&o.VatExemptSales,
+		&o.ZeroRatedSales,
+		&o.TaxAmount,
+		&o.PricesIncludeTax,
+		&o.TotalAmount,
+		&o.Status,
+		&o.PaymentVerified,
+		&paymentReference,
+		&trackingNumber,
+		&shipFullName,
+		&shipPhone,
+		&shipLine,
+		&shipCity,
+		&shipProvince,
+		&shipPostal,
+		&o.RefundStatus,
+		&o.RefundedAmount,
+	)
+	if err != nil {
+		return o, fmt.Errorf("failed to scan order: %v", err)
+	}
 
-		// Parse the created_at timestamp
-		o.OrderDate, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	// Parse the created_at timestamp
+	o.OrderDate, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 
-		// Handle nullable fields
-		if paymentReference.Valid {
-			o.PaymentReference = paymentReference.String
-		}
-		if trackingNumber.Valid {
-			o.TrackingNumber = trackingNumber.String
-		}
+	// Handle nullable fields
+	if paymentReference.Valid {
+		o.PaymentReference = paymentReference.String
+	}
+	if trackingNumber.Valid {
+		o.TrackingNumber = trackingNumber.String
+	}
+	if shippingZone.Valid {
+		o.ShippingZone = shippingZone.String
+	}
 
-		// Get order items
-		itemRows, err := database.DB.Query(`
-			SELECT od.ProductID, p.Name, od.Quantity, od.Price
-			FROM order_details od
-			JOIN products p ON od.ProductID = p.ProductID
-			WHERE od.OrderID = ?
-		`, o.OrderID)
-		if err == nil {
-			o.Items = make([]OrderItem, 0)
-			for itemRows.Next() {
-				var item OrderItem
-				err := itemRows.Scan(
-					&item.ProductID,
-					&item.Name,
-					&item.Quantity,
-					&item.PriceAtPurchase,
-				)
-				if err == nil {
-					o.Items = append(o.Items, item)
-				}
-			}
-			itemRows.Close()
+	// Orders placed before structured addresses only have the text form
+	if shipFullName.Valid {
+		o.ShippingDetails = &ShippingDetails{
+			FullName:    shipFullName.String,
+			PhoneNumber: shipPhone.String,
+			AddressLine: shipLine.String,
+			City:        shipCity.String,
+			Province:    shipProvince.String,
+			PostalCode:  shipPostal.String,
 		}
-
-		orders = append(orders, o)
 	}
 
-	return orders, nil
+	return o, nil
 }
 
-// Get all orders (admin only)
-func GetAllOrders() ([]Order, error) {
-	rows, err := database.DB.Query(`
-		SELECT OrderID, UserID, ShippingAddress, PaymentMethod, 
-			   CreatedAt, TotalAmount, Status, PaymentVerified, PaymentReference, TrackingNumber
-		FROM orders
-		ORDER BY CreatedAt DESC
-	`)
+// queryOrders runs an order query selecting orderColumns and loads the items
+// of every returned order
+func queryOrders(ctx context.Context, query string, args ...interface{}) ([]Order, error) {
+	rows, err := database.ReadDB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch orders: %v", err)
 	}
@@ -276,135 +386,269 @@ func GetAllOrders() ([]Order, error) {
 	orders := []Order{}
 
 	for rows.Next() {
-		var o Order
-		var createdAt string
-		var paymentReference, trackingNumber sql.NullString
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %v", err)
+	}
+	rows.Close()
+
+	for i := range orders {
+		items, err := getOrderItems(ctx, orders[i].OrderID)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to load order items", "order_id", orders[i].OrderID, "error", err)
+			continue
+		}
+		orders[i].Items = items
+	}
+
+	return orders, nil
+}
+
+// getOrderItems returns the line items of an order
+func getOrderItems(ctx context.Context, orderID int64) ([]OrderItem, error) {
+	rows, err := database.ReadDB.QueryContext(ctx, `
+		SELECT od.OrderDetailID, od.ProductID, p.Name, od.Quantity, od.Price, od.TaxClass, od.TaxRate, od.TaxAmount
+		FROM order_details od
+		JOIN products p ON od.ProductID = p.ProductID
+		WHERE od.OrderID = ?
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]OrderItem, 0)
+	for rows.Next() {
+		var item OrderItem
 		err := rows.Scan(
-			&o.OrderID,
-			&o.UserID,
-			&o.ShippingAddress,
-			&o.PaymentMethod,
-			&createdAt,
-			&o.TotalAmount,
-			&o.Status,
-			&o.PaymentVerified,
-			&paymentReference,
-			&trackingNumber,
+			&item.OrderItemID,
+			&item.ProductID,
+			&item.Name,
+			&item.Quantity,
+			&item.PriceAtPurchase,
+			&item.TaxClass,
+			&item.TaxRate,
+			&item.TaxAmount,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %v", err)
+			return nil, err
 		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
 
-		// Parse the created_at timestamp
-		o.OrderDate, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+// Get orders by user ID
+func GetOrdersByUserID(ctx context.Context, userID int64) ([]Order, error) {
+	ctx, span := startSpan(ctx, "models.GetOrdersByUserID")
+	defer span.End()
 
-		// Handle nullable fields
-		if paymentReference.Valid {
-			o.PaymentReference = paymentReference.String
-		}
-		if trackingNumber.Valid {
-			o.TrackingNumber = trackingNumber.String
-		}
+	return queryOrders(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE UserID = ?
+		ORDER BY CreatedAt DESC
+	`, userID)
+}
 
-		// Get order items
-		itemRows, err := database.DB.Query(`
-			SELECT od.ProductID, p.Name, od.Quantity, od.Price
-			FROM order_details od
-			JOIN products p ON od.ProductID = p.ProductID
-			WHERE od.OrderID = ?
-		`, o.OrderID)
-		if err == nil {
-			o.Items = make([]OrderItem, 0)
-			for itemRows.Next() {
-				var item OrderItem
-				err := itemRows.Scan(
-					&item.ProductID,
-					&item.Name,
-					&item.Quantity,
-					&item.PriceAtPurchase,
-				)
-				if err == nil {
-					o.Items = append(o.Items, item)
-				}
-			}
-			itemRows.Close()
-		}
+// GetOrderByID returns a single order with its items
+func GetOrderByID(ctx context.Context, id int64) (*Order, error) {
+	ctx, span := startSpan(ctx, "models.GetOrderByID")
+	defer span.End()
 
-		orders = append(orders, o)
+	orders, err := queryOrders(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE OrderID = ?
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, NotFoundError("order not found")
 	}
+	return &orders[0], nil
+}
 
-	return orders, nil
+// Get all orders (admin only)
+func GetAllOrders(ctx context.Context) ([]Order, error) {
+	ctx, span := startSpan(ctx, "models.GetAllOrders")
+	defer span.End()
+
+	return queryOrders(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		ORDER BY CreatedAt DESC
+	`)
 }
 
-// Update order status
-func UpdateOrderStatus(id int64, status string) error {
+// orderStatuses are the statuses an order can be in
+var orderStatuses = []string{"pending", "processing", "shipped", "delivered", "cancelled"}
+
+// UpdateOrderStatus changes the status of an order and records the change in
+// its history. A tracking number, if given, is saved with the order. The
+// customer is emailed when their order ships, is delivered or is cancelled.
+func UpdateOrderStatus(ctx context.Context, id int64, status, trackingNumber string) error {
+	ctx, span := startSpan(ctx, "models.UpdateOrderStatus")
+	defer span.End()
+
 	// Validate status
-	validStatuses := []string{"pending", "processing", "shipped", "delivered", "cancelled"}
+	status = strings.ToLower(status)
 	isValid := false
-	for _, s := range validStatuses {
-		if strings.ToLower(status) == s {
+	for _, s := range orderStatuses {
+		if status == s {
 			isValid = true
 			break
 		}
 	}
 
 	if !isValid {
-		return fmt.Errorf("invalid status: %s", status)
+		return FieldError("status", "invalid status: %s", status)
 	}
 
-	// Check if order exists
-	var exists bool
-	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM orders WHERE OrderID = ?)", id).Scan(&exists)
-	if err != nil {
-		return fmt.Errorf("failed to check if order exists: %v", err)
-	}
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := getOrderAudit(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := setOrderStatus(ctx, tx, id, status, strings.TrimSpace(trackingNumber)); err != nil {
+			return err
+		}
+		after, err := getOrderAudit(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditOrderStatusUpdate,
+			TargetType: "order",
+			TargetID:   strconv.FormatInt(id, 10),
+			Before:     before,
+			After:      after,
+		})
+	})
+}
 
-	if !exists {
-		return fmt.Errorf("order not found")
+// orderAudit is the part of an order that admin actions change, as recorded
+// in the audit log
+type orderAudit struct {
+	Status           string `json:"status"`
+	TrackingNumber   string `json:"tracking_number"`
+	PaymentVerified  bool   `json:"payment_verified"`
+	PaymentReference string `json:"payment_reference"`
+}
+
+// getOrderAudit reads an order's audited fields inside tx
+func getOrderAudit(ctx context.Context, tx *sql.Tx, id int64) (*orderAudit, error) {
+	var o orderAudit
+	err := tx.QueryRowContext(ctx, `
+		SELECT Status, COALESCE(TrackingNumber, ''), PaymentVerified, COALESCE(PaymentReference, '')
+		FROM orders WHERE OrderID = ?
+	`, id).Scan(&o.Status, &o.TrackingNumber, &o.PaymentVerified, &o.PaymentReference)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("order not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch order: %v", err)
 	}
+	return &o, nil
+}
 
+// setOrderStatus changes an order's status inside a transaction, records the
+// change in the order history and records an OrderStatusChanged event
+func setOrderStatus(ctx context.Context, tx *sql.Tx, id int64, status, trackingNumber string) error {
 	// Get current status
+	var userID int64
 	var currentStatus string
-	err = database.DB.QueryRow("SELECT Status FROM orders WHERE OrderID = ?", id).Scan(&currentStatus)
+	var currentTracking sql.NullString
+	err := tx.QueryRowContext(ctx,
+		"SELECT UserID, Status, TrackingNumber FROM orders WHERE OrderID = ?", id,
+	).Scan(&userID, &currentStatus, &currentTracking)
+	if err == sql.ErrNoRows {
+		return NotFoundError("order not found")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get current status: %v", err)
 	}
 
-	// Update status
-	_, err = database.DB.Exec("UPDATE orders SET Status = ? WHERE OrderID = ?", status, id)
+	// Update status, keeping the tracking number unless a new one is given
+	_, err = tx.ExecContext(ctx,
+		"UPDATE orders SET Status = ?, TrackingNumber = COALESCE(NULLIF(?, ''), TrackingNumber) WHERE OrderID = ?",
+		status, trackingNumber, id,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to update order status: %v", err)
 	}
 
 	// Add to order history
-	_, err = database.DB.Exec(
-		"INSERT INTO order_history (OrderID, OldStatus, NewStatus, ChangedAt) VALUES (?, ?, ?, datetime('now'))",
-		id, currentStatus, status,
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO order_history (OrderID, OldStatus, NewStatus, ChangedBy, ChangedAt) VALUES (?, ?, ?, ?, datetime('now'))",
+		id, currentStatus, status, actorID(ctx),
 	)
 	if err != nil {
-		log.Printf("Warning: Failed to add to order history: %v", err)
-		// Don't return error, not critical
+		return fmt.Errorf("failed to add to order history: %v", err)
 	}
 
-	return nil
+	// Setting the same status again is not an event unless it brings a new
+	// tracking number
+	trackingChanged := trackingNumber != "" && trackingNumber != currentTracking.String
+	if status == currentStatus && !trackingChanged {
+		return nil
+	}
+	if trackingNumber == "" {
+		trackingNumber = currentTracking.String
+	}
+	return events.Record(ctx, tx, events.OrderStatusChanged, events.OrderStatusChangedData{
+		OrderID:         id,
+		UserID:          userID,
+		OldStatus:       currentStatus,
+		NewStatus:       status,
+		TrackingNumber:  trackingNumber,
+		TrackingChanged: trackingChanged,
+	})
+}
+
+// VerifyOrderPayment marks an order's payment as verified and updates the
+// payment reference. A pending order moves to processing. PaymentVerified is
+// recorded the first time an order's payment is verified.
+func VerifyOrderPayment(ctx context.Context, id int64, reference string) error {
+	ctx, span := startSpan(ctx, "models.VerifyOrderPayment")
+	defer span.End()
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		return verifyOrderPayment(ctx, tx, id, reference)
+	})
 }
 
-// VerifyOrderPayment marks an order's payment as verified and updates the payment reference
-func VerifyOrderPayment(id int64, reference string) error {
-	// Check if order exists
-	var exists bool
-	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM orders WHERE OrderID = ?)", id).Scan(&exists)
+// verifyOrderPayment is VerifyOrderPayment inside a transaction, so payments
+// and proof reviews commit together with the order they pay for
+func verifyOrderPayment(ctx context.Context, tx *sql.Tx, id int64, reference string) error {
+	var userID int64
+	var status string
+	var verified bool
+	var total float64
+	err := tx.QueryRowContext(ctx,
+		"SELECT UserID, Status, PaymentVerified, TotalAmount FROM orders WHERE OrderID = ?", id,
+	).Scan(&userID, &status, &verified, &total)
+	if err == sql.ErrNoRows {
+		return NotFoundError("order not found")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to check if order exists: %v", err)
+		return fmt.Errorf("failed to check order: %v", err)
 	}
-
-	if !exists {
-		return fmt.Errorf("order not found")
+	before, err := getOrderAudit(ctx, tx, id)
+	if err != nil {
+		return err
 	}
 
 	// Update payment verification
-	_, err = database.DB.Exec(
+	_, err = tx.ExecContext(ctx,
 		"UPDATE orders SET PaymentVerified = 1, PaymentReference = ? WHERE OrderID = ?",
 		reference, id,
 	)
@@ -412,120 +656,107 @@ func VerifyOrderPayment(id int64, reference string) error {
 		return fmt.Errorf("failed to verify payment: %v", err)
 	}
 
-	// If order is in pending status, move to processing
-	var status string
-	err = database.DB.QueryRow("SELECT Status FROM orders WHERE OrderID = ?", id).Scan(&status)
-	if err != nil {
-		log.Printf("Warning: Failed to get order status: %v", err)
-	} else if status == "pending" {
-		err = UpdateOrderStatus(id, "processing")
+	if !verified {
+		err := events.Record(ctx, tx, events.PaymentVerified, events.PaymentVerifiedData{
+			OrderID:   id,
+			UserID:    userID,
+			Amount:    total,
+			Reference: reference,
+		})
 		if err != nil {
-			log.Printf("Warning: Failed to update order status: %v", err)
+			return err
 		}
 	}
 
-	return nil
+	// If order is in pending status, move to processing
+	if status == "pending" {
+		if err := setOrderStatus(ctx, tx, id, "processing", ""); err != nil {
+			return err
+		}
+	}
+
+	after, err := getOrderAudit(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	return recordAudit(ctx, tx, AuditEntry{
+		Action:     AuditOrderPaymentVerified,
+		TargetType: "order",
+		TargetID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      after,
+	})
 }
 
 // GetOrderCount returns the total number of orders
-func GetOrderCount() (int, error) {
+func GetOrderCount(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "models.GetOrderCount")
+	defer span.End()
+
 	var count int
-	err := database.DB.QueryRow("SELECT COUNT(*) FROM orders").Scan(&count)
+	err := database.ReadDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count orders: %v", err)
 	}
 	return count, nil
 }
 
-// GetTotalRevenue returns the total revenue from all orders
-func GetTotalRevenue() (float64, error) {
+// CountOrdersByStatus returns the number of orders in each status, including
+// statuses no order is in
+func CountOrdersByStatus(ctx context.Context) (map[string]int, error) {
+	ctx, span := startSpan(ctx, "models.CountOrdersByStatus")
+	defer span.End()
+
+	rows, err := database.ReadDB.QueryContext(ctx, "SELECT Status, COUNT(*) FROM orders GROUP BY Status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count orders by status: %v", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(orderStatuses))
+	for _, s := range orderStatuses {
+		counts[s] = 0
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan order count: %v", err)
+		}
+		counts[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count orders by status: %v", err)
+	}
+	return counts, nil
+}
+
+// GetTotalRevenue returns the total revenue from paid orders, net of refunds
+func GetTotalRevenue(ctx context.Context) (float64, error) {
+	ctx, span := startSpan(ctx, "models.GetTotalRevenue")
+	defer span.End()
+
 	var total float64
-	err := database.DB.QueryRow("SELECT COALESCE(SUM(TotalAmount), 0) FROM orders WHERE PaymentVerified = 1").Scan(&total)
+	err := database.ReadDB.QueryRowContext(ctx, "SELECT COALESCE(SUM(TotalAmount - RefundedAmount), 0) FROM orders WHERE PaymentVerified = 1").Scan(&total)
 	if err != nil {
 		return 0, fmt.Errorf("failed to calculate total revenue: %v", err)
 	}
-	return total, nil
+	return roundMoney(total), nil
 }
 
 // GetRecentOrders returns the most recent orders with a limit
-func GetRecentOrders(limit int) ([]Order, error) {
-	// Get recent orders
-	rows, err := database.DB.Query(`
-		SELECT OrderID, UserID, Status, ShippingAddress, PaymentMethod, TotalAmount, CreatedAt, PaymentVerified, PaymentReference, TrackingNumber
-		FROM orders 
+func GetRecentOrders(ctx context.Context, limit int) ([]Order, error) {
+	ctx, span := startSpan(ctx, "models.GetRecentOrders")
+	defer span.End()
+
+	orders, err := queryOrders(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
 		ORDER BY CreatedAt DESC
 		LIMIT ?
 	`, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent orders: %v", err)
 	}
-	defer rows.Close()
-
-	// Initialize orders as an empty slice to ensure we return an empty array instead of null
-	orders := []Order{}
-
-	for rows.Next() {
-		var order Order
-		var createdAt string
-		var paymentReference, trackingNumber sql.NullString
-
-		err := rows.Scan(
-			&order.OrderID,
-			&order.UserID,
-			&order.Status,
-			&order.ShippingAddress,
-			&order.PaymentMethod,
-			&order.TotalAmount,
-			&createdAt,
-			&order.PaymentVerified,
-			&paymentReference,
-			&trackingNumber,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %v", err)
-		}
-
-		// Parse date
-		order.OrderDate, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-
-		// Handle nullable fields
-		if paymentReference.Valid {
-			order.PaymentReference = paymentReference.String
-		}
-		if trackingNumber.Valid {
-			order.TrackingNumber = trackingNumber.String
-		}
-
-		// Get order items
-		itemRows, err := database.DB.Query(`
-			SELECT od.ProductID, p.Name, od.Quantity, od.Price
-			FROM order_details od
-			JOIN products p ON od.ProductID = p.ProductID
-			WHERE od.OrderID = ?
-		`, order.OrderID)
-		if err == nil {
-			order.Items = make([]OrderItem, 0)
-			for itemRows.Next() {
-				var item OrderItem
-				err := itemRows.Scan(
-					&item.ProductID,
-					&item.Name,
-					&item.Quantity,
-					&item.PriceAtPurchase,
-				)
-				if err == nil {
-					order.Items = append(order.Items, item)
-				}
-			}
-			itemRows.Close()
-		}
-
-		orders = append(orders, order)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating orders: %v", err)
-	}
-
 	return orders, nil
 }
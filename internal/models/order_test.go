@@ -0,0 +1,70 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/models"
+)
+
+func TestCreateOrderMatchesGetOrder(t *testing.T) {
+	user := dbtest.NewUser(t, "customer")
+	created := dbtest.PlaceOrder(t, user.UserID, models.PaymentCashOnDelivery)
+
+	got, err := models.GetOrderByID(context.Background(), created.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.RefundStatus != got.RefundStatus {
+		t.Errorf("created order refund_status = %q, stored %q", created.RefundStatus, got.RefundStatus)
+	}
+	if created.Status != got.Status || created.PaymentVerified != got.PaymentVerified || created.TotalAmount != got.TotalAmount {
+		t.Errorf("created order = %+v, stored %+v", created, got)
+	}
+}
+
+func TestCreateOrderCancelledMidTransaction(t *testing.T) {
+	user := dbtest.NewUser(t, "customer")
+	if err := models.AddToCart(context.Background(), user.UserID, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	before, err := models.GetProductByID(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancel once the order row is written and its items are being added
+	ctx, reached := cancelAt(t, "INSERT INTO order_details")
+	if _, err := models.CreateOrder(ctx, user.UserID, dbtest.Address, models.PaymentCashOnDelivery); err == nil {
+		t.Fatal("CreateOrder succeeded after its context was cancelled")
+	}
+	if !reached() {
+		t.Fatal("CreateOrder never inserted order items")
+	}
+
+	orders, err := models.GetOrdersByUserID(context.Background(), user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("cancelled checkout left %d orders", len(orders))
+	}
+	cart, err := models.GetCartByUserID(context.Background(), user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cart.Items) != 1 {
+		t.Errorf("cart has %d items after cancelled checkout, want 1", len(cart.Items))
+	}
+	after, err := models.GetProductByID(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != before.Stock {
+		t.Errorf("stock = %d after cancelled checkout, want %d", after.Stock, before.Stock)
+	}
+
+	// The writer connection is usable again
+	dbtest.PlaceOrder(t, user.UserID, models.PaymentCashOnDelivery)
+}
@@ -0,0 +1,250 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go_module/internal/database"
+	"go_module/internal/payments"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+)
+
+// Payment is one attempt to pay for an order through a payment provider
+type Payment struct {
+	PaymentID     int64     `json:"payment_id"`
+	OrderID       int64     `json:"order_id"`
+	Provider      string    `json:"provider"`
+	Method        string    `json:"method"`
+	Attempt       int       `json:"attempt"`
+	Amount        float64   `json:"amount"`
+	Currency      string    `json:"currency"`
+	Status        string    `json:"status"`
+	ProviderRef   string    `json:"provider_ref,omitempty"`
+	CheckoutURL   string    `json:"checkout_url,omitempty"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// paymentColumns is the column list scanPayment expects
+const paymentColumns = `PaymentID, OrderID, Provider, Method, Attempt, Amount, Currency, Status,
+	ProviderRef, CheckoutURL, FailureReason, CreatedAt, UpdatedAt`
+
+// scanPayment reads one row selected with paymentColumns
+func scanPayment(row interface{ Scan(...interface{}) error }) (*Payment, error) {
+	var p Payment
+	var providerRef, checkoutURL, failureReason sql.NullString
+	var createdAt, updatedAt string
+
+	err := row.Scan(
+		&p.PaymentID,
+		&p.OrderID,
+		&p.Provider,
+		&p.Method,
+		&p.Attempt,
+		&p.Amount,
+		&p.Currency,
+		&p.Status,
+		&providerRef,
+		&checkoutURL,
+		&failureReason,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p.ProviderRef = providerRef.String
+	p.CheckoutURL = checkoutURL.String
+	p.FailureReason = failureReason.String
+	p.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	p.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+
+	return &p, nil
+}
+
+// CreatePayment records a new pending payment attempt for an order
+func CreatePayment(ctx context.Context, orderID int64, provider, method string, amount float64) (*Payment, error) {
+	ctx, span := startSpan(ctx, "models.CreatePayment")
+	defer span.End()
+
+	result, err := database.DB.ExecContext(ctx, `
+		INSERT INTO payments (OrderID, Provider, Method, Attempt, Amount, Currency, Status, CreatedAt, UpdatedAt)
+		VALUES (?, ?, ?, (SELECT COUNT(*) + 1 FROM payments WHERE OrderID = ?), ?, 'PHP', ?, datetime('now'), datetime('now'))
+	`, orderID, provider, method, orderID, amount, payments.StatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment ID: %v", err)
+	}
+
+	return GetPaymentByID(ctx, id)
+}
+
+// GetPaymentByID returns a single payment attempt
+func GetPaymentByID(ctx context.Context, id int64) (*Payment, error) {
+	ctx, span := startSpan(ctx, "models.GetPaymentByID")
+	defer span.End()
+
+	p, err := scanPayment(database.ReadDB.QueryRowContext(ctx,
+		"SELECT "+paymentColumns+" FROM payments WHERE PaymentID = ?", id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("payment not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment: %v", err)
+	}
+	return p, nil
+}
+
+// GetPaymentsByOrderID returns every payment attempt for an order, oldest first
+func GetPaymentsByOrderID(ctx context.Context, orderID int64) ([]Payment, error) {
+	ctx, span := startSpan(ctx, "models.GetPaymentsByOrderID")
+	defer span.End()
+
+	rows, err := database.ReadDB.QueryContext(ctx,
+		"SELECT "+paymentColumns+" FROM payments WHERE OrderID = ? ORDER BY Attempt", orderID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payments: %v", err)
+	}
+	defer rows.Close()
+
+	result := []Payment{}
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment: %v", err)
+		}
+		result = append(result, *p)
+	}
+
+	return result, rows.Err()
+}
+
+// SetPaymentIntent stores the provider's reference for a payment attempt
+func SetPaymentIntent(ctx context.Context, paymentID int64, intent *payments.Intent) error {
+	ctx, span := startSpan(ctx, "models.SetPaymentIntent")
+	defer span.End()
+
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE payments
+		SET ProviderRef = ?, CheckoutURL = ?, Status = ?, UpdatedAt = datetime('now')
+		WHERE PaymentID = ?
+	`, intent.ProviderRef, intent.CheckoutURL, intent.Status, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to update payment: %v", err)
+	}
+	return nil
+}
+
+// MarkPaymentFailed records why a payment attempt failed
+func MarkPaymentFailed(ctx context.Context, paymentID int64, reason string) error {
+	ctx, span := startSpan(ctx, "models.MarkPaymentFailed")
+	defer span.End()
+
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE payments
+		SET Status = ?, FailureReason = ?, UpdatedAt = datetime('now')
+		WHERE PaymentID = ?
+	`, payments.StatusFailed, reason, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to update payment: %v", err)
+	}
+	return nil
+}
+
+// ApplyPaymentEvent updates the payment referenced by a verified webhook event.
+// Events are recorded by ID so redelivered webhooks are ignored. A successful
+// payment verifies the order in the same transaction, and is rejected unless
+// its amount and currency match the payment.
+func ApplyPaymentEvent(ctx context.Context, provider string, event *payments.WebhookEvent) (*Payment, error) {
+	ctx, span := startSpan(ctx, "models.ApplyPaymentEvent")
+	defer span.End()
+
+	p, err := scanPayment(database.ReadDB.QueryRowContext(ctx,
+		"SELECT "+paymentColumns+" FROM payments WHERE Provider = ? AND ProviderRef = ?",
+		provider, event.ProviderRef,
+	))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("payment not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment: %v", err)
+	}
+
+	// A payment only counts if the gateway captured what was asked for
+	if event.Type == payments.EventPaymentSucceeded &&
+		(math.Abs(event.Amount-p.Amount) >= 0.005 || !strings.EqualFold(event.Currency, p.Currency)) {
+		slog.WarnContext(ctx, "Rejected payment event with wrong amount",
+			"event_id", event.ID, "payment_id", p.PaymentID,
+			"amount", event.Amount, "currency", event.Currency,
+			"expected_amount", p.Amount, "expected_currency", p.Currency)
+		return nil, ValidationError("payment amount %.2f %s does not match %.2f %s",
+			event.Amount, event.Currency, p.Amount, p.Currency)
+	}
+
+	var status string
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		status = ""
+		if event.ID != "" {
+			result, err := tx.ExecContext(ctx, `
+				INSERT OR IGNORE INTO payment_events (PaymentID, Provider, EventID, Type, ReceivedAt)
+				VALUES (?, ?, ?, ?, datetime('now'))
+			`, p.PaymentID, provider, event.ID, event.Type)
+			if err != nil {
+				return fmt.Errorf("failed to record payment event: %v", err)
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				slog.InfoContext(ctx, "Ignoring duplicate payment event", "event_id", event.ID, "payment_id", p.PaymentID)
+				return nil
+			}
+		}
+
+		var failureReason string
+		switch event.Type {
+		case payments.EventPaymentSucceeded:
+			status = payments.StatusSucceeded
+		case payments.EventPaymentFailed:
+			status = payments.StatusFailed
+			failureReason = event.FailureReason
+		case payments.EventRefundSucceeded:
+			status = payments.StatusRefunded
+		default:
+			slog.InfoContext(ctx, "Ignoring unhandled payment event", "event_type", event.Type)
+			return nil
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE payments
+			SET Status = ?, FailureReason = NULLIF(?, ''), UpdatedAt = datetime('now')
+			WHERE PaymentID = ?
+		`, status, failureReason, p.PaymentID)
+		if err != nil {
+			return fmt.Errorf("failed to update payment: %v", err)
+		}
+
+		// The event is only recorded as seen if the order is paid with it,
+		// so a failed verification is retried on redelivery
+		if status == payments.StatusSucceeded {
+			return verifyOrderPayment(ctx, tx, p.OrderID, p.ProviderRef)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return p, nil
+	}
+
+	return GetPaymentByID(ctx, p.PaymentID)
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// PaymentMethodConfig describes a payment method offered at checkout and the
+// rules an order must satisfy to use it
+type PaymentMethodConfig struct {
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	Enabled      bool    `json:"enabled"`
+	MinAmount    float64 `json:"min_amount"`
+	MaxAmount    float64 `json:"max_amount,omitempty"` // 0 means no limit
+	Instructions string  `json:"instructions,omitempty"`
+	// PayOnDelivery methods are collected by the courier, so the order does
+	// not wait for a payment before processing
+	PayOnDelivery bool `json:"pay_on_delivery"`
+	// RequiresProof methods need the customer to submit a receipt or
+	// reference number before an admin verifies the payment
+	RequiresProof bool `json:"requires_proof"`
+	// AllowedZones and AllowedProvinces restrict where the method can be
+	// used; both empty means everywhere
+	AllowedZones     []string `json:"allowed_zones,omitempty"`
+	AllowedProvinces []string `json:"allowed_provinces,omitempty"`
+}
+
+// Payment method codes
+const (
+	PaymentCashOnDelivery = "cash_on_delivery"
+	PaymentBankTransfer   = "bank_transfer"
+	PaymentGCash          = "gcash"
+)
+
+// paymentMethods is the registry of payment methods in display order
+var paymentMethods = []PaymentMethodConfig{
+	{
+		Code:          PaymentCashOnDelivery,
+		Name:          "Cash on Delivery",
+		Enabled:       true,
+		MinAmount:     0,
+		MaxAmount:     10000,
+		Instructions:  "Pay the courier in cash when your order arrives.",
+		PayOnDelivery: true,
+		AllowedZones:  []string{ZoneMetroManila, ZoneLuzon},
+	},
+	{
+		Code:          PaymentBankTransfer,
+		Name:          "Bank Transfer",
+		Enabled:       true,
+		MinAmount:     500,
+		Instructions:  "Transfer the order total and upload your deposit slip or reference number.",
+		RequiresProof: true,
+	},
+	{
+		Code:          PaymentGCash,
+		Name:          "GCash",
+		Enabled:       true,
+		MinAmount:     1,
+		MaxAmount:     100000,
+		Instructions:  "Pay online with GCash, or send to our GCash number and upload the receipt.",
+		RequiresProof: true,
+	},
+}
+
+// LoadPaymentMethodConfig replaces the default payment methods with the JSON
+// array in the file named by PAYMENT_METHODS_CONFIG, if set
+func LoadPaymentMethodConfig() error {
+	path := os.Getenv("PAYMENT_METHODS_CONFIG")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read payment method config: %v", err)
+	}
+
+	var methods []PaymentMethodConfig
+	if err := json.Unmarshal(data, &methods); err != nil {
+		return fmt.Errorf("failed to parse payment method config: %v", err)
+	}
+	for _, m := range methods {
+		if m.Code == "" {
+			return fmt.Errorf("payment method config has an entry without a code")
+		}
+	}
+
+	paymentMethods = methods
+	slog.Info("Loaded payment methods", "count", len(methods), "path", path)
+	return nil
+}
+
+// GetPaymentMethods returns the enabled payment methods
+func GetPaymentMethods() []PaymentMethodConfig {
+	enabled := []PaymentMethodConfig{}
+	for _, m := range paymentMethods {
+		if m.Enabled {
+			enabled = append(enabled, m)
+		}
+	}
+	return enabled
+}
+
+// GetPaymentMethod returns an enabled payment method by code
+func GetPaymentMethod(code string) (*PaymentMethodConfig, error) {
+	for i := range paymentMethods {
+		if paymentMethods[i].Code == code && paymentMethods[i].Enabled {
+			return &paymentMethods[i], nil
+		}
+	}
+	return nil, FieldError("payment_method", "unknown payment method: %s", code)
+}
+
+// CheckOrder verifies that an order total and destination satisfy the
+// method's rules. Error messages are safe to show to customers.
+func (m *PaymentMethodConfig) CheckOrder(total float64, province, zone string) error {
+	if total < m.MinAmount {
+		return ValidationError("payment method %s requires a minimum order of ₱%.2f", m.Name, m.MinAmount)
+	}
+	if m.MaxAmount > 0 && total > m.MaxAmount {
+		return ValidationError("payment method %s is limited to orders up to ₱%.2f", m.Name, m.MaxAmount)
+	}
+
+	if len(m.AllowedZones) == 0 && len(m.AllowedProvinces) == 0 {
+		return nil
+	}
+	for _, z := range m.AllowedZones {
+		if z == zone {
+			return nil
+		}
+	}
+	for _, p := range m.AllowedProvinces {
+		if strings.EqualFold(strings.TrimSpace(p), strings.TrimSpace(province)) {
+			return nil
+		}
+	}
+	return ValidationError("payment method %s is not available for deliveries to %s", m.Name, province)
+}
@@ -0,0 +1,323 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go_module/internal/database"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Proof review statuses
+const (
+	ProofPending  = "pending"
+	ProofApproved = "approved"
+	ProofRejected = "rejected"
+)
+
+// PaymentProof is a receipt screenshot and reference number submitted by a
+// customer for a bank transfer or GCash order
+type PaymentProof struct {
+	ProofID         int64      `json:"proof_id"`
+	OrderID         int64      `json:"order_id"`
+	UserID          int64      `json:"user_id"`
+	Reference       string     `json:"reference"`
+	ImagePath       string     `json:"-"`
+	ContentType     string     `json:"content_type"`
+	Status          string     `json:"status"`
+	RejectionReason string     `json:"rejection_reason,omitempty"`
+	ReviewedBy      int64      `json:"reviewed_by,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	SubmittedAt     time.Time  `json:"submitted_at"`
+	// Order details shown in the admin review queue
+	OrderTotal    float64 `json:"order_total,omitempty"`
+	PaymentMethod string  `json:"payment_method,omitempty"`
+}
+
+// paymentProofColumns is the column list scanPaymentProof expects
+const paymentProofColumns = `pp.ProofID, pp.OrderID, pp.UserID, pp.Reference, pp.ImagePath, pp.ContentType,
+	pp.Status, pp.RejectionReason, pp.ReviewedBy, pp.ReviewedAt, pp.SubmittedAt,
+	o.TotalAmount, o.PaymentMethod`
+
+// scanPaymentProof reads one row selected with paymentProofColumns
+func scanPaymentProof(row interface{ Scan(...interface{}) error }) (*PaymentProof, error) {
+	var p PaymentProof
+	var rejectionReason, reviewedAt sql.NullString
+	var reviewedBy sql.NullInt64
+	var submittedAt string
+
+	err := row.Scan(
+		&p.ProofID,
+		&p.OrderID,
+		&p.UserID,
+		&p.Reference,
+		&p.ImagePath,
+		&p.ContentType,
+		&p.Status,
+		&rejectionReason,
+		&reviewedBy,
+		&reviewedAt,
+		&submittedAt,
+		&p.OrderTotal,
+		&p.PaymentMethod,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p.RejectionReason = rejectionReason.String
+	p.ReviewedBy = reviewedBy.Int64
+	if reviewedAt.Valid {
+		t, _ := time.Parse("2006-01-02 15:04:05", reviewedAt.String)
+		p.ReviewedAt = &t
+	}
+	p.SubmittedAt, _ = time.Parse("2006-01-02 15:04:05", submittedAt)
+
+	return &p, nil
+}
+
+// CheckPaymentProofOrder returns one of the user's orders if it accepts a
+// proof of payment: its payment method requires proof, it is not yet paid or
+// cancelled, and no other submission awaits review. Orders of other users
+// are not found.
+func CheckPaymentProofOrder(ctx context.Context, userID, orderID int64) (*Order, error) {
+	ctx, span := startSpan(ctx, "models.CheckPaymentProofOrder")
+	defer span.End()
+
+	order, err := GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != userID {
+		return nil, NotFoundError("order not found")
+	}
+
+	method, err := GetPaymentMethod(order.PaymentMethod)
+	if err != nil || !method.RequiresProof {
+		return nil, ValidationError("payment method does not accept proof of payment")
+	}
+	if order.PaymentVerified {
+		return nil, ConflictError("order is already paid")
+	}
+	if order.Status == "cancelled" {
+		return nil, ConflictError("order is cancelled")
+	}
+
+	var pending int
+	err = database.ReadDB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM payment_proofs WHERE OrderID = ? AND Status = ?", orderID, ProofPending,
+	).Scan(&pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pending proofs: %v", err)
+	}
+	if pending > 0 {
+		return nil, ConflictError("a payment proof is already awaiting review")
+	}
+
+	return order, nil
+}
+
+// CreatePaymentProof records a customer's proof of payment for review, once
+// CheckPaymentProofOrder accepts the order. The order's state is checked
+// again in the insert's transaction, so concurrent uploads cannot both leave
+// a proof awaiting review.
+func CreatePaymentProof(ctx context.Context, userID, orderID int64, reference, imagePath, contentType string) (*PaymentProof, error) {
+	ctx, span := startSpan(ctx, "models.CreatePaymentProof")
+	defer span.End()
+
+	if _, err := CheckPaymentProofOrder(ctx, userID, orderID); err != nil {
+		return nil, err
+	}
+
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var paid bool
+		var status string
+		var pending int
+		err := tx.QueryRowContext(ctx, `
+			SELECT o.PaymentVerified, o.Status,
+				(SELECT COUNT(*) FROM payment_proofs WHERE OrderID = o.OrderID AND Status = ?)
+			FROM orders o
+			WHERE o.OrderID = ?
+		`, ProofPending, orderID).Scan(&paid, &status, &pending)
+		if err != nil {
+			return fmt.Errorf("failed to check order: %v", err)
+		}
+		if paid {
+			return ConflictError("order is already paid")
+		}
+		if status == "cancelled" {
+			return ConflictError("order is cancelled")
+		}
+		if pending > 0 {
+			return ConflictError("a payment proof is already awaiting review")
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO payment_proofs (OrderID, UserID, Reference, ImagePath, ContentType, Status, SubmittedAt)
+			VALUES (?, ?, ?, ?, ?, ?, datetime('now'))
+		`, orderID, userID, reference, imagePath, contentType, ProofPending)
+		if err != nil {
+			return fmt.Errorf("failed to save payment proof: %v", err)
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get payment proof ID: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Payment proof submitted", "proof_id", id, "order_id", orderID)
+	return GetPaymentProofByID(ctx, id)
+}
+
+// GetPaymentProofByID returns a single payment proof
+func GetPaymentProofByID(ctx context.Context, id int64) (*PaymentProof, error) {
+	ctx, span := startSpan(ctx, "models.GetPaymentProofByID")
+	defer span.End()
+
+	p, err := scanPaymentProof(database.ReadDB.QueryRowContext(ctx, `
+		SELECT `+paymentProofColumns+`
+		FROM payment_proofs pp
+		JOIN orders o ON pp.OrderID = o.OrderID
+		WHERE pp.ProofID = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("payment proof not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment proof: %v", err)
+	}
+	return p, nil
+}
+
+// GetPaymentProofsByOrderID returns the proofs submitted for an order, newest first
+func GetPaymentProofsByOrderID(ctx context.Context, orderID int64) ([]PaymentProof, error) {
+	ctx, span := startSpan(ctx, "models.GetPaymentProofsByOrderID")
+	defer span.End()
+
+	return queryPaymentProofs(ctx, `
+		SELECT `+paymentProofColumns+`
+		FROM payment_proofs pp
+		JOIN orders o ON pp.OrderID = o.OrderID
+		WHERE pp.OrderID = ?
+		ORDER BY pp.ProofID DESC
+	`, orderID)
+}
+
+// GetPaymentProofsByStatus returns the review queue for a status, oldest
+// first. An empty status returns every proof.
+func GetPaymentProofsByStatus(ctx context.Context, status string) ([]PaymentProof, error) {
+	ctx, span := startSpan(ctx, "models.GetPaymentProofsByStatus")
+	defer span.End()
+
+	return queryPaymentProofs(ctx, `
+		SELECT `+paymentProofColumns+`
+		FROM payment_proofs pp
+		JOIN orders o ON pp.OrderID = o.OrderID
+		WHERE ? = '' OR pp.Status = ?
+		ORDER BY pp.ProofID
+	`, status, status)
+}
+
+func queryPaymentProofs(ctx context.Context, query string, args ...interface{}) ([]PaymentProof, error) {
+	rows, err := database.ReadDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment proofs: %v", err)
+	}
+	defer rows.Close()
+
+	proofs := []PaymentProof{}
+	for rows.Next() {
+		p, err := scanPaymentProof(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment proof: %v", err)
+		}
+		proofs = append(proofs, *p)
+	}
+
+	return proofs, rows.Err()
+}
+
+// ReviewPaymentProof approves or rejects a pending proof. Approval verifies
+// the order's payment using the submitted reference, in the same transaction,
+// and is refused once the order is paid or cancelled.
+func ReviewPaymentProof(ctx context.Context, proofID, reviewerID int64, approve bool, reason string) (*PaymentProof, error) {
+	ctx, span := startSpan(ctx, "models.ReviewPaymentProof")
+	defer span.End()
+
+	status := ProofRejected
+	if approve {
+		status = ProofApproved
+		reason = ""
+	} else if reason == "" {
+		return nil, FieldError("reason", "a rejection reason is required")
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var current, reference, orderStatus string
+		var orderID int64
+		var paid bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT pp.Status, pp.OrderID, pp.Reference, o.Status, o.PaymentVerified
+			FROM payment_proofs pp
+			JOIN orders o ON pp.OrderID = o.OrderID
+			WHERE pp.ProofID = ?
+		`, proofID).Scan(&current, &orderID, &reference, &orderStatus, &paid)
+		if err == sql.ErrNoRows {
+			return NotFoundError("payment proof not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch payment proof: %v", err)
+		}
+		if current != ProofPending {
+			return ConflictError("payment proof has already been reviewed")
+		}
+		if approve && paid {
+			return ConflictError("order is already paid")
+		}
+		if approve && orderStatus == "cancelled" {
+			return ConflictError("order is cancelled")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE payment_proofs
+			SET Status = ?, RejectionReason = NULLIF(?, ''), ReviewedBy = ?, ReviewedAt = datetime('now')
+			WHERE ProofID = ?
+		`, status, reason, reviewerID, proofID)
+		if err != nil {
+			return fmt.Errorf("failed to review payment proof: %v", err)
+		}
+
+		after := map[string]string{"status": status}
+		if reason != "" {
+			after["rejection_reason"] = reason
+		}
+		err = recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditPaymentProofReview,
+			TargetType: "payment_proof",
+			TargetID:   strconv.FormatInt(proofID, 10),
+			Before:     map[string]string{"status": current},
+			After:      after,
+		})
+		if err != nil {
+			return err
+		}
+
+		if approve {
+			return verifyOrderPayment(ctx, tx, orderID, reference)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetPaymentProofByID(ctx, proofID)
+}
@@ -0,0 +1,162 @@
+package models_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go_module/internal/database"
+	"go_module/internal/dbtest"
+	"go_module/internal/models"
+
+	"go.opentelemetry.io/otel"
+)
+
+// pendingProof places a bank transfer order and submits a proof for it
+func pendingProof(t *testing.T) (*models.Order, *models.PaymentProof) {
+	t.Helper()
+
+	user := dbtest.NewUser(t, "customer")
+	order := dbtest.PlaceOrder(t, user.UserID, models.PaymentBankTransfer)
+	proof, err := models.CreatePaymentProof(context.Background(), user.UserID, order.OrderID,
+		"REF-"+t.Name(), "proof.png", "image/png")
+	if err != nil {
+		t.Fatalf("create payment proof: %v", err)
+	}
+	return order, proof
+}
+
+func TestReviewPaymentProofRetriedAfterVerifyFails(t *testing.T) {
+	order, proof := pendingProof(t)
+	reviewer := dbtest.NewUser(t, "admin")
+
+	ctx, reached := cancelAt(t, "UPDATE orders SET PaymentVerified")
+	if _, err := models.ReviewPaymentProof(ctx, proof.ProofID, reviewer.UserID, true, ""); err == nil {
+		t.Fatal("ReviewPaymentProof succeeded after its context was cancelled")
+	}
+	if !reached() {
+		t.Fatal("ReviewPaymentProof never verified the order")
+	}
+
+	// The proof is still pending, so it can be approved again
+	got, err := models.ReviewPaymentProof(context.Background(), proof.ProofID, reviewer.UserID, true, "")
+	if err != nil {
+		t.Fatalf("approve again: %v", err)
+	}
+	if got.Status != models.ProofApproved {
+		t.Errorf("proof status = %q, want %q", got.Status, models.ProofApproved)
+	}
+	o, err := models.GetOrderByID(context.Background(), order.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.PaymentVerified || o.PaymentReference != proof.Reference {
+		t.Errorf("order verified = %v with reference %q, want verified with %q",
+			o.PaymentVerified, o.PaymentReference, proof.Reference)
+	}
+}
+
+func TestReviewPaymentProofRefusesClosedOrders(t *testing.T) {
+	ctx := context.Background()
+	reviewer := dbtest.NewUser(t, "admin")
+
+	tests := []struct {
+		name  string
+		close func(orderID int64) error
+	}{
+		{"cancelled", func(id int64) error { return models.UpdateOrderStatus(ctx, id, "cancelled", "") }},
+		{"already paid", func(id int64) error { return models.VerifyOrderPayment(ctx, id, "OTHER-REF") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, proof := pendingProof(t)
+			if err := tt.close(order.OrderID); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := models.ReviewPaymentProof(ctx, proof.ProofID, reviewer.UserID, true, "")
+			if !errors.Is(err, models.ErrConflict) {
+				t.Fatalf("ReviewPaymentProof error = %v, want conflict", err)
+			}
+			got, err := models.GetPaymentProofByID(ctx, proof.ProofID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != models.ProofPending {
+				t.Errorf("proof status = %q, want %q", got.Status, models.ProofPending)
+			}
+
+			// It can still be rejected
+			if _, err := models.ReviewPaymentProof(ctx, proof.ProofID, reviewer.UserID, false, "order closed"); err != nil {
+				t.Errorf("reject: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreatePaymentProofConcurrent(t *testing.T) {
+	user := dbtest.NewUser(t, "customer")
+	order := dbtest.PlaceOrder(t, user.UserID, models.PaymentBankTransfer)
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), t.Name())
+	defer root.End()
+	checked := func() int {
+		n := 0
+		for _, s := range spans.Ended() {
+			if s.SpanContext().TraceID() == root.SpanContext().TraceID() && s.Name() == "models.CheckPaymentProofOrder" {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Hold the writer until every upload has passed the read-only checks, so
+	// all of them race to insert
+	const uploads = 8
+	errs := make(chan error, uploads)
+	var wg sync.WaitGroup
+	err := database.WithTx(context.Background(), func(tx *sql.Tx) error {
+		for i := 0; i < uploads; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := models.CreatePaymentProof(ctx, user.UserID, order.OrderID,
+					fmt.Sprintf("REF-%d", i), "proof.png", "image/png")
+				errs <- err
+			}(i)
+		}
+		for checked() < uploads {
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, models.ErrConflict):
+			t.Errorf("CreatePaymentProof error = %v, want conflict", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d concurrent uploads were accepted, want 1", created)
+	}
+	proofs, err := models.GetPaymentProofsByOrderID(context.Background(), order.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proofs) != 1 {
+		t.Errorf("order has %d proofs, want 1", len(proofs))
+	}
+}
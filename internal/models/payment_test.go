@@ -0,0 +1,139 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/models"
+	"go_module/internal/payments"
+)
+
+// pendingPayment places a GCash order and starts a payment for its total
+func pendingPayment(t *testing.T) (*models.Order, *models.Payment) {
+	t.Helper()
+	ctx := context.Background()
+
+	user := dbtest.NewUser(t, "customer")
+	order := dbtest.PlaceOrder(t, user.UserID, models.PaymentGCash)
+	p, err := models.CreatePayment(ctx, order.OrderID, "fake", models.PaymentGCash, order.TotalAmount)
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	intent := &payments.Intent{ProviderRef: "ref_" + t.Name(), Status: payments.StatusPending}
+	if err := models.SetPaymentIntent(ctx, p.PaymentID, intent); err != nil {
+		t.Fatalf("set payment intent: %v", err)
+	}
+	return order, p
+}
+
+func TestApplyPaymentEventRejectsMismatch(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		amount   float64
+		currency string
+	}{
+		{"short amount", -1, "PHP"},
+		{"wrong currency", 0, "USD"},
+		{"missing currency", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, p := pendingPayment(t)
+
+			_, err := models.ApplyPaymentEvent(ctx, "fake", &payments.WebhookEvent{
+				ID:          "evt_" + t.Name(),
+				Type:        payments.EventPaymentSucceeded,
+				ProviderRef: "ref_" + t.Name(),
+				Amount:      p.Amount + tt.amount,
+				Currency:    tt.currency,
+			})
+			if !errors.Is(err, models.ErrValidation) {
+				t.Fatalf("ApplyPaymentEvent error = %v, want validation error", err)
+			}
+
+			got, err := models.GetPaymentByID(ctx, p.PaymentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != payments.StatusPending {
+				t.Errorf("payment status = %q, want %q", got.Status, payments.StatusPending)
+			}
+			o, err := models.GetOrderByID(ctx, order.OrderID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.PaymentVerified {
+				t.Error("order payment verified by a mismatched event")
+			}
+		})
+	}
+}
+
+func TestApplyPaymentEventSucceeded(t *testing.T) {
+	ctx := context.Background()
+	order, p := pendingPayment(t)
+
+	got, err := models.ApplyPaymentEvent(ctx, "fake", &payments.WebhookEvent{
+		ID:          "evt_" + t.Name(),
+		Type:        payments.EventPaymentSucceeded,
+		ProviderRef: "ref_" + t.Name(),
+		Amount:      p.Amount,
+		Currency:    "php",
+	})
+	if err != nil {
+		t.Fatalf("ApplyPaymentEvent: %v", err)
+	}
+	if got.Status != payments.StatusSucceeded {
+		t.Errorf("payment status = %q, want %q", got.Status, payments.StatusSucceeded)
+	}
+	o, err := models.GetOrderByID(ctx, order.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.PaymentVerified {
+		t.Error("order payment not verified")
+	}
+}
+
+func TestApplyPaymentEventRetriedAfterVerifyFails(t *testing.T) {
+	order, p := pendingPayment(t)
+	event := &payments.WebhookEvent{
+		ID:          "evt_" + t.Name(),
+		Type:        payments.EventPaymentSucceeded,
+		ProviderRef: "ref_" + t.Name(),
+		Amount:      p.Amount,
+		Currency:    p.Currency,
+	}
+
+	ctx, reached := cancelAt(t, "UPDATE orders SET PaymentVerified")
+	if _, err := models.ApplyPaymentEvent(ctx, "fake", event); err == nil {
+		t.Fatal("ApplyPaymentEvent succeeded after its context was cancelled")
+	}
+	if !reached() {
+		t.Fatal("ApplyPaymentEvent never verified the order")
+	}
+
+	got, err := models.GetPaymentByID(context.Background(), p.PaymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != payments.StatusPending {
+		t.Errorf("payment status = %q after failed verification, want %q", got.Status, payments.StatusPending)
+	}
+
+	// The redelivered event is not a duplicate and pays the order
+	if _, err := models.ApplyPaymentEvent(context.Background(), "fake", event); err != nil {
+		t.Fatalf("redelivered ApplyPaymentEvent: %v", err)
+	}
+	o, err := models.GetOrderByID(context.Background(), order.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.PaymentVerified {
+		t.Error("order not paid after the event was redelivered")
+	}
+}
@@ -1,12 +1,19 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"go_module/internal/database"
+	"go_module/internal/events"
+	"strconv"
 	"time"
 )
 
+// LowStockThreshold is the stock level at or below which a product counts as
+// running low. The admin product list uses the same threshold.
+const LowStockThreshold = 10
+
 type Product struct {
 	ProductID   int64     `json:"product_id"`
 	Name        string    `json:"name"`
@@ -21,14 +28,19 @@ type Product struct {
 	Slug        string    `json:"slug,omitempty"`
 	Size        string    `json:"size,omitempty"`
 	ImageURL    string    `json:"image_url"`
+	WeightKg    float64   `json:"weight_kg"`
+	TaxClass    string    `json:"tax_class"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at,omitempty"`
 }
 
 // Get all products
-func GetAllProducts() ([]Product, error) {
-	rows, err := database.DB.Query(`
-		SELECT ProductID, Name, Description, Price, ImageURL, Stock, CreatedAt 
+func GetAllProducts(ctx context.Context) ([]Product, error) {
+	ctx, span := startSpan(ctx, "models.GetAllProducts")
+	defer span.End()
+
+	rows, err := database.ReadDB.QueryContext(ctx, `
+		SELECT ProductID, Name, Description, Price, ImageURL, Stock, WeightKg, TaxClass, CreatedAt 
 		FROM products
 	`)
 	if err != nil {
@@ -47,6 +59,8 @@ func GetAllProducts() ([]Product, error) {
 			&p.Price,
 			&p.ImageURL,
 			&p.Stock,
+			&p.WeightKg,
+			&p.TaxClass,
 			&createdAt,
 		)
 		if err != nil {
@@ -60,12 +74,15 @@ func GetAllProducts() ([]Product, error) {
 }
 
 // Get product by ID
-func GetProductByID(id int64) (*Product, error) {
+func GetProductByID(ctx context.Context, id int64) (*Product, error) {
+	ctx, span := startSpan(ctx, "models.GetProductByID")
+	defer span.End()
+
 	var p Product
 	var createdAt string
 
-	err := database.DB.QueryRow(`
-		SELECT ProductID, Name, Description, Price, ImageURL, Stock, CreatedAt 
+	err := database.ReadDB.QueryRowContext(ctx, `
+		SELECT ProductID, Name, Description, Price, ImageURL, Stock, WeightKg, TaxClass, CreatedAt 
 		FROM products WHERE ProductID = ?
 	`, id).Scan(
 		&p.ProductID,
@@ -74,145 +91,262 @@ func GetProductByID(id int64) (*Product, error) {
 		&p.Price,
 		&p.ImageURL,
 		&p.Stock,
+		&p.WeightKg,
+		&p.TaxClass,
 		&createdAt,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, NotFoundError("product not found")
 	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch product: %v", err)
 	}
 
 	p.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 	return &p, nil
 }
 
-// Create a new product
-func CreateProduct(name, description string, price float64, imageURL string, stock int) (*Product, error) {
-	result, err := database.DB.Exec(`
-		INSERT INTO products (Name, Description, Price, ImageURL, Stock, CreatedAt) 
-		VALUES (?, ?, ?, ?, ?, datetime('now'))
-	`, name, description, price, imageURL, stock)
+// Create a new product. An empty tax class defaults to standard VAT.
+func CreateProduct(ctx context.Context, name, description string, price float64, imageURL string, stock int, taxClass string) (*Product, error) {
+	ctx, span := startSpan(ctx, "models.CreateProduct")
+	defer span.End()
 
-	if err != nil {
-		return nil, err
+	if taxClass == "" {
+		taxClass = TaxClassStandard
 	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+	if err := ValidateTaxClass(taxClass); err != nil {
 		return nil, err
 	}
 
-	return GetProductByID(id)
-}
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO products (Name, Description, Price, ImageURL, Stock, TaxClass, CreatedAt) 
+			VALUES (?, ?, ?, ?, ?, ?, datetime('now'))
+		`, name, description, price, imageURL, stock, taxClass)
+		if err != nil {
+			return fmt.Errorf("failed to create product: %v", err)
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get product ID: %v", err)
+		}
 
-// Update product
-func UpdateProduct(id int64, name, description string, price float64, imageURL string, stock int) (*Product, error) {
-	_, err := database.DB.Exec(`
-		UPDATE products 
-		SET Name = ?, Description = ?, Price = ?, ImageURL = ?, Stock = ?
-		WHERE ProductID = ?
-	`, name, description, price, imageURL, stock, id)
+		after, err := getProductAudit(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		err = recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditProductCreate,
+			TargetType: "product",
+			TargetID:   strconv.FormatInt(id, 10),
+			After:      after,
+		})
+		if err != nil {
+			return err
+		}
 
+		return events.Record(ctx, tx, events.ProductCreated, events.ProductData{
+			ProductID: id,
+			Name:      name,
+			Price:     price,
+			Stock:     stock,
+			TaxClass:  taxClass,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return GetProductByID(id)
+	return GetProductByID(ctx, id)
 }
 
-// Delete product
-func DeleteProduct(id int64) error {
-	// Start a transaction
-	tx, err := database.DB.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %v", err)
+// Update product. An empty tax class keeps the product's current class.
+func UpdateProduct(ctx context.Context, id int64, name, description string, price float64, imageURL string, stock int, taxClass string) (*Product, error) {
+	ctx, span := startSpan(ctx, "models.UpdateProduct")
+	defer span.End()
+
+	if taxClass != "" {
+		if err := ValidateTaxClass(taxClass); err != nil {
+			return nil, err
+		}
 	}
 
-	// Defer a rollback in case anything fails
-	defer tx.Rollback()
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := getProductAudit(ctx, tx, id)
+		if err != nil {
+			return err
+		}
 
-	// Check if product exists in cart_items
-	var cartItemCount int
-	err = tx.QueryRow("SELECT COUNT(*) FROM cart_items WHERE ProductID = ?", id).Scan(&cartItemCount)
-	if err != nil {
-		return fmt.Errorf("failed to check if product exists in carts: %v", err)
-	}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE products 
+			SET Name = ?, Description = ?, Price = ?, ImageURL = ?, Stock = ?,
+				TaxClass = COALESCE(NULLIF(?, ''), TaxClass)
+			WHERE ProductID = ?
+		`, name, description, price, imageURL, stock, taxClass, id)
+		if err != nil {
+			return fmt.Errorf("failed to update product: %v", err)
+		}
 
-	if cartItemCount > 0 {
-		// Remove product from all carts
-		_, err = tx.Exec("DELETE FROM cart_items WHERE ProductID = ?", id)
+		after, err := getProductAudit(ctx, tx, id)
 		if err != nil {
-			return fmt.Errorf("failed to remove product from carts: %v", err)
+			return err
+		}
+		err = recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditProductUpdate,
+			TargetType: "product",
+			TargetID:   strconv.FormatInt(id, 10),
+			Before:     before,
+			After:      after,
+		})
+		if err != nil {
+			return err
 		}
-	}
 
-	// Check if product exists in order_details
-	var orderDetailCount int
-	err = tx.QueryRow("SELECT COUNT(*) FROM order_details WHERE ProductID = ?", id).Scan(&orderDetailCount)
+		return events.Record(ctx, tx, events.ProductUpdated, events.ProductData{
+			ProductID: id,
+			Name:      name,
+			Price:     price,
+			Stock:     stock,
+			TaxClass:  after.TaxClass,
+		})
+	})
 	if err != nil {
-		return fmt.Errorf("failed to check if product exists in orders: %v", err)
+		return nil, err
 	}
 
-	if orderDetailCount > 0 {
-		// Get product name to preserve in order details
-		var productName string
-		err = tx.QueryRow("SELECT Name FROM products WHERE ProductID = ?", id).Scan(&productName)
+	return GetProductByID(ctx, id)
+}
+
+// Delete product
+func DeleteProduct(ctx context.Context, id int64) error {
+	ctx, span := startSpan(ctx, "models.DeleteProduct")
+	defer span.End()
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := getProductAudit(ctx, tx, id)
 		if err != nil {
-			return fmt.Errorf("failed to get product name: %v", err)
+			return err
 		}
+		name := before.Name
 
-		// Two approaches based on database schema:
-		// 1. Try to set ProductID to NULL (if schema allows)
-		_, err = tx.Exec("UPDATE order_details SET ProductID = NULL WHERE ProductID = ?", id)
+		// Check if product exists in cart_items
+		var cartItemCount int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM cart_items WHERE ProductID = ?", id).Scan(&cartItemCount)
 		if err != nil {
-			// 2. If NULL is not allowed, we have a few options:
-			// Option A: Add "[Deleted]" prefix to the product name to indicate deletion
-			// and keep a record of the deleted product
-			_, err = tx.Exec(`
-				INSERT INTO products (Name, Description, Price, Stock, ImageURL) 
-				VALUES (?, '[Deleted Product]', 0, 0, '')`,
-				"[Deleted] "+productName)
+			return fmt.Errorf("failed to check if product exists in carts: %v", err)
+		}
 
+		if cartItemCount > 0 {
+			// Remove product from all carts
+			_, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE ProductID = ?", id)
 			if err != nil {
-				return fmt.Errorf("failed to create placeholder for deleted product: %v", err)
+				return fmt.Errorf("failed to remove product from carts: %v", err)
 			}
+		}
 
-			// Get the ID of the placeholder product
-			var placeholderID int64
-			err = tx.QueryRow("SELECT last_insert_rowid()").Scan(&placeholderID)
+		// Check if product exists in order_details
+		var orderDetailCount int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM order_details WHERE ProductID = ?", id).Scan(&orderDetailCount)
+		if err != nil {
+			return fmt.Errorf("failed to check if product exists in orders: %v", err)
+		}
+
+		if orderDetailCount > 0 {
+			// Get product name to preserve in order details
+			var productName string
+			err = tx.QueryRowContext(ctx, "SELECT Name FROM products WHERE ProductID = ?", id).Scan(&productName)
 			if err != nil {
-				return fmt.Errorf("failed to get placeholder product ID: %v", err)
+				return fmt.Errorf("failed to get product name: %v", err)
 			}
 
-			// Update order_details to use the placeholder product
-			_, err = tx.Exec("UPDATE order_details SET ProductID = ? WHERE ProductID = ?",
-				placeholderID, id)
+			// Two approaches based on database schema:
+			// 1. Try to set ProductID to NULL (if schema allows)
+			_, err = tx.ExecContext(ctx, "UPDATE order_details SET ProductID = NULL WHERE ProductID = ?", id)
 			if err != nil {
-				return fmt.Errorf("failed to update order details with placeholder: %v", err)
+				// 2. If NULL is not allowed, we have a few options:
+				// Option A: Add "[Deleted]" prefix to the product name to indicate deletion
+				// and keep a record of the deleted product
+				_, err = tx.ExecContext(ctx, `
+					INSERT INTO products (Name, Description, Price, Stock, ImageURL) 
+					VALUES (?, '[Deleted Product]', 0, 0, '')`,
+					"[Deleted] "+productName)
+
+				if err != nil {
+					return fmt.Errorf("failed to create placeholder for deleted product: %v", err)
+				}
+
+				// Get the ID of the placeholder product
+				var placeholderID int64
+				err = tx.QueryRowContext(ctx, "SELECT last_insert_rowid()").Scan(&placeholderID)
+				if err != nil {
+					return fmt.Errorf("failed to get placeholder product ID: %v", err)
+				}
+
+				// Update order_details to use the placeholder product
+				_, err = tx.ExecContext(ctx, "UPDATE order_details SET ProductID = ? WHERE ProductID = ?",
+					placeholderID, id)
+				if err != nil {
+					return fmt.Errorf("failed to update order details with placeholder: %v", err)
+				}
 			}
 		}
-	}
 
-	// Now delete the product
-	_, err = tx.Exec("DELETE FROM products WHERE ProductID = ?", id)
-	if err != nil {
-		return fmt.Errorf("failed to delete product: %v", err)
-	}
+		// Now delete the product
+		_, err = tx.ExecContext(ctx, "DELETE FROM products WHERE ProductID = ?", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete product: %v", err)
+		}
 
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
-	}
+		err = recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditProductDelete,
+			TargetType: "product",
+			TargetID:   strconv.FormatInt(id, 10),
+			Before:     before,
+		})
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return events.Record(ctx, tx, events.ProductDeleted, events.ProductDeletedData{ProductID: id, Name: name})
+	})
+}
+
+// productAudit is the part of a product recorded in the audit log
+type productAudit struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	ImageURL    string  `json:"image_url"`
+	Stock       int     `json:"stock"`
+	TaxClass    string  `json:"tax_class"`
+}
+
+// getProductAudit reads a product's audited fields inside tx
+func getProductAudit(ctx context.Context, tx *sql.Tx, id int64) (*productAudit, error) {
+	var p productAudit
+	err := tx.QueryRowContext(ctx, `
+		SELECT Name, COALESCE(Description, ''), Price, COALESCE(ImageURL, ''), Stock, TaxClass
+		FROM products WHERE ProductID = ?
+	`, id).Scan(&p.Name, &p.Description, &p.Price, &p.ImageURL, &p.Stock, &p.TaxClass)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("product not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch product: %v", err)
+	}
+	return &p, nil
 }
 
 // GetProductCount returns the total number of products
-func GetProductCount() (int, error) {
+func GetProductCount(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "models.GetProductCount")
+	defer span.End()
+
 	var count int
-	err := database.DB.QueryRow("SELECT COUNT(*) FROM products").Scan(&count)
+	err := database.ReadDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM products").Scan(&count)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to count products: %v", err)
@@ -220,3 +354,23 @@ func GetProductCount() (int, error) {
 
 	return count, nil
 }
+
+// recordStockLow records a StockLow event when taking quantity units of a
+// product brought its stock from above LowStockThreshold to or below it
+func recordStockLow(ctx context.Context, tx *sql.Tx, productID int64, name string, quantity int) error {
+	var stock int
+	err := tx.QueryRowContext(ctx, "SELECT Stock FROM products WHERE ProductID = ?", productID).Scan(&stock)
+	if err != nil {
+		return fmt.Errorf("failed to check stock: %v", err)
+	}
+	if stock > LowStockThreshold || stock+quantity <= LowStockThreshold {
+		return nil
+	}
+
+	return events.Record(ctx, tx, events.StockLow, events.StockLowData{
+		ProductID: productID,
+		Name:      name,
+		Stock:     stock,
+		Threshold: LowStockThreshold,
+	})
+}
@@ -0,0 +1,543 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go_module/internal/database"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Refund methods
+const (
+	RefundMethodOriginal     = "original_payment"
+	RefundMethodCash         = "cash"
+	RefundMethodBankTransfer = "bank_transfer"
+	RefundMethodGCash        = "gcash"
+	RefundMethodStoreCredit  = "store_credit"
+)
+
+// Refund statuses. Refunds back to the original payment stay pending until
+// the payment provider confirms them; manual refunds complete immediately.
+const (
+	RefundPending   = "pending"
+	RefundCompleted = "completed"
+	RefundFailed    = "failed"
+)
+
+// Order refund statuses
+const (
+	OrderRefundNone     = "none"
+	OrderRefundPartial  = "partial"
+	OrderRefundRefunded = "refunded"
+)
+
+// RefundItem is the part of an order line covered by a refund
+type RefundItem struct {
+	RefundItemID int64   `json:"refund_item_id"`
+	OrderItemID  int64   `json:"order_item_id"`
+	ProductID    int64   `json:"product_id"`
+	Name         string  `json:"name"`
+	Quantity     int     `json:"quantity"`
+	Amount       float64 `json:"amount"`
+}
+
+// Refund is money returned to a customer for all or part of an order
+type Refund struct {
+	RefundID      int64        `json:"refund_id"`
+	OrderID       int64        `json:"order_id"`
+	Amount        float64      `json:"amount"`
+	Reason        string       `json:"reason"`
+	Method        string       `json:"method"`
+	Status        string       `json:"status"`
+	Restock       bool         `json:"restock"`
+	ProviderRef   string       `json:"provider_ref,omitempty"`
+	FailureReason string       `json:"failure_reason,omitempty"`
+	IssuedBy      int64        `json:"issued_by"`
+	CreatedAt     time.Time    `json:"created_at"`
+	CompletedAt   *time.Time   `json:"completed_at,omitempty"`
+	Items         []RefundItem `json:"items"`
+}
+
+// RefundLine selects a quantity of an order line to refund
+type RefundLine struct {
+	OrderItemID int64 `json:"order_item_id" binding:"required"`
+	Quantity    int   `json:"quantity" binding:"required,min=1"`
+}
+
+// RefundRequest describes a refund to issue. A full refund returns whatever
+// has not been refunded yet, including shipping; otherwise only the listed
+// lines are refunded.
+type RefundRequest struct {
+	Full    bool
+	Items   []RefundLine
+	Reason  string
+	Method  string
+	Restock bool
+}
+
+// ValidateRefundMethod checks that the refund method is supported
+func ValidateRefundMethod(method string) error {
+	switch method {
+	case RefundMethodOriginal, RefundMethodCash, RefundMethodBankTransfer, RefundMethodGCash, RefundMethodStoreCredit:
+		return nil
+	}
+	return FieldError("method", "invalid refund method: %s", method)
+}
+
+// refundableLine is an order line with the amounts already refunded against it
+type refundableLine struct {
+	id               int64
+	quantity         int
+	gross            float64
+	refundedQuantity int
+	refundedAmount   float64
+}
+
+// CreateRefund records a refund against a paid order. Refunds to the original
+// payment are created pending and must be completed with CompleteRefund once
+// the provider accepts them; other methods are completed immediately.
+func CreateRefund(ctx context.Context, orderID, issuedBy int64, req RefundRequest) (*Refund, error) {
+	ctx, span := startSpan(ctx, "models.CreateRefund")
+	defer span.End()
+
+	if req.Reason == "" {
+		return nil, FieldError("reason", "refund reason is required")
+	}
+	if err := ValidateRefundMethod(req.Method); err != nil {
+		return nil, err
+	}
+	if !req.Full && len(req.Items) == 0 {
+		return nil, FieldError("items", "no items to refund")
+	}
+
+	var refundID int64
+	var amount float64
+	var status string
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var total float64
+		var paid, pricesIncludeTax bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT TotalAmount, PaymentVerified, PricesIncludeTax FROM orders WHERE OrderID = ?", orderID,
+		).Scan(&total, &paid, &pricesIncludeTax)
+		if err == sql.ErrNoRows {
+			return NotFoundError("order not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch order: %v", err)
+		}
+		if !paid {
+			return ConflictError("order has not been paid")
+		}
+
+		// Pending refunds count against the balance so the same money cannot be
+		// refunded twice while a provider refund is in flight
+		var alreadyRefunded float64
+		err = tx.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(Amount), 0) FROM refunds WHERE OrderID = ? AND Status != ?", orderID, RefundFailed,
+		).Scan(&alreadyRefunded)
+		if err != nil {
+			return fmt.Errorf("failed to sum refunds: %v", err)
+		}
+		remaining := roundMoney(total - alreadyRefunded)
+		if remaining <= 0 {
+			return ConflictError("order is already fully refunded")
+		}
+
+		lines, err := getRefundableLines(ctx, tx, orderID, pricesIncludeTax)
+		if err != nil {
+			return err
+		}
+
+		var items []RefundItem
+		amount = 0
+		if req.Full {
+			for _, l := range lines {
+				if q := l.quantity - l.refundedQuantity; q > 0 {
+					items = append(items, RefundItem{OrderItemID: l.id, Quantity: q, Amount: roundMoney(l.gross - l.refundedAmount)})
+				}
+			}
+			amount = remaining
+		} else {
+			seen := map[int64]bool{}
+			for _, r := range req.Items {
+				if seen[r.OrderItemID] {
+					return FieldError("items", "order item %d is listed more than once", r.OrderItemID)
+				}
+				seen[r.OrderItemID] = true
+
+				var line *refundableLine
+				for i := range lines {
+					if lines[i].id == r.OrderItemID {
+						line = &lines[i]
+					}
+				}
+				if line == nil {
+					return NotFoundError("order item not found: %d", r.OrderItemID)
+				}
+
+				left := line.quantity - line.refundedQuantity
+				if r.Quantity <= 0 || r.Quantity > left {
+					return FieldError("items", "refund quantity for order item %d must be between 1 and %d", r.OrderItemID, left)
+				}
+
+				// The last units take whatever is left of the line so rounding
+				// never leaves a few centavos unrefunded
+				lineAmount := roundMoney(line.gross / float64(line.quantity) * float64(r.Quantity))
+				if r.Quantity == left {
+					lineAmount = roundMoney(line.gross - line.refundedAmount)
+				}
+				items = append(items, RefundItem{OrderItemID: r.OrderItemID, Quantity: r.Quantity, Amount: lineAmount})
+				amount += lineAmount
+			}
+			amount = roundMoney(amount)
+			if amount > remaining {
+				amount = remaining
+			}
+		}
+		if amount <= 0 {
+			return FieldError("items", "no items to refund")
+		}
+
+		status = RefundCompleted
+		if req.Method == RefundMethodOriginal {
+			status = RefundPending
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO refunds (OrderID, Amount, Reason, Method, Status, Restock, IssuedBy, CreatedAt, CompletedAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'), CASE WHEN ? = 'completed' THEN datetime('now') END)
+		`, orderID, amount, req.Reason, req.Method, status, req.Restock, issuedBy, status)
+		if err != nil {
+			return fmt.Errorf("failed to create refund: %v", err)
+		}
+
+		refundID, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get refund ID: %v", err)
+		}
+
+		for _, item := range items {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO refund_items (RefundID, OrderDetailID, Quantity, Amount) VALUES (?, ?, ?, ?)",
+				refundID, item.OrderItemID, item.Quantity, item.Amount,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create refund item: %v", err)
+			}
+		}
+
+		if status == RefundCompleted {
+			if err := applyCompletedRefund(ctx, tx, refundID, orderID); err != nil {
+				return err
+			}
+		}
+
+		refunded := make([]map[string]interface{}, len(items))
+		for i, item := range items {
+			refunded[i] = map[string]interface{}{"order_item_id": item.OrderItemID, "quantity": item.Quantity, "amount": item.Amount}
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditRefundCreate,
+			TargetType: "refund",
+			TargetID:   strconv.FormatInt(refundID, 10),
+			After: map[string]interface{}{
+				"order_id": orderID,
+				"amount":   amount,
+				"reason":   req.Reason,
+				"method":   req.Method,
+				"status":   status,
+				"restock":  req.Restock,
+				"items":    refunded,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Refund issued", "refund_id", refundID, "order_id", orderID, "amount", amount, "method", req.Method, "status", status)
+	return GetRefundByID(ctx, refundID)
+}
+
+// getRefundableLines returns the order's lines with the quantities and
+// amounts already covered by pending or completed refunds
+func getRefundableLines(ctx context.Context, tx *sql.Tx, orderID int64, pricesIncludeTax bool) ([]refundableLine, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT od.OrderDetailID, od.Quantity, od.Price * od.Quantity, od.TaxAmount,
+			COALESCE(SUM(ri.Quantity), 0), COALESCE(SUM(ri.Amount), 0)
+		FROM order_details od
+		LEFT JOIN refund_items ri ON ri.OrderDetailID = od.OrderDetailID
+			AND ri.RefundID IN (SELECT RefundID FROM refunds WHERE Status != ?)
+		WHERE od.OrderID = ?
+		GROUP BY od.OrderDetailID
+	`, RefundFailed, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch order items: %v", err)
+	}
+	defer rows.Close()
+
+	var lines []refundableLine
+	for rows.Next() {
+		var l refundableLine
+		var taxAmount float64
+		if err := rows.Scan(&l.id, &l.quantity, &l.gross, &taxAmount, &l.refundedQuantity, &l.refundedAmount); err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %v", err)
+		}
+		// With VAT-exclusive pricing the customer paid the line tax on top
+		if !pricesIncludeTax {
+			l.gross += taxAmount
+		}
+		lines = append(lines, l)
+	}
+
+	return lines, rows.Err()
+}
+
+// applyCompletedRefund updates the order's refund totals and returns refunded
+// items to stock when the refund asked for it
+func applyCompletedRefund(ctx context.Context, tx *sql.Tx, refundID, orderID int64) error {
+	var total, refunded float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT o.TotalAmount, COALESCE((SELECT SUM(Amount) FROM refunds WHERE OrderID = o.OrderID AND Status = ?), 0)
+		FROM orders o
+		WHERE o.OrderID = ?
+	`, RefundCompleted, orderID).Scan(&total, &refunded)
+	if err != nil {
+		return fmt.Errorf("failed to sum refunds: %v", err)
+	}
+
+	refundStatus := OrderRefundPartial
+	if roundMoney(total-refunded) <= 0 {
+		refundStatus = OrderRefundRefunded
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE orders SET RefundedAmount = ?, RefundStatus = ? WHERE OrderID = ?",
+		roundMoney(refunded), refundStatus, orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update order refund status: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE products
+		SET Stock = Stock + (
+			SELECT SUM(ri.Quantity)
+			FROM refund_items ri
+			JOIN order_details od ON ri.OrderDetailID = od.OrderDetailID
+			WHERE ri.RefundID = ? AND od.ProductID = products.ProductID
+		)
+		WHERE ProductID IN (
+			SELECT od.ProductID
+			FROM refund_items ri
+			JOIN order_details od ON ri.OrderDetailID = od.OrderDetailID
+			WHERE ri.RefundID = ?
+		) AND (SELECT Restock FROM refunds WHERE RefundID = ?) = 1
+	`, refundID, refundID, refundID)
+	if err != nil {
+		return fmt.Errorf("failed to restock refunded items: %v", err)
+	}
+
+	return nil
+}
+
+// CompleteRefund marks a pending refund as accepted by the payment provider
+func CompleteRefund(ctx context.Context, refundID int64, providerRef string) error {
+	ctx, span := startSpan(ctx, "models.CompleteRefund")
+	defer span.End()
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var orderID int64
+		err := tx.QueryRowContext(ctx, "SELECT OrderID FROM refunds WHERE RefundID = ? AND Status = ?", refundID, RefundPending).Scan(&orderID)
+		if err == sql.ErrNoRows {
+			return ConflictError("refund is not pending")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch refund: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE refunds SET Status = ?, ProviderRef = ?, CompletedAt = datetime('now')
+			WHERE RefundID = ?
+		`, RefundCompleted, providerRef, refundID)
+		if err != nil {
+			return fmt.Errorf("failed to update refund: %v", err)
+		}
+
+		if err := applyCompletedRefund(ctx, tx, refundID, orderID); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditRefundComplete,
+			TargetType: "refund",
+			TargetID:   strconv.FormatInt(refundID, 10),
+			Before:     map[string]string{"status": RefundPending},
+			After:      map[string]string{"status": RefundCompleted, "provider_ref": providerRef},
+		})
+	})
+}
+
+// FailRefund records why the provider rejected a pending refund. The amount
+// becomes refundable again.
+func FailRefund(ctx context.Context, refundID int64, reason string) error {
+	ctx, span := startSpan(ctx, "models.FailRefund")
+	defer span.End()
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE refunds SET Status = ?, FailureReason = ? WHERE RefundID = ? AND Status = ?",
+			RefundFailed, reason, refundID, RefundPending,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update refund: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditRefundFail,
+			TargetType: "refund",
+			TargetID:   strconv.FormatInt(refundID, 10),
+			Before:     map[string]string{"status": RefundPending},
+			After:      map[string]string{"status": RefundFailed, "failure_reason": reason},
+		})
+	})
+}
+
+// refundColumns is the column list scanRefund expects
+const refundColumns = `RefundID, OrderID, Amount, Reason, Method, Status, Restock, ProviderRef,
+	FailureReason, IssuedBy, CreatedAt, CompletedAt`
+
+// scanRefund reads one row selected with refundColumns
+func scanRefund(row interface{ Scan(...interface{}) error }) (*Refund, error) {
+	var r Refund
+	var providerRef, failureReason, completedAt sql.NullString
+	var createdAt string
+
+	err := row.Scan(
+		&r.RefundID,
+		&r.OrderID,
+		&r.Amount,
+		&r.Reason,
+		&r.Method,
+		&r.Status,
+		&r.Restock,
+		&providerRef,
+		&failureReason,
+		&r.IssuedBy,
+		&createdAt,
+		&completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r.ProviderRef = providerRef.String
+	r.FailureReason = failureReason.String
+	r.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	if completedAt.Valid {
+		t, _ := time.Parse("2006-01-02 15:04:05", completedAt.String)
+		r.CompletedAt = &t
+	}
+
+	return &r, nil
+}
+
+// GetRefundByID returns a single refund with its items
+func GetRefundByID(ctx context.Context, id int64) (*Refund, error) {
+	ctx, span := startSpan(ctx, "models.GetRefundByID")
+	defer span.End()
+
+	refunds, err := queryRefunds(ctx, "SELECT "+refundColumns+" FROM refunds WHERE RefundID = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(refunds) == 0 {
+		return nil, NotFoundError("refund not found")
+	}
+	return &refunds[0], nil
+}
+
+// GetRefundsByOrderID returns the refunds issued for an order, oldest first
+func GetRefundsByOrderID(ctx context.Context, orderID int64) ([]Refund, error) {
+	ctx, span := startSpan(ctx, "models.GetRefundsByOrderID")
+	defer span.End()
+
+	return queryRefunds(ctx, "SELECT "+refundColumns+" FROM refunds WHERE OrderID = ? ORDER BY RefundID", orderID)
+}
+
+// GetRefunds returns refunds created between start and end (inclusive,
+// formatted as YYYY-MM-DD), newest first
+func GetRefunds(ctx context.Context, start, end string) ([]Refund, error) {
+	ctx, span := startSpan(ctx, "models.GetRefunds")
+	defer span.End()
+
+	return queryRefunds(ctx, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE date(CreatedAt) BETWEEN ? AND ?
+		ORDER BY RefundID DESC
+	`, start, end)
+}
+
+// queryRefunds runs a refund query selecting refundColumns and loads the items
+// of every returned refund
+func queryRefunds(ctx context.Context, query string, args ...interface{}) ([]Refund, error) {
+	rows, err := database.ReadDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch refunds: %v", err)
+	}
+	defer rows.Close()
+
+	refunds := []Refund{}
+	for rows.Next() {
+		r, err := scanRefund(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan refund: %v", err)
+		}
+		refunds = append(refunds, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating refunds: %v", err)
+	}
+	rows.Close()
+
+	for i := range refunds {
+		items, err := getRefundItems(ctx, refunds[i].RefundID)
+		if err != nil {
+			return nil, err
+		}
+		refunds[i].Items = items
+	}
+
+	return refunds, nil
+}
+
+// getRefundItems returns the order lines covered by a refund
+func getRefundItems(ctx context.Context, refundID int64) ([]RefundItem, error) {
+	rows, err := database.ReadDB.QueryContext(ctx, `
+		SELECT ri.RefundItemID, ri.OrderDetailID, od.ProductID, COALESCE(p.Name, ''), ri.Quantity, ri.Amount
+		FROM refund_items ri
+		JOIN order_details od ON ri.OrderDetailID = od.OrderDetailID
+		LEFT JOIN products p ON od.ProductID = p.ProductID
+		WHERE ri.RefundID = ?
+	`, refundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch refund items: %v", err)
+	}
+	defer rows.Close()
+
+	items := []RefundItem{}
+	for rows.Next() {
+		var item RefundItem
+		if err := rows.Scan(&item.RefundItemID, &item.OrderItemID, &item.ProductID, &item.Name, &item.Quantity, &item.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan refund item: %v", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"go_module/internal/database"
+)
+
+// SalesByDate is the revenue for a single day
+type SalesByDate struct {
+	Date      string  `json:"date"`
+	Orders    int     `json:"orders"`
+	Revenue   float64 `json:"revenue"`
+	TaxAmount float64 `json:"tax_amount"`
+}
+
+// SalesByProduct is the revenue for a single product
+type SalesByProduct struct {
+	ProductID int64   `json:"product_id"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	Revenue   float64 `json:"revenue"`
+	TaxAmount float64 `json:"tax_amount"`
+}
+
+// SalesByPaymentMethod is the revenue for a single payment method
+type SalesByPaymentMethod struct {
+	Method  string  `json:"method"`
+	Orders  int     `json:"orders"`
+	Revenue float64 `json:"revenue"`
+}
+
+// SalesReport summarises verified orders placed within a date range
+type SalesReport struct {
+	StartDate       string                 `json:"start_date"`
+	EndDate         string                 `json:"end_date"`
+	TotalOrders     int                    `json:"total_orders"`
+	GrossSales      float64                `json:"gross_sales"`
+	NetSales        float64                `json:"net_sales"`
+	Subtotal        float64                `json:"subtotal"`
+	ShippingFees    float64                `json:"shipping_fees"`
+	VatableSales    float64                `json:"vatable_sales"`
+	VatExemptSales  float64                `json:"vat_exempt_sales"`
+	ZeroRatedSales  float64                `json:"zero_rated_sales"`
+	TaxAmount       float64                `json:"tax_amount"`
+	Refunds         float64                `json:"refunds"` // completed in the range, whenever the order was placed
+	NetRevenue      float64                `json:"net_revenue"`
+	ByDate          []SalesByDate          `json:"sales_by_date"`
+	ByProduct       []SalesByProduct       `json:"sales_by_product"`
+	ByPaymentMethod []SalesByPaymentMethod `json:"sales_by_payment_method"`
+}
+
+// GetSalesReport builds the sales report for orders with verified payment
+// placed between start and end (inclusive, formatted as YYYY-MM-DD)
+func GetSalesReport(ctx context.Context, start, end string) (*SalesReport, error) {
+	ctx, span := startSpan(ctx, "models.GetSalesReport")
+	defer span.End()
+
+	report := &SalesReport{
+		StartDate:       start,
+		EndDate:         end,
+		ByDate:          []SalesByDate{},
+		ByProduct:       []SalesByProduct{},
+		ByPaymentMethod: []SalesByPaymentMethod{},
+	}
+
+	// Totals
+	err := database.ReadDB.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			COALESCE(SUM(TotalAmount), 0),
+			COALESCE(SUM(Subtotal), 0),
+			COALESCE(SUM(ShippingFee), 0),
+			COALESCE(SUM(VatableSales), 0),
+			COALESCE(SUM(VatExemptSales), 0),
+			COALESCE(SUM(ZeroRatedSales), 0),
+			COALESCE(SUM(TaxAmount), 0)
+		FROM orders
+		WHERE PaymentVerified = 1 AND date(CreatedAt) BETWEEN ? AND ?
+	`, start, end).Scan(
+		&report.TotalOrders,
+		&report.GrossSales,
+		&report.Subtotal,
+		&report.ShippingFees,
+		&report.VatableSales,
+		&report.VatExemptSales,
+		&report.ZeroRatedSales,
+		&report.TaxAmount,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate sales totals: %v", err)
+	}
+	report.GrossSales = roundMoney(report.GrossSales)
+	report.TaxAmount = roundMoney(report.TaxAmount)
+	report.NetSales = roundMoney(report.GrossSales - report.TaxAmount)
+
+	err = database.ReadDB.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(Amount), 0)
+		FROM refunds
+		WHERE Status = ? AND date(CompletedAt) BETWEEN ? AND ?
+	`, RefundCompleted, start, end).Scan(&report.Refunds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate refunds: %v", err)
+	}
+	report.Refunds = roundMoney(report.Refunds)
+	report.NetRevenue = roundMoney(report.GrossSales - report.Refunds)
+
+	// By date
+	rows, err := database.ReadDB.QueryContext(ctx, `
+		SELECT date(CreatedAt), COUNT(*), COALESCE(SUM(TotalAmount), 0), COALESCE(SUM(TaxAmount), 0)
+		FROM orders
+		WHERE PaymentVerified = 1 AND date(CreatedAt) BETWEEN ? AND ?
+		GROUP BY date(CreatedAt)
+		ORDER BY date(CreatedAt)
+	`, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sales by date: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s SalesByDate
+		if err := rows.Scan(&s.Date, &s.Orders, &s.Revenue, &s.TaxAmount); err != nil {
+			return nil, fmt.Errorf("failed to scan sales by date: %v", err)
+		}
+		s.Revenue = roundMoney(s.Revenue)
+		s.TaxAmount = roundMoney(s.TaxAmount)
+		report.ByDate = append(report.ByDate, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sales by date: %v", err)
+	}
+
+	// By product
+	productRows, err := database.ReadDB.QueryContext(ctx, `
+		SELECT od.ProductID, p.Name, SUM(od.Quantity), SUM(od.Price * od.Quantity), SUM(od.TaxAmount)
+		FROM order_details od
+		JOIN orders o ON od.OrderID = o.OrderID
+		JOIN products p ON od.ProductID = p.ProductID
+		WHERE o.PaymentVerified = 1 AND date(o.CreatedAt) BETWEEN ? AND ?
+		GROUP BY od.ProductID, p.Name
+		ORDER BY SUM(od.Price * od.Quantity) DESC
+	`, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sales by product: %v", err)
+	}
+	defer productRows.Close()
+
+	for productRows.Next() {
+		var s SalesByProduct
+		if err := productRows.Scan(&s.ProductID, &s.Name, &s.Quantity, &s.Revenue, &s.TaxAmount); err != nil {
+			return nil, fmt.Errorf("failed to scan sales by product: %v", err)
+		}
+		s.Revenue = roundMoney(s.Revenue)
+		s.TaxAmount = roundMoney(s.TaxAmount)
+		report.ByProduct = append(report.ByProduct, s)
+	}
+	if err := productRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sales by product: %v", err)
+	}
+
+	// By payment method
+	methodRows, err := database.ReadDB.QueryContext(ctx, `
+		SELECT PaymentMethod, COUNT(*), COALESCE(SUM(TotalAmount), 0)
+		FROM orders
+		WHERE PaymentVerified = 1 AND date(CreatedAt) BETWEEN ? AND ?
+		GROUP BY PaymentMethod
+		ORDER BY SUM(TotalAmount) DESC
+	`, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sales by payment method: %v", err)
+	}
+	defer methodRows.Close()
+
+	for methodRows.Next() {
+		var s SalesByPaymentMethod
+		if err := methodRows.Scan(&s.Method, &s.Orders, &s.Revenue); err != nil {
+			return nil, fmt.Errorf("failed to scan sales by payment method: %v", err)
+		}
+		s.Revenue = roundMoney(s.Revenue)
+		report.ByPaymentMethod = append(report.ByPaymentMethod, s)
+	}
+	if err := methodRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sales by payment method: %v", err)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,564 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go_module/internal/database"
+)
+
+// Permissions checked by the admin API. Roles are sets of these; a user has
+// one role.
+const (
+	PermDashboardView      = "dashboard:view"
+	PermReportsView        = "reports:view"
+	PermProductsRead       = "products:read"
+	PermProductsWrite      = "products:write"
+	PermOrdersRead         = "orders:read"
+	PermOrdersUpdateStatus = "orders:update_status"
+	PermPaymentsVerify     = "payments:verify"
+	PermRefundsRead        = "refunds:read"
+	PermRefundsWrite       = "refunds:write"
+	PermUsersRead          = "users:read"
+	PermUsersManageRoles   = "users:manage_roles"
+	PermRolesManage        = "roles:manage"
+	PermWebhooksManage     = "webhooks:manage"
+	PermAuditRead          = "audit:read"
+)
+
+// Permission describes a permission for the role management screens
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions is the catalogue of every permission a role can be granted
+var Permissions = []Permission{
+	{PermDashboardView, "View the admin dashboard"},
+	{PermReportsView, "View sales and VAT reports"},
+	{PermProductsRead, "View the admin product list"},
+	{PermProductsWrite, "Create, update and delete products"},
+	{PermOrdersRead, "View all orders and their payments"},
+	{PermOrdersUpdateStatus, "Change order status"},
+	{PermPaymentsVerify, "Verify payments and review proof of payment"},
+	{PermRefundsRead, "View refunds"},
+	{PermRefundsWrite, "Issue refunds"},
+	{PermUsersRead, "View user accounts"},
+	{PermUsersManageRoles, "Assign roles to users"},
+	{PermRolesManage, "Create, change and delete roles"},
+	{PermWebhooksManage, "Manage outgoing webhooks and replay deliveries"},
+	{PermAuditRead, "Search and export the audit log"},
+}
+
+// Built-in roles. The owner role always holds every permission.
+const (
+	RoleOwner         = "owner"
+	RoleAdmin         = "admin"
+	RoleFulfilment    = "fulfilment"
+	RoleSupport       = "support"
+	RoleCatalogEditor = "catalog_editor"
+	RoleCustomer      = "customer"
+)
+
+// Role is a named set of permissions
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	BuiltIn     bool      `json:"built_in"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// builtInRoles are created on startup if missing. Their permissions are the
+// defaults; only the owner role is reset to the full set every time.
+var builtInRoles = []Role{
+	{Name: RoleOwner, Description: "Store owner with every permission"},
+	{Name: RoleAdmin, Description: "Runs the store; cannot change roles", Permissions: []string{
+		PermDashboardView, PermReportsView, PermProductsRead, PermProductsWrite, PermOrdersRead,
+		PermOrdersUpdateStatus, PermPaymentsVerify, PermRefundsRead, PermRefundsWrite, PermUsersRead,
+		PermUsersManageRoles, PermWebhooksManage, PermAuditRead,
+	}},
+	{Name: RoleFulfilment, Description: "Warehouse staff who pack and ship orders", Permissions: []string{
+		PermDashboardView, PermProductsRead, PermOrdersRead, PermOrdersUpdateStatus,
+	}},
+	{Name: RoleSupport, Description: "Customer support", Permissions: []string{
+		PermDashboardView, PermProductsRead, PermOrdersRead, PermPaymentsVerify, PermRefundsRead, PermUsersRead,
+	}},
+	{Name: RoleCatalogEditor, Description: "Maintains products and stock", Permissions: []string{
+		PermDashboardView, PermProductsRead, PermProductsWrite,
+	}},
+	{Name: RoleCustomer, Description: "Shopper with no admin access"},
+}
+
+// rolePermissions caches the permissions of every role so permission checks
+// don't query the database on each request. It is reloaded after every
+// change made through this file.
+var rolePermissions = struct {
+	sync.RWMutex
+	byRole map[string]map[string]bool
+}{byRole: map[string]map[string]bool{}}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,31}$`)
+
+// EnsureRoles creates missing built-in roles, gives the owner role every
+// permission and loads the permission cache. If nobody is an owner yet, the
+// bootstrap admin account is promoted so someone can manage roles.
+func EnsureRoles(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "models.EnsureRoles")
+	defer span.End()
+
+	all := make([]string, len(Permissions))
+	for i, p := range Permissions {
+		all[i] = p.Name
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		for _, r := range builtInRoles {
+			result, err := tx.ExecContext(ctx,
+				"INSERT OR IGNORE INTO roles (Name, Description, BuiltIn) VALUES (?, ?, 1)",
+				r.Name, r.Description,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create role %s: %v", r.Name, err)
+			}
+
+			perms := r.Permissions
+			if r.Name == RoleOwner {
+				perms = all
+			} else if created, _ := result.RowsAffected(); created == 0 {
+				// Keep changes made to an existing role
+				continue
+			}
+			if err := setRolePermissions(ctx, tx, r.Name, perms); err != nil {
+				return err
+			}
+		}
+
+		var owners int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE Role = ?", RoleOwner).Scan(&owners); err != nil {
+			return fmt.Errorf("failed to count owners: %v", err)
+		}
+		if owners == 0 {
+			result, err := tx.ExecContext(ctx,
+				"UPDATE users SET Role = ? WHERE Email = 'admin@example.com'", RoleOwner,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to promote bootstrap admin: %v", err)
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				slog.InfoContext(ctx, "No owner account found, made admin@example.com the owner")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return loadRolePermissions(ctx)
+}
+
+// setRolePermissions replaces a role's permissions inside a transaction
+func setRolePermissions(ctx context.Context, tx *sql.Tx, role string, perms []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE Role = ?", role); err != nil {
+		return fmt.Errorf("failed to clear permissions of %s: %v", role, err)
+	}
+	for _, p := range perms {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO role_permissions (Role, Permission) VALUES (?, ?)", role, p,
+		); err != nil {
+			return fmt.Errorf("failed to grant %s to %s: %v", p, role, err)
+		}
+	}
+	return nil
+}
+
+// loadRolePermissions refreshes the permission cache from the database
+func loadRolePermissions(ctx context.Context) error {
+	rows, err := database.ReadDB.QueryContext(ctx, "SELECT Name FROM roles")
+	if err != nil {
+		return fmt.Errorf("failed to load roles: %v", err)
+	}
+	byRole := map[string]map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan role: %v", err)
+		}
+		byRole[name] = map[string]bool{}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load roles: %v", err)
+	}
+
+	rows, err = database.ReadDB.QueryContext(ctx, "SELECT Role, Permission FROM role_permissions")
+	if err != nil {
+		return fmt.Errorf("failed to load role permissions: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role, perm string
+		if err := rows.Scan(&role, &perm); err != nil {
+			return fmt.Errorf("failed to scan role permission: %v", err)
+		}
+		if byRole[role] != nil {
+			byRole[role][perm] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load role permissions: %v", err)
+	}
+
+	rolePermissions.Lock()
+	rolePermissions.byRole = byRole
+	rolePermissions.Unlock()
+	return nil
+}
+
+// RoleHasPermission reports whether a role grants a permission
+func RoleHasPermission(role, permission string) bool {
+	rolePermissions.RLock()
+	defer rolePermissions.RUnlock()
+	return rolePermissions.byRole[role][permission]
+}
+
+// RolePermissions returns the permissions a role grants, sorted
+func RolePermissions(role string) []string {
+	rolePermissions.RLock()
+	defer rolePermissions.RUnlock()
+
+	perms := []string{}
+	for p := range rolePermissions.byRole[role] {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// RoleExists reports whether a role is defined
+func RoleExists(role string) bool {
+	rolePermissions.RLock()
+	defer rolePermissions.RUnlock()
+	_, ok := rolePermissions.byRole[role]
+	return ok
+}
+
+// GetRoles returns every role with its permissions
+func GetRoles(ctx context.Context) ([]Role, error) {
+	ctx, span := startSpan(ctx, "models.GetRoles")
+	defer span.End()
+
+	rows, err := database.ReadDB.QueryContext(ctx,
+		"SELECT Name, COALESCE(Description, ''), BuiltIn, CreatedAt FROM roles ORDER BY BuiltIn DESC, Name",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch roles: %v", err)
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var r Role
+		var createdAt string
+		if err := rows.Scan(&r.Name, &r.Description, &r.BuiltIn, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %v", err)
+		}
+		r.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+		r.Permissions = RolePermissions(r.Name)
+		roles = append(roles, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch roles: %v", err)
+	}
+	return roles, nil
+}
+
+// GetRole returns one role with its permissions
+func GetRole(ctx context.Context, name string) (*Role, error) {
+	ctx, span := startSpan(ctx, "models.GetRole")
+	defer span.End()
+
+	var r Role
+	var createdAt string
+	err := database.ReadDB.QueryRowContext(ctx,
+		"SELECT Name, COALESCE(Description, ''), BuiltIn, CreatedAt FROM roles WHERE Name = ?", name,
+	).Scan(&r.Name, &r.Description, &r.BuiltIn, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("role not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch role: %v", err)
+	}
+
+	r.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	r.Permissions = RolePermissions(r.Name)
+	return &r, nil
+}
+
+// roleAudit is a role as recorded in the audit log
+type roleAudit struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// getRoleAudit reads a role's description and permissions inside tx
+func getRoleAudit(ctx context.Context, tx *sql.Tx, name string) (*roleAudit, error) {
+	var r roleAudit
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(Description, '') FROM roles WHERE Name = ?", name).Scan(&r.Description)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("role not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch role: %v", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT Permission FROM role_permissions WHERE Role = ? ORDER BY Permission", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch role permissions: %v", err)
+	}
+	defer rows.Close()
+	r.Permissions = []string{}
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("failed to scan role permission: %v", err)
+		}
+		r.Permissions = append(r.Permissions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch role permissions: %v", err)
+	}
+	return &r, nil
+}
+
+// validatePermissions checks that every permission is in the catalogue and
+// returns them without duplicates
+func validatePermissions(perms []string) ([]string, error) {
+	known := make(map[string]bool, len(Permissions))
+	for _, p := range Permissions {
+		known[p.Name] = true
+	}
+
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, p := range perms {
+		if !known[p] {
+			return nil, FieldError("permissions", "unknown permission: %s", p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+	return unique, nil
+}
+
+// CreateRole defines a new role
+func CreateRole(ctx context.Context, name, description string, perms []string) (*Role, error) {
+	ctx, span := startSpan(ctx, "models.CreateRole")
+	defer span.End()
+
+	name = strings.TrimSpace(name)
+	if !roleNamePattern.MatchString(name) {
+		return nil, FieldError("name", "role name must be 2-32 lowercase letters, digits or underscores")
+	}
+	perms, err := validatePermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"INSERT OR IGNORE INTO roles (Name, Description, BuiltIn) VALUES (?, ?, 0)", name, description,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create role: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ConflictError("role %s already exists", name)
+		}
+		if err := setRolePermissions(ctx, tx, name, perms); err != nil {
+			return err
+		}
+
+		after, err := getRoleAudit(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{Action: AuditRoleCreate, TargetType: "role", TargetID: name, After: after})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadRolePermissions(ctx); err != nil {
+		return nil, err
+	}
+	return GetRole(ctx, name)
+}
+
+// UpdateRole changes a role's description and permissions. The owner role
+// cannot be changed.
+func UpdateRole(ctx context.Context, name, description string, perms []string) (*Role, error) {
+	ctx, span := startSpan(ctx, "models.UpdateRole")
+	defer span.End()
+
+	if name == RoleOwner {
+		return nil, ConflictError("the owner role cannot be changed")
+	}
+	perms, err := validatePermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := getRoleAudit(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE roles SET Description = ? WHERE Name = ?", description, name); err != nil {
+			return fmt.Errorf("failed to update role: %v", err)
+		}
+		if err := setRolePermissions(ctx, tx, name, perms); err != nil {
+			return err
+		}
+
+		after, err := getRoleAudit(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditRoleUpdate,
+			TargetType: "role",
+			TargetID:   name,
+			Before:     before,
+			After:      after,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadRolePermissions(ctx); err != nil {
+		return nil, err
+	}
+	return GetRole(ctx, name)
+}
+
+// DeleteRole removes a custom role that no user has
+func DeleteRole(ctx context.Context, name string) error {
+	ctx, span := startSpan(ctx, "models.DeleteRole")
+	defer span.End()
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var builtIn bool
+		err := tx.QueryRowContext(ctx, "SELECT BuiltIn FROM roles WHERE Name = ?", name).Scan(&builtIn)
+		if err == sql.ErrNoRows {
+			return NotFoundError("role not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch role: %v", err)
+		}
+		if builtIn {
+			return ConflictError("built-in roles cannot be deleted")
+		}
+
+		var users int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE Role = ?", name).Scan(&users); err != nil {
+			return fmt.Errorf("failed to count users with role: %v", err)
+		}
+		if users > 0 {
+			return ConflictError("role %s is assigned to %d users", name, users)
+		}
+
+		before, err := getRoleAudit(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE Role = ?", name); err != nil {
+			return fmt.Errorf("failed to delete role permissions: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM roles WHERE Name = ?", name); err != nil {
+			return fmt.Errorf("failed to delete role: %v", err)
+		}
+		return recordAudit(ctx, tx, AuditEntry{Action: AuditRoleDelete, TargetType: "role", TargetID: name, Before: before})
+	})
+	if err != nil {
+		return err
+	}
+
+	return loadRolePermissions(ctx)
+}
+
+// SetUserRole gives a user a new role and revokes their sessions, so tokens
+// carrying the old role stop working straight away
+func SetUserRole(ctx context.Context, userID int64, role string) (*User, error) {
+	ctx, span := startSpan(ctx, "models.SetUserRole")
+	defer span.End()
+
+	if !RoleExists(role) {
+		return nil, FieldError("role", "unknown role: %s", role)
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var current string
+		err := tx.QueryRowContext(ctx, "SELECT Role FROM users WHERE UserID = ?", userID).Scan(&current)
+		if err == sql.ErrNoRows {
+			return NotFoundError("user not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch user role: %v", err)
+		}
+
+		// The store must always have someone who can manage roles
+		if current == RoleOwner && role != RoleOwner {
+			var owners int
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE Role = ?", RoleOwner).Scan(&owners); err != nil {
+				return fmt.Errorf("failed to count owners: %v", err)
+			}
+			if owners <= 1 {
+				return ConflictError("cannot remove the last owner")
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET Role = ? WHERE UserID = ?", role, userID); err != nil {
+			return fmt.Errorf("failed to update user role: %v", err)
+		}
+
+		err = recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditUserRoleChange,
+			TargetType: "user",
+			TargetID:   strconv.FormatInt(userID, 10),
+			Before:     map[string]string{"role": current},
+			After:      map[string]string{"role": role},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE sessions SET RevokedAt = datetime('now') WHERE UserID = ? AND RevokedAt IS NULL", userID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetUserByID(ctx, userID)
+}
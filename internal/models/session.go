@@ -0,0 +1,239 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go_module/internal/database"
+)
+
+// RefreshTokenTTL is how long a session can go unused before its refresh
+// token expires. Every refresh extends it again.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// Session is one login of a user. The refresh token itself is only handed to
+// the client; the database keeps its SHA-256 hash.
+type Session struct {
+	SessionID  int64      `json:"session_id"`
+	UserID     int64      `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// newSecretToken returns a random token for a client to present later and
+// the hash stored for it. Only the hash is kept, so a copy of the database
+// does not give anyone working tokens.
+func newSecretToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashSecretToken(token), nil
+}
+
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a session for a user who just logged in and returns
+// it with its refresh token
+func CreateSession(ctx context.Context, userID int64, userAgent, ipAddress string) (*Session, string, error) {
+	ctx, span := startSpan(ctx, "models.CreateSession")
+	defer span.End()
+
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	session := &Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+
+	result, err := database.DB.ExecContext(ctx,
+		`INSERT INTO sessions (UserID, TokenHash, UserAgent, IPAddress, CreatedAt, LastUsedAt, ExpiresAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, hash, userAgent, ipAddress,
+		now.Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05"),
+		session.ExpiresAt.Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create session: %v", err)
+	}
+
+	session.SessionID, err = result.LastInsertId()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get session ID: %v", err)
+	}
+
+	return session, token, nil
+}
+
+// RotateSession exchanges a refresh token for a new one. Each token can be
+// used once: presenting the token a session was last rotated from means it
+// was copied, so the session is revoked and both holders must log in again.
+func RotateSession(ctx context.Context, token string) (*Session, string, error) {
+	ctx, span := startSpan(ctx, "models.RotateSession")
+	defer span.End()
+
+	newToken, newHash, err := newSecretToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash := hashSecretToken(token)
+	session := &Session{}
+	var reused bool
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		reused = false
+
+		var createdAt, lastUsedAt, expiresAt string
+		var revokedAt sql.NullString
+		err := tx.QueryRowContext(ctx,
+			`SELECT SessionID, UserID, COALESCE(UserAgent, ''), COALESCE(IPAddress, ''),
+				CreatedAt, LastUsedAt, ExpiresAt, RevokedAt
+			FROM sessions WHERE TokenHash = ?`,
+			hash,
+		).Scan(&session.SessionID, &session.UserID, &session.UserAgent, &session.IPAddress,
+			&createdAt, &lastUsedAt, &expiresAt, &revokedAt)
+
+		if err == sql.ErrNoRows {
+			// Not a current token, but it may be one that was already rotated
+			var sessionID int64
+			err = tx.QueryRowContext(ctx,
+				"SELECT SessionID FROM sessions WHERE PreviousHash = ?",
+				hash,
+			).Scan(&sessionID)
+			if err == sql.ErrNoRows {
+				return UnauthorizedError("invalid refresh token")
+			}
+			if err != nil {
+				return fmt.Errorf("failed to look up session: %v", err)
+			}
+
+			slog.WarnContext(ctx, "Refresh token reuse detected, revoking session", "session_id", sessionID)
+			_, err = tx.ExecContext(ctx,
+				"UPDATE sessions SET RevokedAt = datetime('now') WHERE SessionID = ? AND RevokedAt IS NULL",
+				sessionID,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to revoke session: %v", err)
+			}
+			// Commit the revocation; the caller still gets an error
+			reused = true
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up session: %v", err)
+		}
+
+		session.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+		session.ExpiresAt, _ = time.Parse("2006-01-02 15:04:05", expiresAt)
+		if revokedAt.Valid {
+			return UnauthorizedError("session has been revoked")
+		}
+		if time.Now().UTC().After(session.ExpiresAt) {
+			return UnauthorizedError("refresh token has expired")
+		}
+
+		now := time.Now().UTC()
+		session.LastUsedAt = now
+		session.ExpiresAt = now.Add(RefreshTokenTTL)
+		_, err = tx.ExecContext(ctx,
+			`UPDATE sessions SET TokenHash = ?, PreviousHash = ?, LastUsedAt = ?, ExpiresAt = ?
+			WHERE SessionID = ?`,
+			newHash, hash, now.Format("2006-01-02 15:04:05"),
+			session.ExpiresAt.Format("2006-01-02 15:04:05"), session.SessionID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to rotate session: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if reused {
+		return nil, "", UnauthorizedError("refresh token has already been used")
+	}
+
+	return session, newToken, nil
+}
+
+// RevokeSession ends one session, such as on logout
+func RevokeSession(ctx context.Context, sessionID int64) error {
+	ctx, span := startSpan(ctx, "models.RevokeSession")
+	defer span.End()
+
+	_, err := database.DB.ExecContext(ctx,
+		"UPDATE sessions SET RevokedAt = datetime('now') WHERE SessionID = ? AND RevokedAt IS NULL",
+		sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions ends every session of a user and returns how many were
+// still active
+func RevokeUserSessions(ctx context.Context, userID int64) (int64, error) {
+	ctx, span := startSpan(ctx, "models.RevokeUserSessions")
+	defer span.End()
+
+	result, err := database.DB.ExecContext(ctx,
+		"UPDATE sessions SET RevokedAt = datetime('now') WHERE UserID = ? AND RevokedAt IS NULL",
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count revoked sessions: %v", err)
+	}
+	return revoked, nil
+}
+
+// SessionRole returns the current role of the user a session belongs to.
+// ok is false if the session doesn't exist, has been revoked, or belongs to
+// a user other than userID. Access tokens carry their session ID so logging
+// out takes effect before they expire, and the role is read here rather than
+// from the token so a role change takes effect at once.
+func SessionRole(ctx context.Context, sessionID, userID int64) (role string, ok bool, err error) {
+	ctx, span := startSpan(ctx, "models.SessionRole")
+	defer span.End()
+
+	err = database.ReadDB.QueryRowContext(ctx, `
+		SELECT u.Role FROM sessions s JOIN users u ON u.UserID = s.UserID
+		WHERE s.SessionID = ? AND s.UserID = ? AND s.RevokedAt IS NULL
+	`, sessionID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check session: %v", err)
+	}
+	return role, true, nil
+}
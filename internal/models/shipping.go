@@ -0,0 +1,252 @@
+package models
+
+import (
+	"math"
+	"strings"
+)
+
+// Shipping zones used for rate calculation
+const (
+	ZoneMetroManila = "metro_manila"
+	ZoneLuzon       = "luzon"
+	ZoneVisayas     = "visayas"
+	ZoneMindanao    = "mindanao"
+)
+
+// ShippingRate is the rate table for a single zone. The base fee covers the
+// first kilogram; every additional started kilogram adds PerKgFee.
+type ShippingRate struct {
+	Zone          string  `json:"zone"`
+	Name          string  `json:"name"`
+	BaseFee       float64 `json:"base_fee"`
+	BaseWeightKg  float64 `json:"base_weight_kg"`
+	PerKgFee      float64 `json:"per_kg_fee"`
+	PerItemFee    float64 `json:"per_item_fee"`
+	FreeThreshold float64 `json:"free_shipping_threshold"`
+	EstimatedDays string  `json:"estimated_days"`
+}
+
+// ShippingQuote is the computed shipping cost for a cart and destination
+type ShippingQuote struct {
+	Zone          string  `json:"zone"`
+	ZoneName      string  `json:"zone_name"`
+	Subtotal      float64 `json:"subtotal"`
+	TotalWeightKg float64 `json:"total_weight_kg"`
+	ItemCount     int     `json:"item_count"`
+	ShippingFee   float64 `json:"shipping_fee"`
+	FreeShipping  bool    `json:"free_shipping"`
+	FreeThreshold float64 `json:"free_shipping_threshold"`
+	EstimatedDays string  `json:"estimated_days"`
+	Total         float64 `json:"total"`
+}
+
+// Rate tables per zone. Items after the first add PerItemFee for handling on
+// top of the weight based charge.
+var shippingRates = map[string]ShippingRate{
+	ZoneMetroManila: {
+		Zone:          ZoneMetroManila,
+		Name:          "Metro Manila",
+		BaseFee:       100,
+		BaseWeightKg:  1,
+		PerKgFee:      40,
+		PerItemFee:    10,
+		FreeThreshold: 2500,
+		EstimatedDays: "1-3",
+	},
+	ZoneLuzon: {
+		Zone:          ZoneLuzon,
+		Name:          "Luzon",
+		BaseFee:       150,
+		BaseWeightKg:  1,
+		PerKgFee:      60,
+		PerItemFee:    15,
+		FreeThreshold: 3500,
+		EstimatedDays: "3-5",
+	},
+	ZoneVisayas: {
+		Zone:          ZoneVisayas,
+		Name:          "Visayas",
+		BaseFee:       180,
+		BaseWeightKg:  1,
+		PerKgFee:      80,
+		PerItemFee:    20,
+		FreeThreshold: 4000,
+		EstimatedDays: "5-7",
+	},
+	ZoneMindanao: {
+		Zone:          ZoneMindanao,
+		Name:          "Mindanao",
+		BaseFee:       200,
+		BaseWeightKg:  1,
+		PerKgFee:      90,
+		PerItemFee:    20,
+		FreeThreshold: 4500,
+		EstimatedDays: "5-8",
+	},
+}
+
+// Provinces that do not follow the postal code ranges used as a fallback,
+// plus the most common spellings customers type in
+var provinceZones = map[string]string{
+	"metro manila":        ZoneMetroManila,
+	"ncr":                 ZoneMetroManila,
+	"manila":              ZoneMetroManila,
+	"abra":                ZoneLuzon,
+	"albay":               ZoneLuzon,
+	"aurora":              ZoneLuzon,
+	"bataan":              ZoneLuzon,
+	"batanes":             ZoneLuzon,
+	"batangas":            ZoneLuzon,
+	"benguet":             ZoneLuzon,
+	"bulacan":             ZoneLuzon,
+	"cagayan":             ZoneLuzon,
+	"camarines norte":     ZoneLuzon,
+	"camarines sur":       ZoneLuzon,
+	"catanduanes":         ZoneLuzon,
+	"cavite":              ZoneLuzon,
+	"ilocos norte":        ZoneLuzon,
+	"ilocos sur":          ZoneLuzon,
+	"isabela":             ZoneLuzon,
+	"la union":            ZoneLuzon,
+	"laguna":              ZoneLuzon,
+	"marinduque":          ZoneLuzon,
+	"masbate":             ZoneLuzon,
+	"mindoro":             ZoneLuzon,
+	"occidental mindoro":  ZoneLuzon,
+	"oriental mindoro":    ZoneLuzon,
+	"nueva ecija":         ZoneLuzon,
+	"nueva vizcaya":       ZoneLuzon,
+	"palawan":             ZoneLuzon,
+	"pampanga":            ZoneLuzon,
+	"pangasinan":          ZoneLuzon,
+	"quezon":              ZoneLuzon,
+	"rizal":               ZoneLuzon,
+	"romblon":             ZoneLuzon,
+	"sorsogon":            ZoneLuzon,
+	"tarlac":              ZoneLuzon,
+	"zambales":            ZoneLuzon,
+	"aklan":               ZoneVisayas,
+	"antique":             ZoneVisayas,
+	"biliran":             ZoneVisayas,
+	"bohol":               ZoneVisayas,
+	"capiz":               ZoneVisayas,
+	"cebu":                ZoneVisayas,
+	"eastern samar":       ZoneVisayas,
+	"guimaras":            ZoneVisayas,
+	"iloilo":              ZoneVisayas,
+	"leyte":               ZoneVisayas,
+	"negros occidental":   ZoneVisayas,
+	"negros oriental":     ZoneVisayas,
+	"northern samar":      ZoneVisayas,
+	"samar":               ZoneVisayas,
+	"siquijor":            ZoneVisayas,
+	"southern leyte":      ZoneVisayas,
+	"agusan del norte":    ZoneMindanao,
+	"agusan del sur":      ZoneMindanao,
+	"basilan":             ZoneMindanao,
+	"bukidnon":            ZoneMindanao,
+	"camiguin":            ZoneMindanao,
+	"cotabato":            ZoneMindanao,
+	"davao de oro":        ZoneMindanao,
+	"davao del norte":     ZoneMindanao,
+	"davao del sur":       ZoneMindanao,
+	"davao oriental":      ZoneMindanao,
+	"lanao del norte":     ZoneMindanao,
+	"lanao del sur":       ZoneMindanao,
+	"maguindanao":         ZoneMindanao,
+	"misamis occidental":  ZoneMindanao,
+	"misamis oriental":    ZoneMindanao,
+	"south cotabato":      ZoneMindanao,
+	"sultan kudarat":      ZoneMindanao,
+	"sulu":                ZoneMindanao,
+	"surigao del norte":   ZoneMindanao,
+	"surigao del sur":     ZoneMindanao,
+	"tawi-tawi":           ZoneMindanao,
+	"zamboanga del norte": ZoneMindanao,
+	"zamboanga del sur":   ZoneMindanao,
+	"zamboanga sibugay":   ZoneMindanao,
+}
+
+// GetShippingRates returns the rate table for every zone
+func GetShippingRates() []ShippingRate {
+	zones := []string{ZoneMetroManila, ZoneLuzon, ZoneVisayas, ZoneMindanao}
+	rates := make([]ShippingRate, 0, len(zones))
+	for _, z := range zones {
+		rates = append(rates, shippingRates[z])
+	}
+	return rates
+}
+
+// ResolveShippingZone determines the zone from the province name, falling back
+// to the first digit of the postal code when the province is not recognised
+func ResolveShippingZone(province, postalCode string) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(province))
+	key = strings.TrimSuffix(key, " province")
+	if zone, ok := provinceZones[key]; ok {
+		return zone, nil
+	}
+
+	postalCode = strings.TrimSpace(postalCode)
+	if postalCode == "" {
+		return "", FieldError("province", "unable to determine shipping zone for province %q", province)
+	}
+
+	switch postalCode[0] {
+	case '1':
+		return ZoneMetroManila, nil
+	case '0', '2', '3', '4':
+		return ZoneLuzon, nil
+	case '5', '6':
+		return ZoneVisayas, nil
+	case '7', '8', '9':
+		return ZoneMindanao, nil
+	}
+
+	return "", FieldError("postal_code", "unable to determine shipping zone for postal code %q", postalCode)
+}
+
+// QuoteShipping calculates the shipping fee for the given cart and destination
+func QuoteShipping(cart *Cart, province, postalCode string) (*ShippingQuote, error) {
+	zone, err := ResolveShippingZone(province, postalCode)
+	if err != nil {
+		return nil, err
+	}
+	rate := shippingRates[zone]
+
+	quote := &ShippingQuote{
+		Zone:          zone,
+		ZoneName:      rate.Name,
+		Subtotal:      roundMoney(cart.Subtotal),
+		FreeThreshold: rate.FreeThreshold,
+		EstimatedDays: rate.EstimatedDays,
+	}
+
+	for _, item := range cart.Items {
+		quote.ItemCount += item.Quantity
+		quote.TotalWeightKg += item.WeightKg * float64(item.Quantity)
+	}
+	quote.TotalWeightKg = math.Round(quote.TotalWeightKg*1000) / 1000
+
+	switch {
+	case quote.ItemCount == 0:
+		quote.ShippingFee = 0
+	case rate.FreeThreshold > 0 && cart.Subtotal >= rate.FreeThreshold:
+		quote.FreeShipping = true
+		quote.ShippingFee = 0
+	default:
+		fee := rate.BaseFee
+		if extra := quote.TotalWeightKg - rate.BaseWeightKg; extra > 0 {
+			fee += math.Ceil(extra) * rate.PerKgFee
+		}
+		fee += float64(quote.ItemCount-1) * rate.PerItemFee
+		quote.ShippingFee = roundMoney(fee)
+	}
+
+	quote.Total = roundMoney(quote.Subtotal + quote.ShippingFee)
+	return quote, nil
+}
+
+// roundMoney rounds an amount to centavos
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
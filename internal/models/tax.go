@@ -0,0 +1,134 @@
+package models
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Product tax classes. Standard items carry 12% VAT; zero-rated and exempt
+// sales are reported separately on BIR receipts.
+const (
+	TaxClassStandard  = "standard"
+	TaxClassZeroRated = "zero_rated"
+	TaxClassExempt    = "exempt"
+)
+
+// TaxConfig controls how VAT is applied to prices
+type TaxConfig struct {
+	// PricesIncludeTax is true when catalogue prices already contain VAT
+	PricesIncludeTax bool
+	// Rates maps a tax class to its rate (0.12 for 12%)
+	Rates map[string]float64
+	// ShippingTaxClass is the class applied to shipping fees
+	ShippingTaxClass string
+}
+
+// Tax is the active tax configuration. Prices are VAT-inclusive by default,
+// which is how retail prices are shown in the Philippines.
+var Tax = TaxConfig{
+	PricesIncludeTax: true,
+	Rates: map[string]float64{
+		TaxClassStandard:  0.12,
+		TaxClassZeroRated: 0,
+		TaxClassExempt:    0,
+	},
+	ShippingTaxClass: TaxClassStandard,
+}
+
+// LoadTaxConfig reads the VAT_PRICING environment variable ("inclusive" or
+// "exclusive") and updates the active tax configuration
+func LoadTaxConfig() {
+	switch strings.ToLower(os.Getenv("VAT_PRICING")) {
+	case "", "inclusive":
+		Tax.PricesIncludeTax = true
+	case "exclusive":
+		Tax.PricesIncludeTax = false
+	default:
+		slog.Warn("Unknown VAT_PRICING value, using inclusive pricing", "value", os.Getenv("VAT_PRICING"))
+		Tax.PricesIncludeTax = true
+	}
+	slog.Info("VAT pricing", "inclusive", Tax.PricesIncludeTax)
+}
+
+// ValidateTaxClass checks that a tax class is known
+func ValidateTaxClass(class string) error {
+	if _, ok := Tax.Rates[class]; !ok {
+		return FieldError("tax_class", "invalid tax class: %s", class)
+	}
+	return nil
+}
+
+// TaxLine is the tax computed for a single priced line
+type TaxLine struct {
+	TaxClass    string  `json:"tax_class"`
+	TaxRate     float64 `json:"tax_rate"`
+	NetAmount   float64 `json:"net_amount"`
+	TaxAmount   float64 `json:"tax_amount"`
+	GrossAmount float64 `json:"gross_amount"`
+}
+
+// TaxSummary totals the tax lines of an order using the BIR receipt buckets
+type TaxSummary struct {
+	PricesIncludeTax bool    `json:"prices_include_tax"`
+	VatableSales     float64 `json:"vatable_sales"`
+	VatExemptSales   float64 `json:"vat_exempt_sales"`
+	ZeroRatedSales   float64 `json:"zero_rated_sales"`
+	TaxAmount        float64 `json:"tax_amount"`
+	// GrossTotal is what the customer pays for the lines, tax included
+	GrossTotal float64 `json:"gross_total"`
+}
+
+// CalculateTaxLine computes tax for an amount in the given class using the
+// active pricing mode
+func CalculateTaxLine(class string, amount float64) TaxLine {
+	if class == "" {
+		class = TaxClassStandard
+	}
+	rate := Tax.Rates[class]
+	line := TaxLine{TaxClass: class, TaxRate: rate}
+
+	if Tax.PricesIncludeTax {
+		line.GrossAmount = roundMoney(amount)
+		line.NetAmount = roundMoney(amount / (1 + rate))
+		line.TaxAmount = roundMoney(line.GrossAmount - line.NetAmount)
+	} else {
+		line.NetAmount = roundMoney(amount)
+		line.TaxAmount = roundMoney(amount * rate)
+		line.GrossAmount = roundMoney(line.NetAmount + line.TaxAmount)
+	}
+
+	return line
+}
+
+// Add accumulates a tax line into the summary
+func (s *TaxSummary) Add(line TaxLine) {
+	switch line.TaxClass {
+	case TaxClassZeroRated:
+		s.ZeroRatedSales = roundMoney(s.ZeroRatedSales + line.NetAmount)
+	case TaxClassExempt:
+		s.VatExemptSales = roundMoney(s.VatExemptSales + line.NetAmount)
+	default:
+		s.VatableSales = roundMoney(s.VatableSales + line.NetAmount)
+	}
+	s.TaxAmount = roundMoney(s.TaxAmount + line.TaxAmount)
+	s.GrossTotal = roundMoney(s.GrossTotal + line.GrossAmount)
+}
+
+// CalculateOrderTax computes the tax line for every cart item and the
+// shipping fee. The returned lines are in cart item order.
+func CalculateOrderTax(cart *Cart, shippingFee float64) ([]TaxLine, TaxSummary) {
+	summary := TaxSummary{PricesIncludeTax: Tax.PricesIncludeTax}
+	lines := make([]TaxLine, len(cart.Items))
+
+	for i, item := range cart.Items {
+		lines[i] = CalculateTaxLine(item.TaxClass, item.Price*float64(item.Quantity))
+		summary.Add(lines[i])
+	}
+
+	if shippingFee > 0 {
+		summary.Add(CalculateTaxLine(Tax.ShippingTaxClass, shippingFee))
+	}
+
+	return lines, summary
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("go_module/internal/models")
+
+// startSpan starts a span for an exported model function, so traces show how
+// long each step of a request spent in the model layer; the SQL statements
+// the function runs become children of the span. Calls outside a trace, such
+// as the background pollers' and startup's, are not traced.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracer.Start(ctx, name)
+}
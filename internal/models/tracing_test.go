@@ -0,0 +1,78 @@
+package models_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go_module/internal/dbtest"
+	"go_module/internal/models"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// statement returns the SQL a span ran, if any
+func statement(s sdktrace.ReadOnlySpan) string {
+	for _, kv := range s.Attributes() {
+		if kv.Key == "db.statement" {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
+
+// Checkout's queries and commit are children of the model span, so a slow
+// checkout shows where the time went
+func TestCreateOrderSpans(t *testing.T) {
+	user := dbtest.NewUser(t, models.RoleCustomer)
+	if err := models.AddToCart(context.Background(), user.UserID, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	spans.Reset()
+	ctx, root := otel.Tracer("test").Start(context.Background(), t.Name())
+	if _, err := models.CreateOrder(ctx, user.UserID, dbtest.Address, models.PaymentCashOnDelivery); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	for _, s := range spans.Ended() {
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s is in trace %s, want %s", s.Name(), s.SpanContext().TraceID(), root.SpanContext().TraceID())
+		}
+	}
+
+	create := spans.Find("models.CreateOrder")
+	if create == nil {
+		t.Fatalf("no models.CreateOrder span in %v", spans.Names())
+	}
+	if create.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Error("models.CreateOrder is not a child of the caller's span")
+	}
+
+	var names []string
+	insertedOrder, committed := false, false
+	for _, s := range spans.Children(create) {
+		names = append(names, s.Name())
+		insertedOrder = insertedOrder || strings.Contains(statement(s), "INSERT INTO orders")
+		committed = committed || s.Name() == "sql.tx.commit"
+	}
+	if !insertedOrder || !committed {
+		t.Errorf("models.CreateOrder children = %v, want the order insert and the commit", names)
+	}
+	if cart := spans.Find("models.GetCartByUserID"); cart == nil || cart.Parent().SpanID() != create.SpanContext().SpanID() {
+		t.Error("models.GetCartByUserID is not a child of models.CreateOrder")
+	}
+}
+
+// Background work outside a request, such as the pollers, starts no traces
+func TestNoSpansWithoutParent(t *testing.T) {
+	spans.Reset()
+	if _, err := models.GetProductByID(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if names := spans.Names(); len(names) != 0 {
+		t.Errorf("recorded spans %v without a parent span", names)
+	}
+}
@@ -1,38 +1,59 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"time"
 
 	"go_module/internal/database"
-	"go_module/internal/middleware"
 )
 
 type User struct {
-	UserID    int64     `json:"user_id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // Don't return in JSON
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	LastLogin time.Time `json:"last_login,omitempty"`
+	UserID        int64     `json:"user_id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Password      string    `json:"-"` // Don't return in JSON
+	Role          string    `json:"role"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastLogin     time.Time `json:"last_login,omitempty"`
 }
 
+// RequireEmailVerification stops accounts from logging in until their email
+// address has been verified (REQUIRE_EMAIL_VERIFICATION=false turns it off)
+var RequireEmailVerification = true
+
+// Login lockout settings. After LockoutThreshold failed logins in a row an
+// account is locked for LockoutBase, doubling with each further failure up
+// to LockoutMax. A successful login or a password reset clears the count.
+var (
+	LockoutThreshold = 5
+	LockoutBase      = time.Minute
+	LockoutMax       = time.Hour
+)
+
 // Create a new user
-func CreateUser(username, email, password, role string) (*User, error) {
-	log.Printf("Creating user with username: %s, email: %s", username, email)
+func CreateUser(ctx context.Context, username, email, password, role string) (*User, error) {
+	ctx, span := startSpan(ctx, "models.CreateUser")
+	defer span.End()
+
+	slog.DebugContext(ctx, "Creating user", "username", username, "email", email)
 
 	// Store plain text password for testing
 	// In a production environment, you would hash the password here
 
 	// Insert into database with SQLite datetime
-	result, err := database.DB.Exec(
+	result, err := database.DB.ExecContext(ctx,
 		"INSERT INTO users (Username, Email, Password, Role, CreatedAt) VALUES (?, ?, ?, ?, datetime('now'))",
 		username, email, password, role,
 	)
 	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint") {
+			return nil, ConflictError("email already exists")
+		}
 		return nil, fmt.Errorf("failed to insert user: %v", err)
 	}
 
@@ -42,25 +63,31 @@ func CreateUser(username, email, password, role string) (*User, error) {
 		return nil, fmt.Errorf("failed to get last insert ID: %v", err)
 	}
 
-	log.Printf("Successfully created user with ID: %d", id)
+	slog.InfoContext(ctx, "Created user", "user_id", id)
 
 	// Get the created user to return accurate timestamps
-	return GetUserByID(id)
+	return GetUserByID(ctx, id)
 }
 
 // Get user by ID
-func GetUserByID(id int64) (*User, error) {
+func GetUserByID(ctx context.Context, id int64) (*User, error) {
+	ctx, span := startSpan(ctx, "models.GetUserByID")
+	defer span.End()
+
 	user := &User{}
 	var createdAt string
 	var lastLogin sql.NullString // Use sql.NullString to handle NULL
 
-	err := database.DB.QueryRow(
-		"SELECT UserID, Username, Email, Role, CreatedAt, LastLogin FROM users WHERE UserID = ?",
+	err := database.ReadDB.QueryRowContext(ctx,
+		"SELECT UserID, Username, Email, EmailVerified, Role, CreatedAt, LastLogin FROM users WHERE UserID = ?",
 		id,
-	).Scan(&user.UserID, &user.Username, &user.Email, &user.Role, &createdAt, &lastLogin)
+	).Scan(&user.UserID, &user.Username, &user.Email, &user.EmailVerified, &user.Role, &createdAt, &lastLogin)
 
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("user not found")
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
 	}
 
 	// Parse SQLite datetime strings
@@ -72,57 +99,183 @@ func GetUserByID(id int64) (*User, error) {
 	return user, nil
 }
 
+// GetUsers returns every user account, newest first
+func GetUsers(ctx context.Context) ([]User, error) {
+	ctx, span := startSpan(ctx, "models.GetUsers")
+	defer span.End()
+
+	rows, err := database.ReadDB.QueryContext(ctx,
+		"SELECT UserID, Username, Email, EmailVerified, Role, CreatedAt, LastLogin FROM users ORDER BY UserID DESC",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		var createdAt string
+		var lastLogin sql.NullString
+		if err := rows.Scan(&u.UserID, &u.Username, &u.Email, &u.EmailVerified, &u.Role, &createdAt, &lastLogin); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		u.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+		if lastLogin.Valid {
+			u.LastLogin, _ = time.Parse("2006-01-02 15:04:05", lastLogin.String)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	return users, nil
+}
+
+// GetUserByEmail returns the user with an email address
+func GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, span := startSpan(ctx, "models.GetUserByEmail")
+	defer span.End()
+
+	var id int64
+	err := database.ReadDB.QueryRowContext(ctx, "SELECT UserID FROM users WHERE Email = ?", email).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	return GetUserByID(ctx, id)
+}
+
 // Authenticate user
-func AuthenticateUser(email, password string) (*User, string, error) {
+func AuthenticateUser(ctx context.Context, email, password, ipAddress string) (*User, error) {
+	ctx, span := startSpan(ctx, "models.AuthenticateUser")
+	defer span.End()
+
 	// Get user by email
 	user := &User{}
 	var createdAt string
-	log.Printf("Attempting login for email: %s with password: %s", email, password)
+	var failedLogins int
+	var lockedUntil sql.NullString
+	slog.DebugContext(ctx, "Login attempt", "email", email)
 
-	err := database.DB.QueryRow(
-		"SELECT UserID, Username, Email, Password, Role, CreatedAt FROM users WHERE Email = ?",
-		email,
-	).Scan(&user.UserID, &user.Username, &user.Email, &user.Password, &user.Role, &createdAt)
+	err := database.ReadDB.QueryRowContext(ctx, `
+		SELECT UserID, Username, Email, EmailVerified, Password, Role, CreatedAt, FailedLogins, LockedUntil
+		FROM users WHERE Email = ?
+	`, email).Scan(&user.UserID, &user.Username, &user.Email, &user.EmailVerified, &user.Password, &user.Role, &createdAt, &failedLogins, &lockedUntil)
 
+	if err == sql.ErrNoRows {
+		return nil, UnauthorizedError("invalid credentials")
+	}
 	if err != nil {
-		log.Printf("Database error: %v", err)
-		return nil, "", fmt.Errorf("invalid credentials")
+		slog.ErrorContext(ctx, "Failed to fetch user for login", "error", err)
+		return nil, fmt.Errorf("failed to look up user: %v", err)
 	}
 
 	// Parse CreatedAt
 	user.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 
-	log.Printf("Found user: %v with role: %v and stored password: %v", user.Username, user.Role, user.Password)
+	// A locked account is refused even with the right password
+	if lockedUntil.Valid {
+		until, _ := time.Parse("2006-01-02 15:04:05", lockedUntil.String)
+		if wait := time.Until(until); wait > 0 {
+			return nil, RateLimitedError(wait, "too many failed login attempts; try again later")
+		}
+	}
 
 	// Compare password
 	if user.Password != password {
-		log.Printf("Password comparison failed: stored=%s, provided=%s", user.Password, password)
-		return nil, "", fmt.Errorf("invalid credentials")
+		slog.InfoContext(ctx, "Login failed: wrong password", "user_id", user.UserID)
+		if err := recordFailedLogin(ctx, user.UserID, ipAddress); err != nil {
+			slog.ErrorContext(ctx, "Failed to record failed login", "user_id", user.UserID, "error", err)
+		}
+		return nil, UnauthorizedError("invalid credentials")
 	}
 
-	log.Printf("Password verified for user: %s", user.Username)
+	slog.DebugContext(ctx, "Password verified", "user_id", user.UserID)
 
-	// Generate JWT token
-	token, err := middleware.GenerateToken(user.UserID, user.Role)
-	if err != nil {
-		log.Printf("Token generation failed: %v", err)
-		return nil, "", err
+	// Only checked once the password is right, so it doesn't reveal accounts
+	if RequireEmailVerification && !user.EmailVerified {
+		return nil, ForbiddenError("email address has not been verified")
 	}
 
 	// Update last login time using SQLite's datetime function
-	_, err = database.DB.Exec("UPDATE users SET LastLogin = datetime('now') WHERE UserID = ?", user.UserID)
+	_, err = database.DB.ExecContext(ctx,
+		"UPDATE users SET LastLogin = datetime('now'), FailedLogins = 0, LockedUntil = NULL WHERE UserID = ?",
+		user.UserID,
+	)
 	if err != nil {
-		log.Printf("Failed to update last login: %v", err)
+		slog.ErrorContext(ctx, "Failed to update last login", "error", err)
 		// Don't return error here, not critical
 	}
 
-	return user, token, nil
+	return user, nil
+}
+
+// recordFailedLogin counts a wrong password against an account and locks it
+// once the count reaches LockoutThreshold, recording the lockout in the
+// audit log
+func recordFailedLogin(ctx context.Context, userID int64, ipAddress string) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var failed int
+		err := tx.QueryRowContext(ctx,
+			"UPDATE users SET FailedLogins = FailedLogins + 1 WHERE UserID = ? RETURNING FailedLogins",
+			userID,
+		).Scan(&failed)
+		if err != nil {
+			return fmt.Errorf("failed to count failed login: %v", err)
+		}
+		if failed < LockoutThreshold {
+			return nil
+		}
+
+		lockFor := lockoutDuration(failed)
+		until := time.Now().UTC().Add(lockFor)
+		_, err = tx.ExecContext(ctx,
+			"UPDATE users SET LockedUntil = ? WHERE UserID = ?",
+			until.Format("2006-01-02 15:04:05"), userID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to lock account: %v", err)
+		}
+
+		slog.WarnContext(ctx, "Locked account after failed logins", "user_id", userID, "locked_for", lockFor, "failed_logins", failed)
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditLoginLockout,
+			TargetType: "user",
+			TargetID:   fmt.Sprint(userID),
+			Details: map[string]interface{}{
+				"failed_attempts": failed,
+				"locked_seconds":  int(lockFor.Seconds()),
+				"locked_until":    until.Format(time.RFC3339),
+			},
+			IPAddress: ipAddress,
+		})
+	})
+}
+
+// lockoutDuration is how long an account is locked after failed logins in a
+// row: LockoutBase at LockoutThreshold, doubling with each failure after
+func lockoutDuration(failed int) time.Duration {
+	d := LockoutBase
+	for i := LockoutThreshold; i < failed && d < LockoutMax; i++ {
+		d *= 2
+	}
+	if d > LockoutMax {
+		d = LockoutMax
+	}
+	return d
 }
 
 // GetUserCount returns the total number of users
-func GetUserCount() (int, error) {
+func GetUserCount(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "models.GetUserCount")
+	defer span.End()
+
 	var count int
-	err := database.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	err := database.ReadDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count users: %v", err)
 	}
@@ -130,9 +283,12 @@ func GetUserCount() (int, error) {
 }
 
 // IsUserAdmin checks if a user has admin role
-func IsUserAdmin(userID int64) (bool, error) {
+func IsUserAdmin(ctx context.Context, userID int64) (bool, error) {
+	ctx, span := startSpan(ctx, "models.IsUserAdmin")
+	defer span.End()
+
 	var role string
-	err := database.DB.QueryRow("SELECT Role FROM users WHERE UserID = ?", userID).Scan(&role)
+	err := database.ReadDB.QueryRowContext(ctx, "SELECT Role FROM users WHERE UserID = ?", userID).Scan(&role)
 	if err != nil {
 		return false, fmt.Errorf("failed to get user role: %v", err)
 	}
@@ -141,25 +297,28 @@ func IsUserAdmin(userID int64) (bool, error) {
 }
 
 // EnsureAdminExists checks if the admin user exists and creates it if it doesn't
-func EnsureAdminExists() error {
+func EnsureAdminExists(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "models.EnsureAdminExists")
+	defer span.End()
+
 	var count int
-	err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE Email = 'admin@example.com'").Scan(&count)
+	err := database.ReadDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE Email = 'admin@example.com'").Scan(&count)
 	if err != nil {
 		return fmt.Errorf("failed to check if admin exists: %v", err)
 	}
 
 	if count == 0 {
-		log.Println("Admin user does not exist, creating...")
-		_, err := database.DB.Exec(`
-			INSERT INTO users (Username, Email, Password, Role, CreatedAt)
-			VALUES ('admin', 'admin@example.com', 'admin123', 'admin', datetime('now'))
+		slog.InfoContext(ctx, "Admin user does not exist, creating")
+		_, err := database.DB.ExecContext(ctx, `
+			INSERT INTO users (Username, Email, Password, Role, EmailVerified, CreatedAt)
+			VALUES ('admin', 'admin@example.com', 'admin123', 'admin', 1, datetime('now'))
 		`)
 		if err != nil {
 			return fmt.Errorf("failed to create admin user: %v", err)
 		}
-		log.Println("Admin user created successfully")
+		slog.InfoContext(ctx, "Admin user created successfully")
 	} else {
-		log.Println("Admin user already exists")
+		slog.InfoContext(ctx, "Admin user already exists")
 	}
 
 	return nil
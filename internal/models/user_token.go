@@ -0,0 +1,152 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go_module/internal/database"
+)
+
+// Purposes of the single-use tokens sent to users by email. A token only
+// works for the purpose it was issued for.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// How long emailed links stay valid
+const (
+	EmailVerificationTTL = 24 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+// CreateUserToken issues a single-use token for a user, such as for an email
+// verification or password reset link. Like refresh tokens, only its hash
+// is stored.
+func CreateUserToken(ctx context.Context, userID int64, purpose string, ttl time.Duration) (string, error) {
+	ctx, span := startSpan(ctx, "models.CreateUserToken")
+	defer span.End()
+
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	_, err = database.DB.ExecContext(ctx,
+		"INSERT INTO user_tokens (TokenHash, UserID, Purpose, CreatedAt, ExpiresAt) VALUES (?, ?, ?, ?, ?)",
+		hash, userID, purpose,
+		now.Format("2006-01-02 15:04:05"), now.Add(ttl).Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s token: %v", purpose, err)
+	}
+
+	return token, nil
+}
+
+// consumeUserToken checks a token and marks it used, along with every other
+// unused token the user has for the same purpose, and returns its user
+func consumeUserToken(ctx context.Context, tx *sql.Tx, token, purpose string) (int64, error) {
+	var userID int64
+	var expiresAt string
+	var usedAt sql.NullString
+	err := tx.QueryRowContext(ctx,
+		"SELECT UserID, ExpiresAt, UsedAt FROM user_tokens WHERE TokenHash = ? AND Purpose = ?",
+		hashSecretToken(token), purpose,
+	).Scan(&userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return 0, ValidationError("invalid or expired link")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up token: %v", err)
+	}
+
+	expires, _ := time.Parse("2006-01-02 15:04:05", expiresAt)
+	if usedAt.Valid {
+		return 0, ValidationError("this link has already been used")
+	}
+	if time.Now().UTC().After(expires) {
+		return 0, ValidationError("invalid or expired link")
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE user_tokens SET UsedAt = datetime('now') WHERE UserID = ? AND Purpose = ? AND UsedAt IS NULL",
+		userID, purpose,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to use token: %v", err)
+	}
+	return userID, nil
+}
+
+// VerifyEmail marks the email address of a verification token's user as
+// verified
+func VerifyEmail(ctx context.Context, token string) (*User, error) {
+	ctx, span := startSpan(ctx, "models.VerifyEmail")
+	defer span.End()
+
+	var userID int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		userID, err = consumeUserToken(ctx, tx, token, TokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE users SET EmailVerified = 1 WHERE UserID = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to verify email: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Email verified", "user_id", userID)
+	return GetUserByID(ctx, userID)
+}
+
+// ResetPassword sets a new password for a password reset token's user and
+// logs them out everywhere. Receiving the link also proves they own the
+// email address, so it counts as verified.
+func ResetPassword(ctx context.Context, token, password string) error {
+	ctx, span := startSpan(ctx, "models.ResetPassword")
+	defer span.End()
+
+	var userID int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		userID, err = consumeUserToken(ctx, tx, token, TokenResetPassword)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE users SET Password = ?, EmailVerified = 1, FailedLogins = 0, LockedUntil = NULL WHERE UserID = ?",
+			password, userID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to reset password: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE sessions SET RevokedAt = datetime('now') WHERE UserID = ? AND RevokedAt IS NULL",
+			userID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Password reset", "user_id", userID)
+	return nil
+}
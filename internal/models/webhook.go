@@ -0,0 +1,689 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_module/internal/database"
+	"go_module/internal/events"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook is an integrator's endpoint subscribed to domain events. Secret is
+// only filled in when the webhook is created or its secret is rotated.
+type Webhook struct {
+	WebhookID   int64     `json:"webhook_id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	Secret      string    `json:"secret,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is one event sent, or waiting to be sent, to a webhook.
+// Payload is the exact body posted; a replay is a new delivery of the same
+// payload that points back at the original with ReplayOf.
+type WebhookDelivery struct {
+	DeliveryID     int64      `json:"delivery_id"`
+	WebhookID      int64      `json:"webhook_id"`
+	EventID        *int64     `json:"event_id,omitempty"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `json:"response_body,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DurationMs     int64      `json:"duration_ms,omitempty"`
+	ReplayOf       *int64     `json:"replay_of,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// OutgoingWebhook is a claimed delivery with what is needed to send it
+type OutgoingWebhook struct {
+	DeliveryID int64
+	WebhookID  int64
+	EventType  string
+	Payload    string
+	Attempts   int
+	URL        string
+	Secret     string
+}
+
+// WebhookAttempt is the outcome of sending a delivery once. A zero RetryAt
+// on a failed attempt gives up on the delivery.
+type WebhookAttempt struct {
+	Delivered      bool
+	ResponseStatus int
+	ResponseBody   string
+	Error          string
+	Duration       time.Duration
+	RetryAt        time.Time
+}
+
+const webhookColumns = "WebhookID, URL, COALESCE(Description, ''), Events, Active, CreatedAt, UpdatedAt"
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*Webhook, error) {
+	var w Webhook
+	var eventTypes, createdAt, updatedAt string
+	if err := row.Scan(&w.WebhookID, &w.URL, &w.Description, &eventTypes, &w.Active, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	w.Events = strings.Split(eventTypes, ",")
+	w.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	w.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	return &w, nil
+}
+
+const webhookDeliveryColumns = `DeliveryID, WebhookID, EventID, EventType, Payload, Status, Attempts,
+	NextAttemptAt, COALESCE(ResponseStatus, 0), COALESCE(ResponseBody, ''), COALESCE(LastError, ''),
+	COALESCE(DurationMs, 0), ReplayOf, CreatedAt, DeliveredAt`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var eventID, replayOf sql.NullInt64
+	var nextAttemptAt, createdAt string
+	var deliveredAt sql.NullString
+	err := row.Scan(&d.DeliveryID, &d.WebhookID, &eventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&nextAttemptAt, &d.ResponseStatus, &d.ResponseBody, &d.LastError,
+		&d.DurationMs, &replayOf, &createdAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if eventID.Valid {
+		d.EventID = &eventID.Int64
+	}
+	if replayOf.Valid {
+		d.ReplayOf = &replayOf.Int64
+	}
+	if d.Status == WebhookDeliveryPending {
+		t, _ := time.Parse("2006-01-02 15:04:05", nextAttemptAt)
+		d.NextAttemptAt = &t
+	}
+	d.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	if deliveredAt.Valid {
+		t, _ := time.Parse("2006-01-02 15:04:05", deliveredAt.String)
+		d.DeliveredAt = &t
+	}
+	return &d, nil
+}
+
+// validateWebhook checks a webhook's URL and event types, returning the
+// event types without duplicates
+func validateWebhook(rawURL string, eventTypes []string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, FieldError("url", "url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return nil, FieldError("url", "url must not contain credentials; verify deliveries with the signing secret")
+	}
+
+	known := make(map[string]bool, len(events.Types))
+	for _, t := range events.Types {
+		known[t] = true
+	}
+
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, t := range eventTypes {
+		if !known[t] {
+			return nil, FieldError("events", "unknown event type: %s", t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, FieldError("events", "subscribe to at least one event type")
+	}
+	return unique, nil
+}
+
+// newWebhookSecret generates a signing secret
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// CreateWebhook subscribes an endpoint to event types and returns it with
+// its newly generated signing secret
+func CreateWebhook(ctx context.Context, rawURL, description string, eventTypes []string) (*Webhook, error) {
+	ctx, span := startSpan(ctx, "models.CreateWebhook")
+	defer span.End()
+
+	eventTypes, err := validateWebhook(rawURL, eventTypes)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	var id int64
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO webhooks (URL, Description, Events, Secret, Active, CreatedAt, UpdatedAt)
+			VALUES (?, NULLIF(?, ''), ?, ?, 1, datetime('now'), datetime('now'))
+		`, rawURL, description, strings.Join(eventTypes, ","), secret)
+		if err != nil {
+			return fmt.Errorf("failed to create webhook: %v", err)
+		}
+		id, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get webhook ID: %v", err)
+		}
+
+		after, err := getWebhookAudit(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditWebhookCreate,
+			TargetType: "webhook",
+			TargetID:   strconv.FormatInt(id, 10),
+			After:      after,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := GetWebhookByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	w.Secret = secret
+	return w, nil
+}
+
+// GetWebhooks returns every webhook, without secrets
+func GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	ctx, span := startSpan(ctx, "models.GetWebhooks")
+	defer span.End()
+
+	rows, err := database.ReadDB.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY WebhookID")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %v", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %v", err)
+		}
+		webhooks = append(webhooks, *w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %v", err)
+	}
+	return webhooks, nil
+}
+
+// GetWebhookByID returns a webhook without its secret
+func GetWebhookByID(ctx context.Context, id int64) (*Webhook, error) {
+	ctx, span := startSpan(ctx, "models.GetWebhookByID")
+	defer span.End()
+
+	w, err := scanWebhook(database.ReadDB.QueryRowContext(ctx,
+		"SELECT "+webhookColumns+" FROM webhooks WHERE WebhookID = ?", id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("webhook not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook: %v", err)
+	}
+	return w, nil
+}
+
+// UpdateWebhook changes a webhook's URL, description, event types and
+// whether it is active. Deliveries already queued keep their payloads.
+func UpdateWebhook(ctx context.Context, id int64, rawURL, description string, eventTypes []string, active bool) (*Webhook, error) {
+	ctx, span := startSpan(ctx, "models.UpdateWebhook")
+	defer span.End()
+
+	eventTypes, err := validateWebhook(rawURL, eventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := getWebhookAudit(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE webhooks
+			SET URL = ?, Description = NULLIF(?, ''), Events = ?, Active = ?, UpdatedAt = datetime('now')
+			WHERE WebhookID = ?
+		`, rawURL, description, strings.Join(eventTypes, ","), active, id)
+		if err != nil {
+			return fmt.Errorf("failed to update webhook: %v", err)
+		}
+
+		after, err := getWebhookAudit(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditWebhookUpdate,
+			TargetType: "webhook",
+			TargetID:   strconv.FormatInt(id, 10),
+			Before:     before,
+			After:      after,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetWebhookByID(ctx, id)
+}
+
+// RotateWebhookSecret replaces a webhook's signing secret and returns the
+// webhook with the new one. Deliveries are signed with it from the next
+// attempt on.
+func RotateWebhookSecret(ctx context.Context, id int64) (*Webhook, error) {
+	ctx, span := startSpan(ctx, "models.RotateWebhookSecret")
+	defer span.End()
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	// The audit entry records that the secret changed, never the secret
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE webhooks SET Secret = ?, UpdatedAt = datetime('now') WHERE WebhookID = ?",
+			secret, id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to rotate webhook secret: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return NotFoundError("webhook not found")
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditWebhookRotateSecret,
+			TargetType: "webhook",
+			TargetID:   strconv.FormatInt(id, 10),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := GetWebhookByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	w.Secret = secret
+	return w, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func DeleteWebhook(ctx context.Context, id int64) error {
+	ctx, span := startSpan(ctx, "models.DeleteWebhook")
+	defer span.End()
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := getWebhookAudit(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE WebhookID = ?", id); err != nil {
+			return fmt.Errorf("failed to delete webhook deliveries: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM webhooks WHERE WebhookID = ?", id); err != nil {
+			return fmt.Errorf("failed to delete webhook: %v", err)
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditWebhookDelete,
+			TargetType: "webhook",
+			TargetID:   strconv.FormatInt(id, 10),
+			Before:     before,
+		})
+	})
+}
+
+// webhookAudit is a webhook as recorded in the audit log, without its secret
+type webhookAudit struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	Active      bool     `json:"active"`
+}
+
+// getWebhookAudit reads a webhook's audited fields inside tx
+func getWebhookAudit(ctx context.Context, tx *sql.Tx, id int64) (*webhookAudit, error) {
+	var w webhookAudit
+	var eventTypes string
+	err := tx.QueryRowContext(ctx,
+		"SELECT URL, COALESCE(Description, ''), Events, Active FROM webhooks WHERE WebhookID = ?", id,
+	).Scan(&w.URL, &w.Description, &eventTypes, &w.Active)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("webhook not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook: %v", err)
+	}
+	w.Events = strings.Split(eventTypes, ",")
+	return &w, nil
+}
+
+// QueueWebhookDeliveries queues an event's payload for every active webhook
+// subscribed to its type and returns how many deliveries were queued. An
+// event is only queued once per webhook, so handling it again is harmless.
+func QueueWebhookDeliveries(ctx context.Context, eventID int64, eventType string, payload []byte) (int, error) {
+	ctx, span := startSpan(ctx, "models.QueueWebhookDeliveries")
+	defer span.End()
+
+	queued := 0
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		queued = 0
+		rows, err := tx.QueryContext(ctx, "SELECT WebhookID, Events FROM webhooks WHERE Active = 1")
+		if err != nil {
+			return fmt.Errorf("failed to fetch webhooks: %v", err)
+		}
+		defer rows.Close()
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			var eventTypes string
+			if err := rows.Scan(&id, &eventTypes); err != nil {
+				return fmt.Errorf("failed to scan webhook: %v", err)
+			}
+			for _, t := range strings.Split(eventTypes, ",") {
+				if t == eventType {
+					ids = append(ids, id)
+					break
+				}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to fetch webhooks: %v", err)
+		}
+		rows.Close()
+
+		for _, id := range ids {
+			result, err := tx.ExecContext(ctx, `
+				INSERT OR IGNORE INTO webhook_deliveries (WebhookID, EventID, EventType, Payload, NextAttemptAt, CreatedAt)
+				VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
+			`, id, eventID, eventType, string(payload))
+			if err != nil {
+				return fmt.Errorf("failed to queue webhook delivery: %v", err)
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				queued++
+			}
+		}
+		return nil
+	})
+	return queued, err
+}
+
+// QueueWebhookPing queues a test payload for a webhook whatever events it
+// is subscribed to
+func QueueWebhookPing(ctx context.Context, webhookID int64, eventType string, payload []byte) (*WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "models.QueueWebhookPing")
+	defer span.End()
+
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkWebhookActive(ctx, tx, webhookID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (WebhookID, EventType, Payload, NextAttemptAt, CreatedAt)
+			VALUES (?, ?, ?, datetime('now'), datetime('now'))
+		`, webhookID, eventType, string(payload))
+		if err != nil {
+			return fmt.Errorf("failed to queue webhook ping: %v", err)
+		}
+		id, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get delivery ID: %v", err)
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditWebhookPing,
+			TargetType: "webhook",
+			TargetID:   strconv.FormatInt(webhookID, 10),
+			After:      map[string]int64{"delivery_id": id},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetWebhookDelivery(ctx, webhookID, id)
+}
+
+// ReplayWebhookDelivery queues the payload of an earlier delivery again as a
+// new delivery, leaving the original in the log as it was
+func ReplayWebhookDelivery(ctx context.Context, webhookID, deliveryID int64) (*WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "models.ReplayWebhookDelivery")
+	defer span.End()
+
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkWebhookActive(ctx, tx, webhookID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (WebhookID, EventID, EventType, Payload, ReplayOf, NextAttemptAt, CreatedAt)
+			SELECT WebhookID, EventID, EventType, Payload, DeliveryID, datetime('now'), datetime('now')
+			FROM webhook_deliveries
+			WHERE DeliveryID = ? AND WebhookID = ?
+		`, deliveryID, webhookID)
+		if err != nil {
+			return fmt.Errorf("failed to replay webhook delivery: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return NotFoundError("webhook delivery not found")
+		}
+		id, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get delivery ID: %v", err)
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     AuditWebhookReplay,
+			TargetType: "webhook",
+			TargetID:   strconv.FormatInt(webhookID, 10),
+			After:      map[string]int64{"delivery_id": id, "replay_of": deliveryID},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetWebhookDelivery(ctx, webhookID, id)
+}
+
+// checkWebhookActive fails unless a webhook exists and is active
+func checkWebhookActive(ctx context.Context, tx *sql.Tx, id int64) error {
+	var active bool
+	err := tx.QueryRowContext(ctx, "SELECT Active FROM webhooks WHERE WebhookID = ?", id).Scan(&active)
+	if err == sql.ErrNoRows {
+		return NotFoundError("webhook not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhook: %v", err)
+	}
+	if !active {
+		return ConflictError("webhook is disabled")
+	}
+	return nil
+}
+
+// GetWebhookDelivery returns one delivery of a webhook
+func GetWebhookDelivery(ctx context.Context, webhookID, deliveryID int64) (*WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "models.GetWebhookDelivery")
+	defer span.End()
+
+	d, err := scanWebhookDelivery(database.ReadDB.QueryRowContext(ctx,
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE DeliveryID = ? AND WebhookID = ?",
+		deliveryID, webhookID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError("webhook delivery not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook delivery: %v", err)
+	}
+	return d, nil
+}
+
+// GetWebhookDeliveries returns a webhook's most recent deliveries, newest
+// first, optionally only those with a status
+func GetWebhookDeliveries(ctx context.Context, webhookID int64, status string, limit int) ([]WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "models.GetWebhookDeliveries")
+	defer span.End()
+
+	switch status {
+	case "", WebhookDeliveryPending, WebhookDeliveryDelivered, WebhookDeliveryFailed:
+	default:
+		return nil, FieldError("status", "status must be pending, delivered or failed")
+	}
+	if _, err := GetWebhookByID(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.ReadDB.QueryContext(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE WebhookID = ? AND (? = '' OR Status = ?)
+		ORDER BY DeliveryID DESC
+		LIMIT ?
+	`, webhookID, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %v", err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook deliveries: %v", err)
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit due deliveries to active
+// webhooks and holds them for lease, so they are not sent twice at once. A
+// delivery whose sender stops before recording the attempt is sent again
+// once the lease runs out.
+func ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]OutgoingWebhook, error) {
+	ctx, span := startSpan(ctx, "models.ClaimWebhookDeliveries")
+	defer span.End()
+
+	now := time.Now().UTC()
+	var claimed []OutgoingWebhook
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		claimed = nil
+		rows, err := tx.QueryContext(ctx, `
+			SELECT d.DeliveryID, d.WebhookID, d.EventType, d.Payload, d.Attempts, w.URL, w.Secret
+			FROM webhook_deliveries d
+			JOIN webhooks w ON w.WebhookID = d.WebhookID
+			WHERE d.Status = ? AND d.NextAttemptAt <= ? AND w.Active = 1
+			ORDER BY d.NextAttemptAt, d.DeliveryID
+			LIMIT ?
+		`, WebhookDeliveryPending, now.Format("2006-01-02 15:04:05"), limit)
+		if err != nil {
+			return fmt.Errorf("failed to fetch webhook deliveries: %v", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var o OutgoingWebhook
+			if err := rows.Scan(&o.DeliveryID, &o.WebhookID, &o.EventType, &o.Payload, &o.Attempts, &o.URL, &o.Secret); err != nil {
+				return fmt.Errorf("failed to scan webhook delivery: %v", err)
+			}
+			claimed = append(claimed, o)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to fetch webhook deliveries: %v", err)
+		}
+		rows.Close()
+
+		leaseUntil := now.Add(lease).Format("2006-01-02 15:04:05")
+		for _, o := range claimed {
+			_, err := tx.ExecContext(ctx,
+				"UPDATE webhook_deliveries SET NextAttemptAt = ? WHERE DeliveryID = ?",
+				leaseUntil, o.DeliveryID,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to claim webhook delivery: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// RecordWebhookAttempt saves the outcome of sending a delivery: delivered,
+// scheduled for another attempt, or failed for good
+func RecordWebhookAttempt(ctx context.Context, deliveryID int64, a WebhookAttempt) error {
+	ctx, span := startSpan(ctx, "models.RecordWebhookAttempt")
+	defer span.End()
+
+	status := WebhookDeliveryFailed
+	retryAt := time.Now().UTC()
+	if a.Delivered {
+		status = WebhookDeliveryDelivered
+	} else if !a.RetryAt.IsZero() {
+		status = WebhookDeliveryPending
+		retryAt = a.RetryAt.UTC()
+	}
+
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET Status = ?, Attempts = Attempts + 1, NextAttemptAt = ?,
+			ResponseStatus = NULLIF(?, 0), ResponseBody = NULLIF(?, ''), LastError = NULLIF(?, ''),
+			DurationMs = ?, DeliveredAt = CASE WHEN ? THEN datetime('now') END
+		WHERE DeliveryID = ?
+	`, status, retryAt.Format("2006-01-02 15:04:05"),
+		a.ResponseStatus, a.ResponseBody, a.Error,
+		a.Duration.Milliseconds(), a.Delivered, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Package notify sends customers and staff templated emails.
+//
+// Order emails hang off the domain event bus: HandleEvent is subscribed to
+// the order events in main, so each email is sent in the background after
+// the change commits and retried by the dispatcher when sending fails.
+// Account emails carry single-use links and are rendered here but sent
+// directly by the handlers, so the links are never stored.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go_module/internal/events"
+	"go_module/internal/mail"
+	"go_module/internal/models"
+)
+
+// StoreName is shown in every email
+const StoreName = "ZaneMNL"
+
+// AppURL is the address of the storefront that links in emails point to
+// (APP_URL)
+var AppURL = "http://localhost:3000"
+
+// StockAlertEmail receives an email when a product runs low on stock; empty
+// turns the alerts off (STOCK_ALERT_EMAIL)
+var StockAlertEmail = ""
+
+// EventTypes are the events HandleEvent sends email for
+var EventTypes = []string{events.OrderPlaced, events.PaymentVerified, events.OrderStatusChanged, events.StockLow}
+
+// statusEmails maps order statuses to the email sent when an order enters
+// them
+var statusEmails = map[string]string{
+	"shipped":   EmailOrderShipped,
+	"delivered": EmailOrderDelivered,
+	"cancelled": EmailOrderCancelled,
+}
+
+// orderEmail is the data the order email templates are rendered with
+type orderEmail struct {
+	StoreName           string
+	OrdersURL           string
+	User                *models.User
+	Order               *models.Order
+	PaymentMethod       string
+	PaymentInstructions string
+}
+
+// AccountEmail is the data the account email templates are rendered with
+type AccountEmail struct {
+	StoreName string
+	User      *models.User
+	Link      string
+	ExpiresIn string
+}
+
+// stockEmail is the data the low stock alert is rendered with
+type stockEmail struct {
+	StoreName   string
+	ProductsURL string
+	Product     events.StockLowData
+}
+
+// HandleEvent emails the customer about an order event, or staff about low
+// stock. It is an events.Handler.
+func HandleEvent(ctx context.Context, e events.Event) error {
+	switch e.Type {
+	case events.OrderPlaced:
+		var data events.OrderPlacedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return sendOrderEmail(ctx, data.OrderID, EmailOrderPlaced)
+
+	case events.PaymentVerified:
+		var data events.PaymentVerifiedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return sendOrderEmail(ctx, data.OrderID, EmailPaymentVerified)
+
+	case events.OrderStatusChanged:
+		var data events.OrderStatusChangedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		template, ok := statusEmails[data.NewStatus]
+		if !ok {
+			return nil
+		}
+		// A shipped order whose tracking number changes is announced again
+		// so the customer gets the new number
+		if data.NewStatus == data.OldStatus && !(data.NewStatus == "shipped" && data.TrackingChanged) {
+			return nil
+		}
+		return sendOrderEmail(ctx, data.OrderID, template)
+
+	case events.StockLow:
+		if StockAlertEmail == "" {
+			return nil
+		}
+		var data events.StockLowData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		msg, err := Render(StockAlertEmail, EmailStockLow, stockEmail{
+			StoreName:   StoreName,
+			ProductsURL: AppURL + "/admin/products",
+			Product:     data,
+		})
+		if err != nil {
+			return events.Permanent(err)
+		}
+		return mail.Send(ctx, msg)
+	}
+
+	return nil
+}
+
+// sendOrderEmail renders an order email from the order as it is now and
+// sends it to the customer
+func sendOrderEmail(ctx context.Context, orderID int64, template string) error {
+	order, err := models.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return notFoundIsPermanent(err)
+	}
+	user, err := models.GetUserByID(ctx, order.UserID)
+	if err != nil {
+		return notFoundIsPermanent(err)
+	}
+
+	data := orderEmail{
+		StoreName:     StoreName,
+		OrdersURL:     AppURL + "/orders",
+		User:          user,
+		Order:         order,
+		PaymentMethod: order.PaymentMethod,
+	}
+	if method, err := models.GetPaymentMethod(order.PaymentMethod); err == nil {
+		data.PaymentMethod = method.Name
+		data.PaymentInstructions = method.Instructions
+	}
+
+	msg, err := Render(user.Email, template, data)
+	if err != nil {
+		return events.Permanent(err)
+	}
+	if err := mail.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send %s email for order %d: %v", template, orderID, err)
+	}
+	return nil
+}
+
+// notFoundIsPermanent stops retrying emails about orders or users that no
+// longer exist
+func notFoundIsPermanent(err error) error {
+	if errors.Is(err, models.ErrNotFound) {
+		return events.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package notify_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go_module/internal/database"
+	"go_module/internal/dbtest"
+	"go_module/internal/events"
+	"go_module/internal/mailtest"
+	"go_module/internal/models"
+	"go_module/internal/notify"
+)
+
+func TestMain(m *testing.M) {
+	// Subscribers must exist before the events they receive are recorded
+	events.Subscribe("email", notify.HandleEvent, notify.EventTypes...)
+	dbtest.Main(m)
+}
+
+// orderPlacedDelivery returns the status and attempts of the email delivery
+// of an order's OrderPlaced event
+func orderPlacedDelivery(t *testing.T, orderID int64) (status string, attempts int) {
+	t.Helper()
+	err := database.ReadDB.QueryRow(`
+		SELECT d.Status, d.Attempts FROM event_deliveries d
+		JOIN domain_events e ON e.EventID = d.EventID
+		WHERE d.Subscriber = 'email' AND e.Type = ? AND json_extract(e.Payload, '$.order_id') = ?
+	`, events.OrderPlaced, orderID).Scan(&status, &attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, attempts
+}
+
+// dispatchNow makes every pending delivery due, skipping the retry delay,
+// and dispatches them
+func dispatchNow(t *testing.T) {
+	t.Helper()
+	_, err := database.DB.Exec("UPDATE event_deliveries SET NextAttemptAt = datetime('now') WHERE Status = ?", events.DeliveryPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := events.DispatchPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOrderEmailRetried(t *testing.T) {
+	sink := mailtest.Install()
+	user := dbtest.NewUser(t, models.RoleCustomer)
+	order := dbtest.PlaceOrder(t, user.UserID, models.PaymentCashOnDelivery)
+
+	sink.FailNext(1, errors.New("smtp: connection refused"))
+	dispatchNow(t)
+	if got := sink.To(user.Email); len(got) != 0 {
+		t.Fatalf("sent %d emails while the mailer was failing", len(got))
+	}
+	if status, attempts := orderPlacedDelivery(t, order.OrderID); status != events.DeliveryPending || attempts != 1 {
+		t.Fatalf("delivery after failure = %s after %d attempts, want pending after 1", status, attempts)
+	}
+
+	dispatchNow(t)
+	got := sink.To(user.Email)
+	if len(got) != 1 {
+		t.Fatalf("sent %d emails after the retry, want 1", len(got))
+	}
+	if got[0].Subject == "" || got[0].Text == "" {
+		t.Errorf("order email has no subject or body: %+v", got[0])
+	}
+	if status, attempts := orderPlacedDelivery(t, order.OrderID); status != events.DeliveryDelivered || attempts != 2 {
+		t.Errorf("delivery = %s after %d attempts, want delivered after 2", status, attempts)
+	}
+}
+
+func TestOrderEmailGivenUp(t *testing.T) {
+	defer func(n int) { events.MaxAttempts = n }(events.MaxAttempts)
+	events.MaxAttempts = 2
+
+	sink := mailtest.Install()
+	user := dbtest.NewUser(t, models.RoleCustomer)
+	order := dbtest.PlaceOrder(t, user.UserID, models.PaymentCashOnDelivery)
+
+	sink.FailNext(2, errors.New("smtp: mailbox unavailable"))
+	dispatchNow(t)
+	dispatchNow(t)
+	// Given up on: a third dispatch would send it
+	dispatchNow(t)
+
+	if got := sink.To(user.Email); len(got) != 0 {
+		t.Errorf("sent %d emails, want none", len(got))
+	}
+	if status, attempts := orderPlacedDelivery(t, order.OrderID); status != events.DeliveryFailed || attempts != 2 {
+		t.Errorf("delivery = %s after %d attempts, want failed after 2", status, attempts)
+	}
+}
@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"go_module/internal/mail"
+	"go_module/internal/models"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Emails that can be rendered. Order emails are sent by HandleEvent; the
+// account emails are sent directly by the handlers.
+const (
+	EmailOrderPlaced     = "order_placed"
+	EmailPaymentVerified = "payment_verified"
+	EmailOrderShipped    = "order_shipped"
+	EmailOrderDelivered  = "order_delivered"
+	EmailOrderCancelled  = "order_cancelled"
+	EmailStockLow        = "stock_low"
+	EmailVerifyEmail     = "verify_email"
+	EmailResetPassword   = "reset_password"
+)
+
+var templateNames = []string{
+	EmailOrderPlaced,
+	EmailPaymentVerified,
+	EmailOrderShipped,
+	EmailOrderDelivered,
+	EmailOrderCancelled,
+	EmailStockLow,
+	EmailVerifyEmail,
+	EmailResetPassword,
+}
+
+// emailTemplate is the plain text and HTML version of one email. Both define
+// a "subject" template; the text version's is used.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var templates = loadTemplates()
+
+var templateFuncs = map[string]interface{}{
+	"money": money,
+	"lineTotal": func(item models.OrderItem) float64 {
+		return item.PriceAtPurchase * float64(item.Quantity)
+	},
+	"button": func(url, label string) map[string]string {
+		return map[string]string{"URL": url, "Label": label}
+	},
+	// breaklines keeps the line breaks of multi-line text, such as an
+	// address, in HTML
+	"breaklines": func(s string) htmltemplate.HTML {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			lines[i] = htmltemplate.HTMLEscapeString(line)
+		}
+		return htmltemplate.HTML(strings.Join(lines, "<br>"))
+	},
+}
+
+// loadTemplates parses every email template, panicking on a broken one so
+// mistakes show up at startup rather than when a customer's email is sent
+func loadTemplates() map[string]*emailTemplate {
+	loaded := make(map[string]*emailTemplate, len(templateNames))
+	for _, name := range templateNames {
+		text := texttemplate.Must(texttemplate.New(name+".txt").Funcs(templateFuncs).
+			ParseFS(templateFS, "templates/"+name+".txt", "templates/footer.txt"))
+		html := htmltemplate.Must(htmltemplate.New("layout.html").Funcs(templateFuncs).
+			ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html"))
+		loaded[name] = &emailTemplate{text: text, html: html}
+	}
+	return loaded
+}
+
+// Render builds the named email for a recipient from its templates
+func Render(to, name string, data interface{}) (mail.Message, error) {
+	t, ok := templates[name]
+	if !ok {
+		return mail.Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return mail.Message{}, fmt.Errorf("failed to render %s subject: %v", name, err)
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return mail.Message{}, fmt.Errorf("failed to render %s text: %v", name, err)
+	}
+	if err := t.html.Execute(&html, data); err != nil {
+		return mail.Message{}, fmt.Errorf("failed to render %s HTML: %v", name, err)
+	}
+
+	return mail.Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    strings.TrimSpace(html.String()) + "\n",
+	}, nil
+}
+
+// money formats an amount in pesos, such as ₱1,234.50
+func money(amount float64) string {
+	s := fmt.Sprintf("%.2f", amount)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	whole, cents := s[:len(s)-3], s[len(s)-3:]
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return sign + "₱" + b.String() + cents
+}
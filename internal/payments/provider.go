@@ -0,0 +1,116 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Payment statuses shared by every provider
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusRefunded  = "refunded"
+)
+
+// Webhook event types providers translate their notifications into
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+	EventRefundSucceeded  = "refund.succeeded"
+)
+
+// IntentRequest describes the payment a customer is about to make
+type IntentRequest struct {
+	OrderID     int64
+	PaymentID   int64
+	Method      string
+	Amount      float64
+	Currency    string
+	Description string
+}
+
+// Intent is what a provider returns after creating a payment; the customer
+// completes the payment at CheckoutURL
+type Intent struct {
+	ProviderRef string `json:"provider_ref"`
+	CheckoutURL string `json:"checkout_url,omitempty"`
+	Status      string `json:"status"`
+}
+
+// WebhookEvent is a verified provider notification
+type WebhookEvent struct {
+	ID            string  `json:"id"`
+	Type          string  `json:"type"`
+	ProviderRef   string  `json:"provider_ref"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	FailureReason string  `json:"failure_reason,omitempty"`
+}
+
+// Refund is the result of a refund request
+type Refund struct {
+	ProviderRef string  `json:"provider_ref"`
+	Amount      float64 `json:"amount"`
+	Status      string  `json:"status"`
+}
+
+// Provider is implemented by each payment gateway integration (GCash,
+// PayMongo, ...). Providers only talk to the gateway; recording payments and
+// updating orders is left to the caller.
+type Provider interface {
+	// Name identifies the provider in webhook URLs and stored payments
+	Name() string
+	// CreateIntent starts a payment with the gateway
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	// HandleWebhook verifies the signature of an incoming notification and
+	// translates it into a WebhookEvent
+	HandleWebhook(payload []byte, header http.Header) (*WebhookEvent, error)
+	// Refund returns part or all of a captured payment
+	Refund(ctx context.Context, providerRef string, amount float64) (*Refund, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{}
+	methods   = map[string]Provider{}
+)
+
+// Register makes a provider available by name and as the handler for the
+// given payment methods
+func Register(p Provider, paymentMethods ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	providers[p.Name()] = p
+	for _, m := range paymentMethods {
+		methods[m] = p
+	}
+}
+
+// Get returns the provider registered under name
+func Get(name string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment provider: %s", name)
+	}
+	return p, nil
+}
+
+// ForMethod returns the provider that handles a payment method
+func ForMethod(method string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p, ok := methods[method]
+	if !ok {
+		return nil, fmt.Errorf("no online payment provider for method: %s", method)
+	}
+	return p, nil
+}
@@ -0,0 +1,66 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries webhook signatures in the form "t=<unix>,v1=<hex>"
+const SignatureHeader = "X-Payment-Signature"
+
+// SignatureTolerance is how old a signed webhook may be before it is rejected
+const SignatureTolerance = 5 * time.Minute
+
+// Sign returns the signature header value for a payload signed at t. The MAC
+// covers the timestamp and the raw body so replays with a new time fail.
+func Sign(secret, payload []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + computeMAC(secret, ts, payload)
+}
+
+// VerifySignature checks a signature header produced by Sign
+func VerifySignature(secret, payload []byte, header string, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	if ts == "" || sig == "" {
+		return fmt.Errorf("malformed signature header")
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed signature timestamp")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return fmt.Errorf("signature timestamp outside tolerance")
+	}
+
+	expected := computeMAC(secret, ts, payload)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func computeMAC(secret []byte, ts string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,63 @@
+// Package policy decides who may access which resources. Handlers identify
+// the caller as an Actor and ask the policy before returning or changing a
+// record, so access rules live in one place instead of in each handler.
+// Staff access comes from the permissions of the actor's role.
+package policy
+
+import "go_module/internal/models"
+
+// Actor is the authenticated caller of a request
+type Actor struct {
+	UserID int64
+	Role   string
+}
+
+// Can reports whether the actor's role grants a permission
+func (a Actor) Can(permission string) bool {
+	return models.RoleHasPermission(a.Role, permission)
+}
+
+// OwnerOr reports whether the actor owns a resource belonging to ownerID or
+// holds a permission that covers everyone's resources of that kind
+func OwnerOr(a Actor, ownerID int64, permission string) bool {
+	return a.UserID > 0 && (a.UserID == ownerID || a.Can(permission))
+}
+
+// CanViewUser reports whether the actor may see a user's profile
+func CanViewUser(a Actor, userID int64) bool {
+	return OwnerOr(a, userID, models.PermUsersRead)
+}
+
+// CanViewOrder reports whether the actor may see an order and its payments
+// and payment proofs
+func CanViewOrder(a Actor, order *models.Order) bool {
+	return OwnerOr(a, order.UserID, models.PermOrdersRead)
+}
+
+// CanPayOrder reports whether the actor may pay for an order or submit proof
+// of payment. Only the customer who placed the order pays for it; staff
+// record payments through the review endpoints instead.
+func CanPayOrder(a Actor, order *models.Order) bool {
+	return a.UserID > 0 && a.UserID == order.UserID
+}
+
+// CanAssignRole reports whether the actor may move a user from their current
+// role to a new one. Staff can only hand out permissions they hold
+// themselves, cannot change the role of someone with permissions they lack,
+// and cannot change their own role.
+func CanAssignRole(a Actor, userID int64, currentRole, newRole string) bool {
+	if !a.Can(models.PermUsersManageRoles) || a.UserID == userID {
+		return false
+	}
+	return a.holdsAll(currentRole) && a.holdsAll(newRole)
+}
+
+// holdsAll reports whether the actor has every permission a role grants
+func (a Actor) holdsAll(role string) bool {
+	for _, p := range models.RolePermissions(role) {
+		if !a.Can(p) {
+			return false
+		}
+	}
+	return true
+}
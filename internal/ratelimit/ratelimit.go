@@ -0,0 +1,94 @@
+// Package ratelimit implements token bucket rate limiting.
+//
+// A Limit allows Burst requests at once and refills them evenly over Per,
+// so {Burst: 5, Per: time.Minute} allows 5 requests straight away and then
+// one more every 12 seconds. Buckets live in a Store. MemoryStore keeps them
+// in this process, which is right for a single server. Several servers
+// behind a load balancer need a shared Store, such as one backed by Redis,
+// so that a client can't multiply its allowance by spreading requests.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is the size of a bucket and how long it takes to refill
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// rate is how many tokens the bucket gains per second
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Per.Seconds()
+}
+
+// Store holds token buckets by key
+type Store interface {
+	// Take removes a token from the bucket for key. When the bucket is empty
+	// it returns false and how long until a token is available.
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will be full again, for sweeping
+}
+
+// MemoryStore is a Store that keeps buckets in memory. Buckets that have
+// refilled are dropped now and then, so idle clients don't use memory.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		s.sweep(now)
+	}
+
+	rate := limit.rate()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.last).Seconds()
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*rate)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait, nil
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / rate * float64(time.Second)))
+	return true, 0, nil
+}
+
+// sweep drops buckets that have refilled, since a new bucket starts full
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,98 @@
+// Package tracetest records spans in memory for tests.
+//
+// Install a Recorder before the database is opened: the global tracer
+// provider can only be replaced once for tracers that were created earlier,
+// such as the SQL driver's. Then run the code under test and inspect the
+// spans it ended, for example to check that checkout's queries and commit
+// are children of the model and request spans.
+package tracetest
+
+import (
+	"context"
+	"sync"
+
+	"go_module/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Recorder keeps every span ended after Install
+type Recorder struct {
+	*tracetest.SpanRecorder
+
+	mu      sync.Mutex
+	onStart func(sdktrace.ReadWriteSpan)
+}
+
+// Install makes a tracer provider that records every span, sampled or not,
+// the global provider and returns its recorder
+func Install() *Recorder {
+	r := &Recorder{SpanRecorder: tracetest.NewSpanRecorder()}
+	otel.SetTracerProvider(tracing.NewProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSpanProcessor(r.SpanRecorder),
+		sdktrace.WithSpanProcessor(startHook{r}),
+	))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return r
+}
+
+// OnStart calls fn with every span as it starts, until OnStart is called
+// again. Tests use it to act at a precise point of the code under test, such
+// as cancelling a context when a given SQL statement begins.
+func (r *Recorder) OnStart(fn func(sdktrace.ReadWriteSpan)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onStart = fn
+}
+
+// startHook is the span processor behind Recorder.OnStart
+type startHook struct {
+	r *Recorder
+}
+
+func (h startHook) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	h.r.mu.Lock()
+	fn := h.r.onStart
+	h.r.mu.Unlock()
+	if fn != nil {
+		fn(s)
+	}
+}
+
+func (startHook) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (startHook) Shutdown(context.Context) error   { return nil }
+func (startHook) ForceFlush(context.Context) error { return nil }
+
+// Names returns the names of the ended spans, in the order they ended
+func (r *Recorder) Names() []string {
+	var names []string
+	for _, s := range r.Ended() {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+// Find returns the first ended span with a name, or nil
+func (r *Recorder) Find(name string) sdktrace.ReadOnlySpan {
+	for _, s := range r.Ended() {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Children returns the ended spans whose parent is span
+func (r *Recorder) Children(span sdktrace.ReadOnlySpan) []sdktrace.ReadOnlySpan {
+	var children []sdktrace.ReadOnlySpan
+	for _, s := range r.Ended() {
+		if s.Parent().SpanID() == span.SpanContext().SpanID() {
+			children = append(children, s)
+		}
+	}
+	return children
+}
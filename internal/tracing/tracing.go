@@ -0,0 +1,103 @@
+// Package tracing sets up OpenTelemetry tracing.
+//
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. Spans are started for each HTTP request by
+// middleware.Tracing, for each exported model function, and for each SQL
+// statement by the instrumented driver the database package opens, so a
+// slow checkout shows which query or commit the time went to.
+//
+// Spans are exported to stdout or over OTLP/HTTP, or not at all, which is
+// the default. The OTLP exporter reads the standard OTEL_EXPORTER_OTLP_*
+// variables for its endpoint and headers, and sampling follows
+// OTEL_TRACES_SAMPLER.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName names this server in exported spans unless OTEL_SERVICE_NAME
+// says otherwise
+const ServiceName = "lab-api"
+
+// Config is where spans are exported
+type Config struct {
+	// Exporter is "none", "stdout" or "otlp"
+	Exporter string
+}
+
+// ConfigFromEnv reads OTEL_TRACES_EXPORTER (none, stdout or otlp; default
+// none)
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Exporter: "none"}
+	if v := os.Getenv("OTEL_TRACES_EXPORTER"); v != "" {
+		if v != "none" && v != "stdout" && v != "otlp" {
+			return cfg, fmt.Errorf("invalid OTEL_TRACES_EXPORTER %q: expected none, stdout or otlp", v)
+		}
+		cfg.Exporter = v
+	}
+	return cfg, nil
+}
+
+// Setup installs the propagator and, unless the exporter is "none", a tracer
+// provider that batches spans to the exporter. The returned function flushes
+// spans that have not been exported yet.
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	// SDK errors, such as a collector that can't be reached, don't affect
+	// requests, so they are only warnings
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("OpenTelemetry error", "error", err)
+	}))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s span exporter: %v", cfg.Exporter, err)
+	}
+
+	tp := NewProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider describing this server, with the
+// given span processors or exporters
+func NewProvider(opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(ServiceName)),
+	)
+	if err != nil {
+		res = resource.Default()
+	}
+	// Resource attributes from the environment (OTEL_SERVICE_NAME,
+	// OTEL_RESOURCE_ATTRIBUTES) win over the defaults
+	if env, err := resource.New(context.Background(), resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, env); err == nil {
+			res = merged
+		}
+	}
+	return sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{sdktrace.WithResource(res)}, opts...)...)
+}
@@ -0,0 +1,252 @@
+// Package webhooks pushes domain events to integrators' HTTP endpoints.
+//
+// HandleEvent is subscribed to every event type in main. For each event it
+// queues one delivery per active webhook subscribed to that type, and the
+// sender started by Run posts them in the background. Each webhook's
+// deliveries are retried on their own, with backoff, so a broken endpoint
+// doesn't hold up the others. Every delivery stays in the log and can be
+// replayed.
+//
+// Requests are JSON envelopes signed like the payment provider's webhooks:
+// the X-Webhook-Signature header is "t=<unix>,v1=<hex>", where the MAC is
+// HMAC-SHA256 over "<t>.<body>" keyed with the webhook's secret.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go_module/internal/events"
+	"go_module/internal/models"
+	"go_module/internal/payments"
+)
+
+// Request headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// EventPing is the type of the test payload sent by Ping
+const EventPing = "ping"
+
+// Sender settings
+var (
+	// PollInterval is how often Run looks for due deliveries when nothing
+	// new was queued
+	PollInterval = 5 * time.Second
+	// MaxAttempts is how many times a delivery is sent before it is marked
+	// failed
+	MaxAttempts = 8
+	// Timeout bounds a single request to an endpoint, including reading
+	// the response
+	Timeout = 10 * time.Second
+	// Concurrency is how many deliveries are sent at once
+	Concurrency = 4
+)
+
+// maxResponseBody is how much of an endpoint's response is kept in the log
+const maxResponseBody = 1024
+
+// Envelope is the JSON body posted to webhooks. ID stays the same when a
+// delivery is retried or replayed, so receivers can drop duplicates.
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+var client = &http.Client{
+	// A redirect is reported as a failed delivery rather than followed, so
+	// the signed body is never posted somewhere else
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// wakeCh tells Run that a delivery was queued
+var wakeCh = make(chan struct{}, 1)
+
+func wake() {
+	select {
+	case wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// HandleEvent queues an event for the webhooks subscribed to its type. It is
+// an events.Handler.
+func HandleEvent(ctx context.Context, e events.Event) error {
+	body, err := json.Marshal(Envelope{
+		ID:        "evt_" + strconv.FormatInt(e.EventID, 10),
+		Type:      e.Type,
+		CreatedAt: e.CreatedAt,
+		Data:      e.Payload,
+	})
+	if err != nil {
+		return events.Permanent(fmt.Errorf("failed to encode webhook payload: %v", err))
+	}
+
+	queued, err := models.QueueWebhookDeliveries(ctx, e.EventID, e.Type, body)
+	if err != nil {
+		return err
+	}
+	if queued > 0 {
+		wake()
+	}
+	return nil
+}
+
+// Ping queues a test payload for a webhook so an integrator can check their
+// endpoint and signature verification
+func Ping(ctx context.Context, webhookID int64) (*models.WebhookDelivery, error) {
+	now := time.Now().UTC()
+	data, _ := json.Marshal(map[string]int64{"webhook_id": webhookID})
+	body, err := json.Marshal(Envelope{
+		ID:        "ping_" + strconv.FormatInt(now.UnixNano(), 10),
+		Type:      EventPing,
+		CreatedAt: now,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook ping: %v", err)
+	}
+
+	d, err := models.QueueWebhookPing(ctx, webhookID, EventPing, body)
+	if err != nil {
+		return nil, err
+	}
+	wake()
+	return d, nil
+}
+
+// Replay sends an earlier delivery's payload to its webhook again
+func Replay(ctx context.Context, webhookID, deliveryID int64) (*models.WebhookDelivery, error) {
+	d, err := models.ReplayWebhookDelivery(ctx, webhookID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	wake()
+	return d, nil
+}
+
+// Run sends queued deliveries until ctx is cancelled
+func Run(ctx context.Context) {
+	slog.InfoContext(ctx, "Webhook sender started", "poll_interval", PollInterval.String())
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := SendPending(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Webhook sender failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wakeCh:
+		}
+	}
+}
+
+// SendPending sends every due delivery and returns how many were delivered.
+// Tests can call it directly instead of waiting for Run.
+func SendPending(ctx context.Context) (int, error) {
+	delivered := 0
+	for {
+		// Claim one round at a time so the lease covers the slowest send
+		outgoing, err := models.ClaimWebhookDeliveries(ctx, Concurrency, 2*Timeout)
+		if err != nil {
+			return delivered, err
+		}
+		if len(outgoing) == 0 {
+			return delivered, nil
+		}
+
+		var wg sync.WaitGroup
+		attempts := make([]models.WebhookAttempt, len(outgoing))
+		for i, o := range outgoing {
+			wg.Add(1)
+			go func(i int, o models.OutgoingWebhook) {
+				defer wg.Done()
+				attempts[i] = send(ctx, o)
+			}(i, o)
+		}
+		wg.Wait()
+
+		for i, o := range outgoing {
+			if err := models.RecordWebhookAttempt(ctx, o.DeliveryID, attempts[i]); err != nil {
+				slog.ErrorContext(ctx, "Webhook sender failed", "error", err)
+				continue
+			}
+			if attempts[i].Delivered {
+				delivered++
+			}
+		}
+	}
+}
+
+// send posts a delivery to its webhook once. A 2xx response delivers it;
+// anything else is retried with backoff until MaxAttempts.
+func send(ctx context.Context, o models.OutgoingWebhook) (a models.WebhookAttempt) {
+	start := time.Now()
+	defer func() {
+		a.Duration = time.Since(start)
+		if a.Delivered {
+			return
+		}
+		attempts := o.Attempts + 1
+		if attempts < MaxAttempts {
+			a.RetryAt = time.Now().Add(events.RetryDelay(attempts))
+			slog.WarnContext(ctx, "Webhook delivery failed, will retry",
+				"delivery_id", o.DeliveryID, "event_type", o.EventType, "webhook_id", o.WebhookID, "attempts", attempts, "retry_at", a.RetryAt, "error", a.Error)
+		} else {
+			slog.ErrorContext(ctx, "Webhook sender gave up on delivery",
+				"delivery_id", o.DeliveryID, "event_type", o.EventType, "webhook_id", o.WebhookID, "attempts", attempts, "error", a.Error)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, bytes.NewReader([]byte(o.Payload)))
+	if err != nil {
+		a.Error = fmt.Sprintf("invalid request: %v", err)
+		return a
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ZaneMNL-Webhooks/1.0")
+	req.Header.Set(EventHeader, o.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(o.DeliveryID, 10))
+	req.Header.Set(SignatureHeader, payments.Sign([]byte(o.Secret), []byte(o.Payload), time.Now()))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	a.ResponseStatus = resp.StatusCode
+	a.ResponseBody = string(body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.Error = fmt.Sprintf("endpoint responded %s", resp.Status)
+		return a
+	}
+	a.Delivered = true
+	return a
+}
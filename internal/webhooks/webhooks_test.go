@@ -0,0 +1,197 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"go_module/internal/database"
+	"go_module/internal/dbtest"
+	"go_module/internal/events"
+	"go_module/internal/models"
+	"go_module/internal/payments"
+	"go_module/internal/webhooks"
+	"go_module/internal/webhooktest"
+)
+
+func TestMain(m *testing.M) {
+	// Subscribers must exist before the events they receive are recorded
+	events.Subscribe("webhooks", webhooks.HandleEvent, events.Types...)
+	dbtest.Main(m)
+}
+
+// subscribe starts a receiver and registers it as a webhook for OrderPlaced
+func subscribe(t *testing.T) (*webhooktest.Receiver, *models.Webhook) {
+	t.Helper()
+	rx := webhooktest.NewReceiver()
+	t.Cleanup(rx.Close)
+
+	w, err := models.CreateWebhook(context.Background(), rx.URL, t.Name(), []string{events.OrderPlaced})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { models.DeleteWebhook(context.Background(), w.WebhookID) })
+	rx.SetSecret(w.Secret)
+	return rx, w
+}
+
+// send dispatches recorded events and sends every due delivery, skipping
+// the retry delay of deliveries that failed before
+func send(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := events.DispatchPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err := database.DB.Exec("UPDATE webhook_deliveries SET NextAttemptAt = datetime('now') WHERE Status = ?", models.WebhookDeliveryPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := webhooks.SendPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// onlyDelivery returns the single delivery logged for a webhook
+func onlyDelivery(t *testing.T, webhookID int64) models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := models.GetWebhookDeliveries(context.Background(), webhookID, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("webhook has %d deliveries, want 1", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+func TestSignedDelivery(t *testing.T) {
+	rx, w := subscribe(t)
+	user := dbtest.NewUser(t, models.RoleCustomer)
+	order := dbtest.PlaceOrder(t, user.UserID, models.PaymentCashOnDelivery)
+	send(t)
+
+	reqs := rx.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("received %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if req.SignatureError != nil {
+		t.Errorf("signature: %v", req.SignatureError)
+	}
+	if err := payments.VerifySignature([]byte("not-the-secret"), req.Body, req.Header.Get(webhooks.SignatureHeader), time.Now()); err == nil {
+		t.Error("signature verified with the wrong secret")
+	}
+	if req.Event() != events.OrderPlaced || req.Envelope.Type != events.OrderPlaced {
+		t.Errorf("event = %q, envelope type %q; want %s", req.Event(), req.Envelope.Type, events.OrderPlaced)
+	}
+	var data events.OrderPlacedData
+	if err := json.Unmarshal(req.Envelope.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.OrderID != order.OrderID || data.UserID != user.UserID {
+		t.Errorf("data = %+v, want order %d of user %d", data, order.OrderID, user.UserID)
+	}
+
+	d := onlyDelivery(t, w.WebhookID)
+	if d.Status != models.WebhookDeliveryDelivered || d.Attempts != 1 || d.ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery = %s after %d attempts with response %d, want delivered after 1 with 204", d.Status, d.Attempts, d.ResponseStatus)
+	}
+}
+
+func TestDeliveryRetriedWithBackoff(t *testing.T) {
+	rx, w := subscribe(t)
+	user := dbtest.NewUser(t, models.RoleCustomer)
+	dbtest.PlaceOrder(t, user.UserID, models.PaymentCashOnDelivery)
+
+	rx.FailNext(1, http.StatusServiceUnavailable)
+	if _, err := events.DispatchPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := webhooks.SendPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	d := onlyDelivery(t, w.WebhookID)
+	if d.Status != models.WebhookDeliveryPending || d.Attempts != 1 || d.ResponseStatus != http.StatusServiceUnavailable {
+		t.Fatalf("delivery = %s after %d attempts with response %d, want pending after 1 with 503", d.Status, d.Attempts, d.ResponseStatus)
+	}
+	if d.NextAttemptAt == nil || time.Until(*d.NextAttemptAt) < 30*time.Second {
+		t.Errorf("next attempt at %v, want about a minute from now", d.NextAttemptAt)
+	}
+
+	// Not due yet: nothing is sent
+	if _, err := webhooks.SendPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rx.Requests()); n != 1 {
+		t.Fatalf("received %d requests before the retry was due, want 1", n)
+	}
+
+	send(t)
+	reqs := rx.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("received %d requests, want 2", len(reqs))
+	}
+	if reqs[0].Envelope.ID != reqs[1].Envelope.ID {
+		t.Errorf("retry has envelope ID %q, first attempt %q", reqs[1].Envelope.ID, reqs[0].Envelope.ID)
+	}
+	if d := onlyDelivery(t, w.WebhookID); d.Status != models.WebhookDeliveryDelivered || d.Attempts != 2 {
+		t.Errorf("delivery = %s after %d attempts, want delivered after 2", d.Status, d.Attempts)
+	}
+}
+
+func TestDeliveryGivenUp(t *testing.T) {
+	defer func(n int) { webhooks.MaxAttempts = n }(webhooks.MaxAttempts)
+	webhooks.MaxAttempts = 2
+
+	rx, w := subscribe(t)
+	user := dbtest.NewUser(t, models.RoleCustomer)
+	dbtest.PlaceOrder(t, user.UserID, models.PaymentCashOnDelivery)
+
+	rx.FailNext(2, http.StatusInternalServerError)
+	send(t)
+	send(t)
+	// Given up on: a third send would be delivered
+	send(t)
+
+	if n := len(rx.Requests()); n != 2 {
+		t.Errorf("received %d requests, want 2", n)
+	}
+	if d := onlyDelivery(t, w.WebhookID); d.Status != models.WebhookDeliveryFailed || d.Attempts != 2 {
+		t.Errorf("delivery = %s after %d attempts, want failed after 2", d.Status, d.Attempts)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	rx, w := subscribe(t)
+	user := dbtest.NewUser(t, models.RoleCustomer)
+	dbtest.PlaceOrder(t, user.UserID, models.PaymentCashOnDelivery)
+	send(t)
+	original := onlyDelivery(t, w.WebhookID)
+
+	replay, err := webhooks.Replay(context.Background(), w.WebhookID, original.DeliveryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ReplayOf == nil || *replay.ReplayOf != original.DeliveryID {
+		t.Errorf("replay points at %v, want delivery %d", replay.ReplayOf, original.DeliveryID)
+	}
+	send(t)
+
+	reqs := rx.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("received %d requests, want 2", len(reqs))
+	}
+	if reqs[1].SignatureError != nil {
+		t.Errorf("replay signature: %v", reqs[1].SignatureError)
+	}
+	if string(reqs[0].Body) != string(reqs[1].Body) {
+		t.Errorf("replay body = %s, original %s", reqs[1].Body, reqs[0].Body)
+	}
+	if reqs[0].Header.Get(webhooks.DeliveryHeader) == reqs[1].Header.Get(webhooks.DeliveryHeader) {
+		t.Error("replay has the original's delivery ID")
+	}
+}
@@ -0,0 +1,148 @@
+// Package webhooktest runs a local HTTP endpoint that records webhook
+// deliveries for tests.
+//
+// Start a Receiver, register its URL as a webhook, set the secret the API
+// returned with SetSecret, trigger the behaviour under test, then call
+// events.DispatchPending and webhooks.SendPending (or wait for the
+// background workers with WaitFor) and inspect what arrived. Every request
+// has its signature checked; FailNext makes the endpoint respond with an
+// error so retries can be exercised.
+package webhooktest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"go_module/internal/payments"
+	"go_module/internal/webhooks"
+)
+
+// Request is one delivery the receiver got
+type Request struct {
+	Header   http.Header
+	Body     []byte
+	Envelope webhooks.Envelope
+	// SignatureError is why the signature did not verify, or nil
+	SignatureError error
+}
+
+// Event is the request's event type header
+func (r Request) Event() string {
+	return r.Header.Get(webhooks.EventHeader)
+}
+
+// Receiver is an HTTP endpoint that keeps every webhook delivery
+type Receiver struct {
+	// URL is the address to register as the webhook's URL
+	URL string
+
+	server   *httptest.Server
+	mu       sync.Mutex
+	secret   string
+	requests []Request
+	failures []int
+	changed  chan struct{}
+}
+
+// NewReceiver starts a Receiver on a loopback port. Close it when done.
+func NewReceiver() *Receiver {
+	r := &Receiver{changed: make(chan struct{})}
+	r.server = httptest.NewServer(r)
+	r.URL = r.server.URL
+	return r
+}
+
+// Close shuts the receiver down
+func (r *Receiver) Close() {
+	r.server.Close()
+}
+
+// SetSecret sets the signing secret requests are verified with
+func (r *Receiver) SetSecret(secret string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secret = secret
+}
+
+// FailNext makes the next n requests get the given status code instead of
+// 204, such as to check that deliveries are retried
+func (r *Receiver) FailNext(n, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := 0; i < n; i++ {
+		r.failures = append(r.failures, status)
+	}
+}
+
+// ServeHTTP records a delivery and answers 204, or the status queued by
+// FailNext. A failed request is still recorded.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec := Request{Header: req.Header.Clone(), Body: body}
+	rec.SignatureError = payments.VerifySignature([]byte(r.secret), body, req.Header.Get(webhooks.SignatureHeader), time.Now())
+	if err := json.Unmarshal(body, &rec.Envelope); err != nil {
+		rec.SignatureError = fmt.Errorf("body is not a webhook envelope: %v", err)
+	}
+	r.requests = append(r.requests, rec)
+	close(r.changed)
+	r.changed = make(chan struct{})
+
+	if len(r.failures) > 0 {
+		status := r.failures[0]
+		r.failures = r.failures[1:]
+		http.Error(w, "failure requested by test", status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Requests returns every request received so far
+func (r *Receiver) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Request(nil), r.requests...)
+}
+
+// Reset forgets every request and queued failure
+func (r *Receiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = nil
+	r.failures = nil
+}
+
+// WaitFor returns the first request matching match, waiting for one to
+// arrive until ctx ends
+func (r *Receiver) WaitFor(ctx context.Context, match func(Request) bool) (Request, error) {
+	for {
+		r.mu.Lock()
+		for _, req := range r.requests {
+			if match(req) {
+				r.mu.Unlock()
+				return req, nil
+			}
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return Request{}, fmt.Errorf("no matching webhook was received: %v", ctx.Err())
+		}
+	}
+}
@@ -14,5 +14,6 @@ cd cmd/api
 go build -o ../../bin/server
 cd ../..
 
+# Dev mode: loopback only, with the development JWT key
 echo "Starting server..."
-./bin/server 
\ No newline at end of file
+./bin/server --dev 
\ No newline at end of file